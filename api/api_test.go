@@ -0,0 +1,429 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pxe-manager/auth"
+	"pxe-manager/auth/oidctest"
+	"pxe-manager/config"
+	"pxe-manager/database"
+	"pxe-manager/pki"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	// SetupRouter 按相对路径加载 web/templates
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// testServer 为基于 MemoryStore 的完整路由
+type testServer struct {
+	t      *testing.T
+	router *gin.Engine
+	store  *database.MemoryStore
+	cfg    *config.Config
+}
+
+func newTestConfig(t *testing.T) *config.Config {
+	cfg := &config.Config{Mode: "development"}
+	cfg.Auth.AuthToken = "secret"
+	cfg.Auth.RateLimit = 1000
+	cfg.Auth.TokenRoles = []string{auth.RoleAdmin}
+	cfg.TFTP.Root = t.TempDir()
+	return cfg
+}
+
+func newTestServer(t *testing.T, cfg *config.Config) *testServer {
+	t.Helper()
+	return newTestServerCA(t, cfg, false)
+}
+
+// newTestServerCA withCA 为 true 时在临时目录启用内置 CA
+func newTestServerCA(t *testing.T, cfg *config.Config, withCA bool) *testServer {
+	t.Helper()
+	if cfg == nil {
+		cfg = newTestConfig(t)
+	}
+	store := database.NewMemoryStore()
+	stores := Stores{
+		Servers: store, Templates: store, Idempotency: store, Users: store,
+		APIKeys: store, Certs: store, Variables: store, Snippets: store,
+	}
+	var ca *pki.CA
+	if withCA {
+		var err error
+		if ca, err = pki.LoadOrCreate(t.TempDir(), store, time.Hour, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &testServer{t: t, router: SetupRouter(stores, nil, cfg, ca), store: store, cfg: cfg}
+}
+
+// do 以共享令牌发送请求；body 非 nil 时编码为 JSON
+func (ts *testServer) do(method, path string, body interface{}) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	var r *http.Request
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		r = httptest.NewRequest(method, path, strings.NewReader(string(b)))
+		r.Header.Set("Content-Type", "application/json")
+	} else {
+		r = httptest.NewRequest(method, path, nil)
+	}
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, r)
+	return w
+}
+
+func (ts *testServer) expect(w *httptest.ResponseRecorder, status int) map[string]interface{} {
+	ts.t.Helper()
+	if w.Code != status {
+		ts.t.Fatalf("status = %d, want %d: %s", w.Code, status, w.Body.String())
+	}
+	var res map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &res)
+	return res
+}
+
+func (ts *testServer) status(serial string) string {
+	ts.t.Helper()
+	s, err := ts.store.GetServerBySerial(serial)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return s.Status
+}
+
+// confirmedServer 上报并确认一台服务器，再创建一个 CentOS 模板，返回模板 ID
+func (ts *testServer) confirmedServer(serial string) string {
+	ts.t.Helper()
+	ts.expect(ts.do("POST", "/api/report", map[string]interface{}{
+		"requestId": "r-" + serial, "serial": serial, "hostname": "node-" + serial, "macAddress": "aa:bb:cc:dd:ee:01",
+	}), http.StatusOK)
+	ts.expect(ts.do("POST", "/api/servers/"+serial+"/confirm", nil), http.StatusOK)
+	res := ts.expect(ts.do("POST", "/api/configs", CreateConfigRequest{
+		Name: "centos7", SystemType: "centos", SystemVersion: "7", ConfigContent: "install\nnetwork --hostname={{ .Server.Hostname }}\n",
+	}), http.StatusOK)
+	return fmt.Sprint(res["id"])
+}
+
+func jsonString(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func TestRequiresAuthentication(t *testing.T) {
+	ts := newTestServer(t, nil)
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, httptest.NewRequest("GET", "/api/servers", nil))
+	ts.expect(w, http.StatusUnauthorized)
+}
+
+func TestReportIsIdempotent(t *testing.T) {
+	ts := newTestServer(t, nil)
+	report := map[string]interface{}{"requestId": "r1", "serial": "S1", "macAddress": "aa:bb:cc:dd:ee:01"}
+	ts.expect(ts.do("POST", "/api/report", report), http.StatusOK)
+	res := ts.expect(ts.do("POST", "/api/report", report), http.StatusOK)
+	if res["message"] != "重复请求，已忽略" {
+		t.Fatalf("duplicate report: %v", res)
+	}
+	ts.expect(ts.do("POST", "/api/report", map[string]interface{}{"serial": "S1"}), http.StatusBadRequest)
+	if s := ts.status("S1"); s != database.StatusPending {
+		t.Fatalf("status = %s", s)
+	}
+}
+
+func TestApplyAndMarkInstalled(t *testing.T) {
+	ts := newTestServer(t, nil)
+	id := ts.confirmedServer("S1")
+	res := ts.expect(ts.do("POST", "/api/configs/"+id+"/apply?serial=S1", nil), http.StatusOK)
+	if res["revision"] != float64(1) {
+		t.Fatalf("apply: %v", res)
+	}
+	content, err := os.ReadFile(filepath.Join(ts.cfg.TFTP.Root, "pxelinux.cfg", "01-aa-bb-cc-dd-ee-01"))
+	if err != nil || !strings.Contains(string(content), "--hostname=node-S1") {
+		t.Fatalf("pxelinux file = %q, %v", content, err)
+	}
+	s, _ := ts.store.GetServerBySerial("S1")
+	if s.Status != database.StatusProvisioning || s.TemplateRevision != 1 {
+		t.Fatalf("server = %s rev %d", s.Status, s.TemplateRevision)
+	}
+	// 重复应用不再迁移状态
+	ts.expect(ts.do("POST", "/api/configs/"+id+"/apply?serial=S1", nil), http.StatusOK)
+	ts.expect(ts.do("POST", "/api/servers/S1/install", nil), http.StatusOK)
+	if st := ts.status("S1"); st != database.StatusInstalled {
+		t.Fatalf("status = %s", st)
+	}
+}
+
+func TestApplyRequiresConfirmedServer(t *testing.T) {
+	ts := newTestServer(t, nil)
+	id := ts.confirmedServer("S1")
+	ts.expect(ts.do("POST", "/api/report", map[string]interface{}{"requestId": "r2", "serial": "S2", "macAddress": "aa:bb:cc:dd:ee:02"}), http.StatusOK)
+	ts.expect(ts.do("POST", "/api/configs/"+id+"/apply?serial=S2", nil), http.StatusConflict)
+	if _, err := os.Stat(filepath.Join(ts.cfg.TFTP.Root, "pxelinux.cfg", "01-aa-bb-cc-dd-ee-02")); !os.IsNotExist(err) {
+		t.Fatalf("file written for rejected apply: %v", err)
+	}
+}
+
+func TestApplyRevertsStatusWhenWriteFails(t *testing.T) {
+	cfg := newTestConfig(t)
+	// TFTP 根目录是普通文件，创建子目录必然失败
+	cfg.TFTP.Root = filepath.Join(t.TempDir(), "tftp")
+	if err := os.WriteFile(cfg.TFTP.Root, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServer(t, cfg)
+	id := ts.confirmedServer("S1")
+	ts.expect(ts.do("POST", "/api/configs/"+id+"/apply?serial=S1", nil), http.StatusInternalServerError)
+	s, _ := ts.store.GetServerBySerial("S1")
+	if s.Status != database.StatusConfirmed || s.TemplateID != 0 {
+		t.Fatalf("server after failed apply = %s template %d", s.Status, s.TemplateID)
+	}
+	hist, _ := ts.store.ListServerHistory("S1")
+	if last := hist[len(hist)-1]; last.FromStatus != database.StatusProvisioning || last.ToStatus != database.StatusConfirmed {
+		t.Fatalf("last history = %+v", last)
+	}
+}
+
+// 主机名等字段拼接进 Kickstart 的 network 指令，含空白或 "=" 的值不能注入额外选项
+func TestReportRejectsInjectedFields(t *testing.T) {
+	ts := newTestServer(t, nil)
+	for i, field := range []string{"hostname", "lanNic", "ipAddress", "gateway"} {
+		report := map[string]interface{}{"requestId": fmt.Sprint("r", i), "serial": "S1", "macAddress": "aa:bb:cc:dd:ee:01"}
+		report[field] = "x --bootproto=dhcp --device=eth9"
+		ts.expect(ts.do("POST", "/api/report", report), http.StatusBadRequest)
+	}
+	if _, err := ts.store.GetServerBySerial("S1"); err == nil {
+		t.Fatal("rejected report saved")
+	}
+
+	// 校验上线前保存的旧数据在应用时被拒绝，且不写入文件
+	id := ts.confirmedServer("S2")
+	s, _ := ts.store.GetServerBySerial("S2")
+	s.Hostname = "h --bootproto=dhcp"
+	if err := ts.store.SaveServer(s, "test"); err != nil {
+		t.Fatal(err)
+	}
+	ts.expect(ts.do("POST", "/api/configs/"+id+"/apply?serial=S2", nil), http.StatusUnprocessableEntity)
+	if entries, _ := os.ReadDir(ts.cfg.TFTP.Root); len(entries) != 0 {
+		t.Fatalf("apply wrote %d entries", len(entries))
+	}
+}
+
+func TestConfigRevisions(t *testing.T) {
+	ts := newTestServer(t, nil)
+	id := ts.confirmedServer("S1")
+	update := CreateConfigRequest{Name: "centos7", SystemType: "centos", SystemVersion: "7", ConfigContent: "install\nreboot\n", Comment: "加入 reboot"}
+	if res := ts.expect(ts.do("PUT", "/api/configs/"+id, update), http.StatusOK); res["revision"] != float64(2) {
+		t.Fatalf("update: %v", res)
+	}
+	ts.expect(ts.do("PUT", "/api/configs/999", update), http.StatusNotFound)
+
+	res := ts.expect(ts.do("GET", "/api/configs/"+id+"/diff", nil), http.StatusOK)
+	if !strings.Contains(res["diff"].(string), "+reboot") || jsonString(res["changed"]) != `["configContent"]` {
+		t.Fatalf("diff: %v", res)
+	}
+	res = ts.expect(ts.do("POST", "/api/configs/"+id+"/rollback?rev=1", nil), http.StatusOK)
+	if res["revision"] != float64(3) {
+		t.Fatalf("rollback: %v", res)
+	}
+	ts.expect(ts.do("POST", "/api/configs/"+id+"/rollback?rev=3", nil), http.StatusBadRequest)
+
+	w := ts.do("GET", "/api/configs/"+id+"/revisions", nil)
+	var revs []RevisionSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &revs); err != nil || len(revs) != 3 || !revs[2].Current || revs[2].Comment != "回滚到版本 1" {
+		t.Fatalf("revisions = %+v, %v", revs, err)
+	}
+}
+
+func TestRenderDoesNotWrite(t *testing.T) {
+	ts := newTestServer(t, nil)
+	id := ts.confirmedServer("S1")
+	res := ts.expect(ts.do("GET", "/api/configs/"+id+"/render?serial=S1", nil), http.StatusOK)
+	files, _ := res["files"].([]interface{})
+	if len(files) != 1 || files[0].(map[string]interface{})["disk"] != DiskMissing {
+		t.Fatalf("files = %v", res["files"])
+	}
+	if entries, _ := os.ReadDir(ts.cfg.TFTP.Root); len(entries) != 0 {
+		t.Fatalf("render wrote %d entries", len(entries))
+	}
+	if st := ts.status("S1"); st != database.StatusConfirmed {
+		t.Fatalf("status = %s", st)
+	}
+}
+
+// 渲染结果含 root 密码哈希，只读角色不能预览
+func TestRenderRequiresApplyPermission(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Provision.RootPasswordHash = "$6$salt$hash"
+	ts := newTestServer(t, cfg)
+	id := ts.confirmedServer("S1")
+	res := ts.expect(ts.do("POST", "/api/keys", CreateAPIKeyRequest{
+		Name: "viewer", Scopes: []string{string(auth.PermServersRead), string(auth.PermTemplatesRead)},
+	}), http.StatusCreated)
+	r := httptest.NewRequest("GET", "/api/configs/"+id+"/render?serial=S1", nil)
+	r.Header.Set("Authorization", "Bearer "+res["key"].(string))
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, r)
+	ts.expect(w, http.StatusForbidden)
+
+	res = ts.expect(ts.do("GET", "/api/configs/"+id+"/render?serial=S1", nil), http.StatusOK)
+	if !strings.Contains(res["content"].(string), "rootpw --iscrypted $6$salt$hash") {
+		t.Fatalf("content = %v", res["content"])
+	}
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	iss := oidctest.NewIssuer("pxe-manager", "s3cret")
+	defer iss.Close()
+	iss.SetClaims(map[string]interface{}{"preferred_username": "alice", "groups": []string{"ops"}})
+	cfg := newTestConfig(t)
+	cfg.Auth.OIDC = config.OIDCConfig{
+		Enabled: true, Issuer: iss.URL(), ClientID: "pxe-manager", ClientSecret: "s3cret",
+		RedirectURL: "http://pxe.test/api/auth/oidc/callback",
+		RoleClaim:   "groups", RoleMapping: map[string][]string{"ops": {auth.RoleOperator}},
+	}
+	ts := newTestServer(t, cfg)
+
+	// login 返回跳转地址与 state Cookie，身份源自动授权后返回回调地址
+	login := func() (*http.Cookie, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		ts.router.ServeHTTP(w, httptest.NewRequest("GET", "/api/auth/oidc/login", nil))
+		var cookie *http.Cookie
+		for _, c := range w.Result().Cookies() {
+			if c.Name == auth.OIDCStateCookie {
+				cookie = c
+			}
+		}
+		if w.Code != http.StatusFound || cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+			t.Fatalf("login: status %d cookie %+v", w.Code, cookie)
+		}
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Get(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		u, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cookie, "/api/auth/oidc/callback?" + u.RawQuery
+	}
+	callback := func(path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		ts.router.ServeHTTP(w, r)
+		return w
+	}
+
+	_, path := login()
+	ts.expect(callback(path, nil), http.StatusUnauthorized)
+
+	// 攻击者的回调地址配合受害者自己的 state Cookie 同样被拒绝
+	victim, _ := login()
+	_, attacker := login()
+	ts.expect(callback(attacker, victim), http.StatusUnauthorized)
+
+	cookie, path := login()
+	w := callback(path, cookie)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/" {
+		t.Fatalf("callback: %d %s", w.Code, w.Body.String())
+	}
+	var session, cleared bool
+	for _, c := range w.Result().Cookies() {
+		session = session || (c.Name == auth.SessionCookie && c.Value != "")
+		cleared = cleared || (c.Name == auth.OIDCStateCookie && c.MaxAge < 0)
+	}
+	if !session || !cleared {
+		t.Fatalf("cookies = %v", w.Result().Cookies())
+	}
+	if u, err := ts.store.GetUserByUsername("alice"); err != nil || u.Source != database.UserSourceOIDC {
+		t.Fatalf("user = %+v, %v", u, err)
+	}
+}
+
+func newCSR(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+}
+
+// 批量注册令牌不能为已有有效证书或超出令牌序列号范围的服务器签发证书
+func TestCertEnrollBindsSerial(t *testing.T) {
+	ts := newTestServerCA(t, nil, true)
+	res := ts.expect(ts.do("POST", "/api/enrollment-tokens", CreateEnrollmentTokenRequest{
+		Name: "rack-a12", MaxUses: 10, SerialPattern: "A12-*",
+	}), http.StatusCreated)
+	token := res["token"].(string)
+	ts.expect(ts.do("POST", "/api/enrollment-tokens", CreateEnrollmentTokenRequest{Name: "bad", SerialPattern: "["}), http.StatusBadRequest)
+
+	enroll := func(serial string) *httptest.ResponseRecorder {
+		return ts.do("POST", "/api/certs/enroll", CertEnrollRequest{Token: token, Serial: serial, CSR: newCSR(t)})
+	}
+	res = ts.expect(enroll("A12-01"), http.StatusCreated)
+	certSerial := res["serial"].(string)
+	// 同一令牌再次为已注册的服务器签发（冒领其身份）被拒绝
+	ts.expect(enroll("A12-01"), http.StatusConflict)
+	ts.expect(enroll("B07-01"), http.StatusForbidden)
+	ts.expect(enroll("A12-02"), http.StatusCreated)
+
+	// 吊销后可重新注册
+	ts.expect(ts.do("POST", "/api/certs/"+certSerial+"/revoke", nil), http.StatusOK)
+	ts.expect(enroll("A12-01"), http.StatusCreated)
+}
+
+// 未配置 mode 时不返回 CORS 头，只有显式的开发模式允许任意来源
+func TestCORSDefaultsClosed(t *testing.T) {
+	preflight := func(ts *testServer) http.Header {
+		r := httptest.NewRequest("OPTIONS", "/api/servers", nil)
+		r.Header.Set("Origin", "https://evil.example")
+		r.Header.Set("Access-Control-Request-Method", "GET")
+		w := httptest.NewRecorder()
+		ts.router.ServeHTTP(w, r)
+		return w.Header()
+	}
+	cfg := newTestConfig(t)
+	cfg.Mode = ""
+	if h := preflight(newTestServer(t, cfg)); h.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("unset mode: %v", h)
+	}
+	if h := preflight(newTestServer(t, nil)); h.Get("Access-Control-Allow-Origin") != "*" {
+		t.Fatalf("development mode: %v", h)
+	}
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pxe-manager/auth"
+	"pxe-manager/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateAPIKeyRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn string   `json:"expiresIn"` // 如 "720h"，空表示永不过期
+}
+
+type CreateEnrollmentTokenRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`    // 默认 ["report:write"]
+	MaxUses   int      `json:"maxUses"`   // 默认 1
+	ExpiresIn string   `json:"expiresIn"` // 默认 "72h"
+	// SerialPattern 限制换取证书的服务器序列号，如 "SN-A12-*"；空表示不限制
+	SerialPattern string `json:"serialPattern"`
+}
+
+type EnrollRequest struct {
+	Token string `json:"token"`
+	Name  string `json:"name"` // Agent 标识，通常为序列号
+}
+
+// maxEnrollmentUses 限制单个注册令牌可换取的密钥数量
+const maxEnrollmentUses = 10000
+
+// parseExpiresIn 解析有效期，空字符串返回 def
+func parseExpiresIn(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, errors.New("expiresIn 格式无效")
+	}
+	return d, nil
+}
+
+func ListAPIKeysHandler(store database.APIKeyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := store.ListAPIKeys()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询 API 密钥失败"})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// CreateAPIKeyHandler 签发 API 密钥，明文密钥只在响应中出现一次
+// POST /api/keys {"name": "...", "scopes": ["report:write"], "expiresIn": "720h"}
+func CreateAPIKeyHandler(keys *auth.APIKeyManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateAPIKeyRequest
+		if err := c.BindJSON(&req); err != nil || req.Name == "" || len(req.Scopes) == 0 {
+			auditEvent(c, "create_api_key", req.Name, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "名称与作用域不能为空"})
+			return
+		}
+		scopes, bad := auth.NormalizeScopes(req.Scopes)
+		if bad != "" {
+			auditEvent(c, "create_api_key", req.Name, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "未知作用域: " + bad})
+			return
+		}
+		ttl, err := parseExpiresIn(req.ExpiresIn, 0)
+		if err != nil {
+			auditEvent(c, "create_api_key", req.Name, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		secret, k, err := keys.Create(req.Name, scopes, ttl, actorOf(c))
+		if err != nil {
+			auditEvent(c, "create_api_key", req.Name, "failure")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建 API 密钥失败"})
+			return
+		}
+		auditEventMeta(c, "create_api_key", req.Name, "success", map[string]interface{}{
+			"id": k.ID, "prefix": k.Prefix, "scopes": scopes,
+		})
+		c.JSON(http.StatusCreated, gin.H{"key": secret, "apiKey": k})
+	}
+}
+
+func RevokeAPIKeyHandler(store database.APIKeyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的密钥ID"})
+			return
+		}
+		if err := store.RevokeAPIKey(id); err != nil {
+			auditEvent(c, "revoke_api_key", c.Param("id"), "failure")
+			if errors.Is(err, database.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "未找到 API 密钥"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "吊销 API 密钥失败"})
+			return
+		}
+		auditEvent(c, "revoke_api_key", c.Param("id"), "success")
+		c.JSON(http.StatusOK, gin.H{"message": "API 密钥已吊销"})
+	}
+}
+
+func ListEnrollmentTokensHandler(store database.APIKeyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := store.ListEnrollmentTokens()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询注册令牌失败"})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// CreateEnrollmentTokenHandler 为一批新机架签发限次注册令牌
+// POST /api/enrollment-tokens {"name": "rack-a12", "maxUses": 40, "expiresIn": "72h", "serialPattern": "SN-A12-*"}
+func CreateEnrollmentTokenHandler(keys *auth.APIKeyManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateEnrollmentTokenRequest
+		if err := c.BindJSON(&req); err != nil || req.Name == "" {
+			auditEvent(c, "create_enrollment_token", req.Name, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "名称不能为空"})
+			return
+		}
+		if len(req.Scopes) == 0 {
+			req.Scopes = []string{string(auth.PermReportWrite)}
+		}
+		scopes, bad := auth.NormalizeScopes(req.Scopes)
+		if bad != "" {
+			auditEvent(c, "create_enrollment_token", req.Name, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "未知作用域: " + bad})
+			return
+		}
+		if req.MaxUses == 0 {
+			req.MaxUses = 1
+		}
+		if req.MaxUses < 0 || req.MaxUses > maxEnrollmentUses {
+			auditEvent(c, "create_enrollment_token", req.Name, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "maxUses 取值范围为 1-10000"})
+			return
+		}
+		ttl, err := parseExpiresIn(req.ExpiresIn, 72*time.Hour)
+		if err != nil {
+			auditEvent(c, "create_enrollment_token", req.Name, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		secret, t, err := keys.CreateEnrollmentToken(req.Name, scopes, req.MaxUses, req.SerialPattern, ttl, actorOf(c))
+		if err != nil {
+			auditEvent(c, "create_enrollment_token", req.Name, "failure")
+			if errors.Is(err, auth.ErrEnrollmentScope) || errors.Is(err, auth.ErrEnrollmentPattern) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建注册令牌失败"})
+			return
+		}
+		auditEventMeta(c, "create_enrollment_token", req.Name, "success", map[string]interface{}{
+			"id": t.ID, "prefix": t.Prefix, "scopes": scopes, "maxUses": t.MaxUses, "serialPattern": t.SerialPattern,
+		})
+		c.JSON(http.StatusCreated, gin.H{"token": secret, "enrollmentToken": t})
+	}
+}
+
+func RevokeEnrollmentTokenHandler(store database.APIKeyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的令牌ID"})
+			return
+		}
+		if err := store.RevokeEnrollmentToken(id); err != nil {
+			auditEvent(c, "revoke_enrollment_token", c.Param("id"), "failure")
+			if errors.Is(err, database.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "未找到注册令牌"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "吊销注册令牌失败"})
+			return
+		}
+		auditEvent(c, "revoke_enrollment_token", c.Param("id"), "success")
+		c.JSON(http.StatusOK, gin.H{"message": "注册令牌已吊销"})
+	}
+}
+
+// EnrollHandler Agent 使用注册令牌换取自己的 API 密钥（无需其他认证）
+// POST /api/enroll {"token": "pxt_...", "name": "<序列号>"}
+func EnrollHandler(keys *auth.APIKeyManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req EnrollRequest
+		if err := c.BindJSON(&req); err != nil || req.Token == "" || req.Name == "" {
+			auditEvent(c, "enroll", req.Name, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "令牌与名称不能为空"})
+			return
+		}
+		secret, k, err := keys.Enroll(req.Token, req.Name)
+		if err != nil {
+			auditEvent(c, "enroll", req.Name, "failure")
+			if errors.Is(err, auth.ErrInvalidEnrollment) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "注册失败"})
+			return
+		}
+		auditEventMeta(c, "enroll", req.Name, "success", map[string]interface{}{
+			"apiKeyId": k.ID, "prefix": k.Prefix, "scopes": k.Scopes,
+		})
+		c.JSON(http.StatusCreated, gin.H{"key": secret, "apiKey": k})
+	}
+}
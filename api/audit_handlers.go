@@ -1,63 +1,98 @@
 package api
 
 import (
-	"bufio"
-	"encoding/json"
-	"os"
+	"errors"
+	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"pxe-manager/audit"
-	"pxe-manager/config"
 
 	"github.com/gin-gonic/gin"
 )
 
-// ListAuditLogsHandler 读取审计日志 JSON 行，支持 limit/offset/order
-// GET /api/audit/logs?limit=100&offset=0&order=desc
-func ListAuditLogsHandler(cfg *config.Config) gin.HandlerFunc {
+// ListAuditLogsHandler 在审计存储中服务端筛选并按游标分页
+// GET /api/audit/logs?limit=100&order=desc&cursor=&method=&path=&action=&status=&clientIP=&actor=&target=&from=&to=
+// 返回 {"items": [...], "nextCursor": "..."}，nextCursor 为空表示没有更多数据
+func ListAuditLogsHandler(logger *audit.AuditLogger) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		path := cfg.Auth.AuditLogPath
+		if logger == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "审计日志未启用"})
+			return
+		}
 		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
-		if limit <= 0 {
-			limit = 100
+		q := audit.Query{
+			Method:   c.Query("method"),
+			Path:     c.Query("path"),
+			Action:   c.Query("action"),
+			Status:   c.Query("status"),
+			ClientIP: c.Query("clientIP"),
+			Actor:    c.Query("actor"),
+			Target:   c.Query("target"),
+			Desc:     c.DefaultQuery("order", "desc") == "desc", // desc: 最新在前
+			Limit:    limit,
+			Cursor:   c.Query("cursor"),
+		}
+		var err error
+		if q.From, err = parseAuditTime(c.Query("from"), false); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "参数 from 时间格式无效"})
+			return
 		}
-		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
-		if offset < 0 {
-			offset = 0
+		if q.To, err = parseAuditTime(c.Query("to"), true); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "参数 to 时间格式无效"})
+			return
 		}
-		order := c.DefaultQuery("order", "desc") // desc: 最新在前
-
-		f, err := os.Open(path)
+		page, err := logger.Query(q)
 		if err != nil {
-			c.JSON(200, []audit.AuditLog{})
+			if errors.Is(err, audit.ErrInvalidCursor) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取审计日志失败"})
 			return
 		}
-		defer f.Close()
+		c.JSON(http.StatusOK, page)
+	}
+}
 
-		scanner := bufio.NewScanner(f)
-		var lines []audit.AuditLog
-		for scanner.Scan() {
-			var item audit.AuditLog
-			b := scanner.Bytes()
-			if err := json.Unmarshal(b, &item); err == nil {
-				lines = append(lines, item)
-			}
+// parseAuditTime 接受 RFC3339 或日期（2006-01-02，按 UTC）；仅日期的上界取当天结束
+func parseAuditTime(v string, end bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if strings.Contains(v, "T") {
+		return time.Parse(time.RFC3339, v)
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return t, err
+	}
+	if end {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t, nil
+}
+
+// VerifyAuditLogHandler 校验审计日志哈希链，返回第一个断点
+// GET /api/audit/verify
+func VerifyAuditLogHandler(logger *audit.AuditLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if logger == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "审计日志未启用"})
+			return
 		}
-		// 根据 order/offset/limit 切片
-		var out []audit.AuditLog
-		if order == "desc" {
-			for i := len(lines) - 1 - offset; i >= 0 && len(out) < limit; i-- {
-				out = append(out, lines[i])
-			}
-		} else { // asc
-			start := offset
-			if start < 0 {
-				start = 0
-			}
-			for i := start; i < len(lines) && len(out) < limit; i++ {
-				out = append(out, lines[i])
-			}
+		res, err := logger.Verify()
+		if err != nil {
+			auditEvent(c, "verify_audit", "", "failure")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取审计日志失败"})
+			return
+		}
+		status := "success"
+		if !res.OK {
+			status = "broken"
 		}
-		c.JSON(200, out)
+		auditEvent(c, "verify_audit", "", status)
+		c.JSON(http.StatusOK, res)
 	}
 }
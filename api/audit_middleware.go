@@ -21,6 +21,7 @@ func AuditRequestMiddleware(logger *audit.AuditLogger) gin.HandlerFunc {
 		}
 		_ = logger.LogEvent(audit.AuditLog{
 			ClientIP:  c.ClientIP(),
+			Actor:     principalName(c),
 			UserAgent: c.GetHeader("User-Agent"),
 			Method:    c.Request.Method,
 			Path:      c.Request.URL.Path,
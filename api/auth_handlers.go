@@ -0,0 +1,277 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"pxe-manager/auth"
+	"pxe-manager/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Cookie 为 true 时（Web 控制台）通过 HttpOnly Cookie 下发会话，响应中不返回令牌
+	Cookie bool `json:"cookie"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// LoginHandler 用户名密码登录，返回会话令牌（作为 Bearer 令牌使用）或写入会话 Cookie。
+// 先校验本地账号；启用 LDAP 时本地校验失败再尝试目录认证，同名本地账号优先。
+// POST /api/auth/login {"username": "...", "password": "...", "cookie": false}
+func LoginHandler(sessions *auth.SessionManager, ldap *auth.LDAPAuthenticator, users database.UserStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req LoginRequest
+		if err := c.BindJSON(&req); err != nil || req.Username == "" || req.Password == "" {
+			auditEvent(c, "login", req.Username, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "用户名和密码不能为空"})
+			return
+		}
+		source := database.UserSourceLocal
+		token, sess, u, err := sessions.Login(req.Username, req.Password, c.ClientIP())
+		if errors.Is(err, auth.ErrInvalidCredentials) && ldap != nil {
+			source = database.UserSourceLDAP
+			token, sess, u, err = ldapLogin(ldap, sessions, users, req.Username, req.Password, c.ClientIP())
+		}
+		if err != nil {
+			auditEventMeta(c, "login", req.Username, "failure", map[string]interface{}{"source": source})
+			switch {
+			case errors.Is(err, auth.ErrInvalidCredentials):
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			case errors.Is(err, auth.ErrNoRoles), errors.Is(err, auth.ErrUserDisabled):
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			case errors.Is(err, auth.ErrLDAPUnavailable):
+				log.Printf("LDAP 登录失败: %v", err)
+				c.JSON(http.StatusBadGateway, gin.H{"error": "身份源暂不可用"})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+			}
+			return
+		}
+		// 登录请求本身未经过认证中间件，手动写入上下文以便审计记录操作者
+		auth.SetPrincipal(c, auth.UserPrincipal(u))
+		auditEventMeta(c, "login", u.Username, "success", map[string]interface{}{"source": source})
+		resp, err := sessionResponse(c, sessions, token, sess, req.Cookie)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+			return
+		}
+		resp["username"] = u.Username
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// sessionResponse 下发新会话：cookie 为 true 时写入 Cookie 并返回 CSRF 令牌，否则返回 Bearer 令牌
+func sessionResponse(c *gin.Context, sessions *auth.SessionManager, token string, sess *database.Session, cookie bool) (gin.H, error) {
+	resp := gin.H{"expiresAt": sess.ExpiresAt.UTC().Format(time.RFC3339)}
+	if !cookie {
+		resp["token"] = token
+		return resp, nil
+	}
+	csrf, err := sessions.SetCookies(c, token, sess.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	resp["csrfToken"] = csrf
+	return resp, nil
+}
+
+// ldapLogin 通过 LDAP 认证并同步本地账号后签发会话。
+// 用户名被其他来源账号占用时按凭据错误处理，避免泄露账号是否存在。
+func ldapLogin(ldap *auth.LDAPAuthenticator, sessions *auth.SessionManager, users database.UserStore, username, password, clientIP string) (string, *database.Session, *database.User, error) {
+	username = auth.NormalizeLDAPUsername(username)
+	roles, err := ldap.Authenticate(username, password)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	u, err := auth.SyncExternalUser(users, database.UserSourceLDAP, username, roles)
+	if errors.Is(err, auth.ErrUserSourceConflict) {
+		return "", nil, nil, auth.ErrInvalidCredentials
+	}
+	if err != nil {
+		return "", nil, nil, err
+	}
+	token, sess, err := sessions.Issue(u, clientIP)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return token, sess, u, nil
+}
+
+// LogoutHandler 注销当前会话令牌，并清除会话 Cookie
+func LogoutHandler(sessions *auth.SessionManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if auth.CurrentUser(c) == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "当前请求未使用登录会话"})
+			return
+		}
+		if err := sessions.Logout(auth.SessionToken(c)); err != nil {
+			auditEvent(c, "logout", auth.Username(c), "failure")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "注销失败"})
+			return
+		}
+		sessions.ClearCookies(c)
+		auditEvent(c, "logout", auth.Username(c), "success")
+		c.JSON(http.StatusOK, gin.H{"message": "已注销"})
+	}
+}
+
+// ChangePasswordHandler 修改当前登录用户的密码。
+// 成功后吊销该用户的全部会话（其他设备需重新登录），并为当前客户端签发新会话：
+// 凭 Cookie 登录的写入新 Cookie，凭 Bearer 登录的在响应中返回新令牌。
+// POST /api/auth/password {"currentPassword": "...", "newPassword": "..."}
+func ChangePasswordHandler(sessions *auth.SessionManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u := auth.CurrentUser(c)
+		if u == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "当前请求未使用登录会话"})
+			return
+		}
+		var req ChangePasswordRequest
+		if err := c.BindJSON(&req); err != nil || req.CurrentPassword == "" || req.NewPassword == "" {
+			auditEvent(c, "change_password", u.Username, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "当前密码和新密码不能为空"})
+			return
+		}
+		if err := sessions.ChangePassword(u, req.CurrentPassword, req.NewPassword); err != nil {
+			auditEvent(c, "change_password", u.Username, "failure")
+			switch {
+			case errors.Is(err, auth.ErrWrongPassword):
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			case errors.Is(err, auth.ErrExternalPassword), errors.Is(err, auth.ErrWeakPassword):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "修改密码失败"})
+			}
+			return
+		}
+		auditEvent(c, "change_password", u.Username, "success")
+		token, sess, err := sessions.Issue(u, c.ClientIP())
+		if err == nil {
+			var resp gin.H
+			if resp, err = sessionResponse(c, sessions, token, sess, auth.CookieAuthenticated(c)); err == nil {
+				resp["message"] = "密码已修改，其他会话已注销"
+				c.JSON(http.StatusOK, resp)
+				return
+			}
+		}
+		// 旧会话已全部吊销，新会话签发失败时只能要求重新登录
+		sessions.ClearCookies(c)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "密码已修改，但签发新会话失败，请重新登录"})
+	}
+}
+
+// WhoamiHandler 返回当前请求的认证身份、角色与权限
+func WhoamiHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := auth.CurrentPrincipal(c)
+		perms := p.Permissions()
+		sort.Slice(perms, func(i, j int) bool { return perms[i] < perms[j] })
+		resp := gin.H{
+			"method":      p.Method,
+			"name":        p.Name,
+			"roles":       p.Roles,
+			"permissions": perms,
+			"clientIP":    c.ClientIP(),
+		}
+		if p.User != nil {
+			resp["username"] = p.User.Username
+			resp["userId"] = p.User.ID
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// AuthProvidersHandler 返回可用的登录方式，供前端决定是否展示单点登录入口
+func AuthProvidersHandler(oidc *auth.OIDCProvider, ldap *auth.LDAPAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"local": true, "oidc": oidc != nil, "ldap": ldap != nil})
+	}
+}
+
+// OIDCLoginHandler 跳转到 OIDC 身份源进行授权，state 同时写入 Cookie 以防登录 CSRF
+// GET /api/auth/oidc/login
+func OIDCLoginHandler(oidc *auth.OIDCProvider, sessions *auth.SessionManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, state, err := oidc.AuthURL(c.Request.Context())
+		if err != nil {
+			log.Printf("OIDC 登录跳转失败: %v", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "身份源暂不可用"})
+			return
+		}
+		sessions.SetOIDCState(c, state)
+		c.Redirect(http.StatusFound, u)
+	}
+}
+
+// OIDCCallbackHandler 处理身份源回调：校验 state Cookie 与 ID Token、同步账号与角色并签发会话，
+// 会话通过 HttpOnly Cookie 下发后跳转回控制台，令牌不经过 URL 与脚本
+// GET /api/auth/oidc/callback?code=...&state=...
+func OIDCCallbackHandler(oidc *auth.OIDCProvider, sessions *auth.SessionManager, users database.UserStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// state 必须来自本浏览器发起的登录，否则可能是攻击者诱导受害者登录其账号
+		cookieState := sessions.TakeOIDCState(c)
+		if cookieState == "" || subtle.ConstantTimeCompare([]byte(cookieState), []byte(c.Query("state"))) != 1 {
+			auditEventMeta(c, "oidc_login", "", "failure", map[string]interface{}{"error": "state Cookie 不匹配"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": auth.ErrOIDCState.Error()})
+			return
+		}
+		if e := c.Query("error"); e != "" {
+			auditEventMeta(c, "oidc_login", "", "failure", map[string]interface{}{"error": e})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "身份源拒绝了登录: " + e, "details": c.Query("error_description")})
+			return
+		}
+		claims, err := oidc.Exchange(c.Request.Context(), c.Query("code"), c.Query("state"))
+		if err != nil {
+			auditEventMeta(c, "oidc_login", "", "failure", map[string]interface{}{"error": err.Error()})
+			if errors.Is(err, auth.ErrOIDCState) || errors.Is(err, auth.ErrOIDCToken) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("OIDC 授权码交换失败: %v", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "身份源暂不可用"})
+			return
+		}
+		username, roles, err := oidc.Identity(claims)
+		if err != nil {
+			auditEventMeta(c, "oidc_login", username, "failure", map[string]interface{}{"error": err.Error()})
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		u, err := auth.SyncExternalUser(users, database.UserSourceOIDC, username, roles)
+		if err != nil {
+			auditEventMeta(c, "oidc_login", username, "failure", map[string]interface{}{"error": err.Error()})
+			switch {
+			case errors.Is(err, auth.ErrUserSourceConflict):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			case errors.Is(err, auth.ErrUserDisabled):
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+			}
+			return
+		}
+		token, sess, err := sessions.Issue(u, c.ClientIP())
+		if err == nil {
+			_, err = sessions.SetCookies(c, token, sess.ExpiresAt)
+		}
+		if err != nil {
+			auditEvent(c, "oidc_login", username, "failure")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+			return
+		}
+		auth.SetPrincipal(c, auth.UserPrincipal(u))
+		auditEventMeta(c, "oidc_login", username, "success", map[string]interface{}{"roles": u.Roles})
+		c.Redirect(http.StatusFound, "/")
+	}
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"pxe-manager/auth"
+	"pxe-manager/database"
+	"pxe-manager/pki"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CertEnrollRequest struct {
+	Token  string `json:"token"`  // 注册令牌，作用域须包含 report:write
+	Serial string `json:"serial"` // 服务器序列号，写入证书 CN
+	CSR    string `json:"csr"`    // PEM 编码的证书签名请求，私钥不离开 Agent
+}
+
+type CertRenewRequest struct {
+	CSR string `json:"csr"`
+}
+
+// certResponse 为签发结果；caCertificate 供 Agent 配置信任
+func certResponse(ca *pki.CA, rec *database.Certificate, certPEM []byte) gin.H {
+	return gin.H{
+		"certificate":   string(certPEM),
+		"caCertificate": string(ca.CertificatePEM()),
+		"serial":        rec.Serial,
+		"expiresAt":     rec.NotAfter.UTC().Format(time.RFC3339),
+	}
+}
+
+// issueError 将签发错误转换为响应
+func issueError(c *gin.Context, err error) {
+	if errors.Is(err, pki.ErrAlreadyEnrolled) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, pki.ErrInvalidCSR) || errors.Is(err, pki.ErrInvalidSerial) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "签发证书失败"})
+}
+
+// CertEnrollHandler Agent 凭注册令牌换取绑定本机序列号的客户端证书
+// POST /api/certs/enroll {"token": "pxt_...", "serial": "...", "csr": "-----BEGIN CERTIFICATE REQUEST-----..."}
+func CertEnrollHandler(ca *pki.CA, keys *auth.APIKeyManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CertEnrollRequest
+		if err := c.BindJSON(&req); err != nil || req.Token == "" || req.Serial == "" || req.CSR == "" {
+			auditEvent(c, "cert_enroll", req.Serial, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "token、serial 与 csr 不能为空"})
+			return
+		}
+		t, err := keys.ConsumeEnrollment(req.Token)
+		if err != nil {
+			auditEvent(c, "cert_enroll", req.Serial, "failure")
+			if errors.Is(err, auth.ErrInvalidEnrollment) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "注册失败"})
+			return
+		}
+		if !hasScope(t.Scopes, auth.PermReportWrite) {
+			auditEvent(c, "cert_enroll", req.Serial, "failure")
+			c.JSON(http.StatusForbidden, gin.H{"error": "注册令牌未授予 report:write，不能换取 Agent 证书"})
+			return
+		}
+		if !auth.AllowsSerial(t, req.Serial) {
+			auditEvent(c, "cert_enroll", req.Serial, "failure")
+			c.JSON(http.StatusForbidden, gin.H{"error": "注册令牌不允许为该序列号签发证书"})
+			return
+		}
+		// 已有有效证书的服务器只能凭现有证书续期，注册令牌不能再为其签发
+		rec, certPEM, err := ca.Enroll([]byte(req.CSR), req.Serial, "enroll:"+t.Name)
+		if err != nil {
+			auditEvent(c, "cert_enroll", req.Serial, "failure")
+			issueError(c, err)
+			return
+		}
+		auditEventMeta(c, "cert_enroll", req.Serial, "success", map[string]interface{}{
+			"certSerial": rec.Serial, "enrollmentToken": t.Name, "expiresAt": rec.NotAfter,
+		})
+		c.JSON(http.StatusCreated, certResponse(ca, rec, certPEM))
+	}
+}
+
+func hasScope(scopes []string, perm auth.Permission) bool {
+	for _, s := range scopes {
+		if s == string(perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// CertRenewHandler Agent 凭当前有效的客户端证书续期，新证书绑定相同的序列号
+// POST /api/certs/renew {"csr": "..."}
+func CertRenewHandler(ca *pki.CA) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cert := auth.ClientCertificate(c)
+		if cert == nil || !ca.Issued(cert) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "续期需要本 CA 签发的有效客户端证书"})
+			return
+		}
+		serial := cert.Subject.CommonName
+		var req CertRenewRequest
+		if err := c.BindJSON(&req); err != nil || req.CSR == "" {
+			auditEvent(c, "cert_renew", serial, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "csr 不能为空"})
+			return
+		}
+		rec, certPEM, err := ca.Issue([]byte(req.CSR), serial, "renew:"+cert.SerialNumber.Text(16))
+		if err != nil {
+			auditEvent(c, "cert_renew", serial, "failure")
+			issueError(c, err)
+			return
+		}
+		auditEventMeta(c, "cert_renew", serial, "success", map[string]interface{}{
+			"certSerial": rec.Serial, "previous": cert.SerialNumber.Text(16), "expiresAt": rec.NotAfter,
+		})
+		c.JSON(http.StatusCreated, certResponse(ca, rec, certPEM))
+	}
+}
+
+func ListCertificatesHandler(store database.CertificateStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := store.ListCertificates()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询证书失败"})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// RevokeCertificateHandler 吊销证书，:serial 为证书序列号（十六进制），不是服务器序列号
+// POST /api/certs/:serial/revoke
+func RevokeCertificateHandler(ca *pki.CA) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serial := c.Param("serial")
+		rec, err := ca.Revoke(serial)
+		if err != nil {
+			auditEvent(c, "revoke_cert", serial, "failure")
+			if errors.Is(err, database.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "未找到证书"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "吊销证书失败"})
+			return
+		}
+		auditEventMeta(c, "revoke_cert", serial, "success", map[string]interface{}{"commonName": rec.CommonName})
+		c.JSON(http.StatusOK, gin.H{"message": "证书已吊销", "certificate": rec})
+	}
+}
+
+// CACertificateHandler 返回 PEM 编码的根证书
+// GET /api/ca.pem
+func CACertificateHandler(ca *pki.CA) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/x-pem-file", ca.CertificatePEM())
+	}
+}
+
+// CRLHandler 返回 DER 编码的证书吊销列表
+// GET /api/ca.crl
+func CRLHandler(ca *pki.CA) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		crl, err := ca.CRL()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成 CRL 失败"})
+			return
+		}
+		c.Data(http.StatusOK, "application/pkix-crl", crl)
+	}
+}
@@ -1,7 +1,9 @@
 package api
 
 import (
-	"database/sql"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 
@@ -9,6 +11,7 @@ import (
 	"pxe-manager/database"
 	"pxe-manager/pxe"
 	"pxe-manager/audit"
+	"pxe-manager/auth"
 
 	"github.com/gin-gonic/gin"
 )
@@ -39,6 +42,11 @@ type ServerReportRequest struct {
 
 // auditEvent 将动作级别的审计事件写入日志（若可用）
 func auditEvent(c *gin.Context, action, target, status string) {
+	auditEventMeta(c, action, target, status, nil)
+}
+
+// auditEventMeta 同 auditEvent，并附带结构化的变更详情
+func auditEventMeta(c *gin.Context, action, target, status string, meta map[string]interface{}) {
 	v, ok := c.Get("auditLogger")
 	if !ok || v == nil {
 		return
@@ -49,16 +57,46 @@ func auditEvent(c *gin.Context, action, target, status string) {
 	}
 	_ = logger.LogEvent(audit.AuditLog{
 		ClientIP:  c.ClientIP(),
+		Actor:     principalName(c),
 		UserAgent: c.GetHeader("User-Agent"),
 		Method:    c.Request.Method,
 		Path:      c.Request.URL.Path,
 		Action:    action,
 		Target:    target,
 		Status:    status,
+		Metadata:  meta,
 	})
 }
 
-func ReportHandler(db *sql.DB) gin.HandlerFunc {
+// principalName 返回当前主体的名称（用户名、API 密钥名、证书 CN 等），未认证时为空
+func principalName(c *gin.Context) string {
+	if p := auth.CurrentPrincipal(c); p != nil {
+		return p.Name
+	}
+	return ""
+}
+
+// actorOf 返回当前请求的操作者标识，用于状态历史与记录创建者；未认证时退化为客户端 IP
+func actorOf(c *gin.Context) string {
+	if name := principalName(c); name != "" {
+		return name
+	}
+	return c.ClientIP()
+}
+
+// respondTransitionError 将状态迁移错误映射为 HTTP 状态码
+func respondTransitionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到服务器"})
+	case errors.Is(err, database.ErrIllegalTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "状态更新失败"})
+	}
+}
+
+func ReportHandler(servers database.ServerStore, idem database.IdempotencyStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req ServerReportRequest
 		if err := c.BindJSON(&req); err != nil {
@@ -71,9 +109,28 @@ func ReportHandler(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "缺少必填字段(serial/macAddress/requestId)"})
 			return
 		}
-		_, err := db.Exec(`INSERT INTO processed_requests(serial, request_id) VALUES(?,?)`, req.Serial, req.RequestID)
+		// 主机名、网卡、IP 与网关会拼接进 Kickstart/Preseed 的选项，上报时即拒绝非法格式
+		fields := &database.Server{Hostname: req.Hostname, LanNic: req.LanNic, IPAddress: req.IPAddress, Gateway: req.Gateway}
+		if err := pxe.ValidateServerFields(fields); err != nil {
+			auditEvent(c, "report", req.Serial, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !auth.CertAllowsSerial(c, req.Serial) {
+			auditEventMeta(c, "report", req.Serial, "failure", map[string]interface{}{
+				"certSerials": auth.CertSerials(auth.ClientCertificate(c)),
+			})
+			c.JSON(http.StatusForbidden, gin.H{"error": "客户端证书与上报的序列号不匹配"})
+			return
+		}
+		first, err := idem.MarkProcessed(req.Serial, req.RequestID)
 		if err != nil {
-			// 如果主键冲突，视为已处理
+			auditEvent(c, "report", req.Serial, "failure")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存数据失败"})
+			return
+		}
+		if !first {
+			// 相同 requestId 已处理过
 			auditEvent(c, "report", req.Serial, "duplicate")
 			c.JSON(http.StatusOK, gin.H{"status": "success", "message": "重复请求，已忽略"})
 			return
@@ -100,9 +157,9 @@ func ReportHandler(db *sql.DB) gin.HandlerFunc {
 			WanNicSpeed:   req.WanNicSpeed,
 			BondNic:       req.BondNic,
 			BondNicSpeed:  req.BondNicSpeed,
-			Status:        "pending",
+			Status:        database.StatusPending,
 		}
-		if err := database.SaveServer(db, s); err != nil {
+		if err := servers.SaveServer(s, actorOf(c)); err != nil {
 			auditEvent(c, "report", req.Serial, "failure")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存数据失败"})
 			return
@@ -112,24 +169,30 @@ func ReportHandler(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
-func ListServersHandler(db *sql.DB) gin.HandlerFunc {
+func ListServersHandler(servers database.ServerStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		status := c.Query("status")
-		servers, err := database.ListServers(db, status)
+		q, err := parseServerQuery(c)
+		if err != nil {
+			auditEvent(c, "list_servers", status, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		page, err := servers.ListServers(q)
 		if err != nil {
 			auditEvent(c, "list_servers", status, "failure")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
 			return
 		}
 		auditEvent(c, "list_servers", status, "success")
-		c.JSON(http.StatusOK, servers)
+		c.JSON(http.StatusOK, page)
 	}
 }
 
-func GetServerHandler(db *sql.DB) gin.HandlerFunc {
+func GetServerHandler(servers database.ServerStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		serial := c.Param("serial")
-		s, err := database.GetServerBySerial(db, serial)
+		s, err := servers.GetServerBySerial(serial)
 		if err != nil {
 			auditEvent(c, "get_server", serial, "failure")
 			c.JSON(http.StatusNotFound, gin.H{"error": "未找到服务器"})
@@ -140,12 +203,12 @@ func GetServerHandler(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
-func ConfirmServerHandler(db *sql.DB) gin.HandlerFunc {
+func ConfirmServerHandler(servers database.ServerStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		serial := c.Param("serial")
-		if err := database.MarkServerConfirmed(db, serial); err != nil {
+		if _, err := servers.TransitionServer(serial, database.StatusConfirmed, actorOf(c), "管理员确认"); err != nil {
 			auditEvent(c, "confirm_server", serial, "failure")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "确认失败"})
+			respondTransitionError(c, err)
 			return
 		}
 		auditEvent(c, "confirm_server", serial, "success")
@@ -153,12 +216,12 @@ func ConfirmServerHandler(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
-func MarkInstalledHandler(db *sql.DB) gin.HandlerFunc {
+func MarkInstalledHandler(servers database.ServerStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		serial := c.Param("serial")
-		if err := database.MarkServerInstalled(db, serial); err != nil {
+		if _, err := servers.TransitionServer(serial, database.StatusInstalled, actorOf(c), "标记安装完成"); err != nil {
 			auditEvent(c, "mark_installed", serial, "failure")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "标记失败"})
+			respondTransitionError(c, err)
 			return
 		}
 		auditEvent(c, "mark_installed", serial, "success")
@@ -166,9 +229,53 @@ func MarkInstalledHandler(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
-func ListConfigsHandler(db *sql.DB) gin.HandlerFunc {
+type TransitionRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// TransitionServerHandler 通用状态迁移入口
+// POST /api/servers/:serial/transition {"status":"installing","reason":"..."}
+func TransitionServerHandler(servers database.ServerStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serial := c.Param("serial")
+		var req TransitionRequest
+		if err := c.BindJSON(&req); err != nil || !database.IsValidStatus(req.Status) {
+			auditEvent(c, "transition_server", serial, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的目标状态"})
+			return
+		}
+		s, err := servers.TransitionServer(serial, req.Status, actorOf(c), req.Reason)
+		if err != nil {
+			auditEvent(c, "transition_server", serial, "failure")
+			respondTransitionError(c, err)
+			return
+		}
+		auditEvent(c, "transition_server", serial, "success")
+		c.JSON(http.StatusOK, s)
+	}
+}
+
+// ServerHistoryHandler GET /api/servers/:serial/history
+func ServerHistoryHandler(servers database.ServerStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		configs, err := database.ListConfigs(db)
+		serial := c.Param("serial")
+		if _, err := servers.GetServerBySerial(serial); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "未找到服务器"})
+			return
+		}
+		history, err := servers.ListServerHistory(serial)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+			return
+		}
+		c.JSON(http.StatusOK, history)
+	}
+}
+
+func ListConfigsHandler(templates database.TemplateStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		configs, err := templates.ListConfigs()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
 			return
@@ -177,11 +284,11 @@ func ListConfigsHandler(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
-func GetConfigHandler(db *sql.DB) gin.HandlerFunc {
+func GetConfigHandler(templates database.TemplateStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idStr := c.Param("id")
 		id, _ := strconv.Atoi(idStr)
-		cfg, err := database.GetConfig(db, id)
+		cfg, err := templates.GetConfig(id)
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "未找到配置"})
 			return
@@ -198,9 +305,13 @@ type CreateConfigRequest struct {
 	ConfigContent string `json:"configContent"`
 	KernelParams  string `json:"kernelParams"`
 	Packages      string `json:"packages"`
+	// Variables 为模板变量定义，见 database.TemplateVariable
+	Variables []database.TemplateVariable `json:"variables"`
+	// Comment 为本次修改的说明，记录在修订版本中
+	Comment string `json:"comment"`
 }
 
-func CreateConfigHandler(db *sql.DB) gin.HandlerFunc {
+func CreateConfigHandler(templates database.TemplateStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req CreateConfigRequest
 		if err := c.BindJSON(&req); err != nil {
@@ -208,6 +319,17 @@ func CreateConfigHandler(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
 			return
 		}
+		if err := pxe.ParseTemplate(req.ConfigContent); err != nil {
+			auditEvent(c, "create_config", req.Name, "failure")
+			respondRenderError(c, http.StatusBadRequest, err)
+			return
+		}
+		vars, err := pxe.NormalizeVariables(req.Variables)
+		if err != nil {
+			auditEvent(c, "create_config", req.Name, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		ct := &database.ConfigTemplate{
 			Name:          req.Name,
 			Description:   req.Description,
@@ -217,8 +339,9 @@ func CreateConfigHandler(db *sql.DB) gin.HandlerFunc {
 			KernelParams:  req.KernelParams,
 			Packages:      req.Packages,
 			Status:        "active",
+			Variables:     vars,
 		}
-		id, err := database.CreateConfig(db, ct)
+		id, err := templates.CreateConfig(ct, actorOf(c), req.Comment)
 		if err != nil {
 			auditEvent(c, "create_config", ct.Name, "failure")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
@@ -229,7 +352,7 @@ func CreateConfigHandler(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
-func UpdateConfigHandler(db *sql.DB) gin.HandlerFunc {
+func UpdateConfigHandler(templates database.TemplateStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idStr := c.Param("id")
 		id, _ := strconv.Atoi(idStr)
@@ -239,6 +362,17 @@ func UpdateConfigHandler(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
 			return
 		}
+		if err := pxe.ParseTemplate(req.ConfigContent); err != nil {
+			auditEvent(c, "update_config", idStr, "failure")
+			respondRenderError(c, http.StatusBadRequest, err)
+			return
+		}
+		vars, err := pxe.NormalizeVariables(req.Variables)
+		if err != nil {
+			auditEvent(c, "update_config", idStr, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		ct := &database.ConfigTemplate{
 			Name:          req.Name,
 			Description:   req.Description,
@@ -248,18 +382,86 @@ func UpdateConfigHandler(db *sql.DB) gin.HandlerFunc {
 			KernelParams:  req.KernelParams,
 			Packages:      req.Packages,
 			Status:        "active",
+			Variables:     vars,
 		}
-		if err := database.UpdateConfig(db, id, ct); err != nil {
+		rev, err := templates.UpdateConfig(id, ct, actorOf(c), req.Comment)
+		if err != nil {
 			auditEvent(c, "update_config", idStr, "failure")
+			if errors.Is(err, database.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "未找到配置"})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
 			return
 		}
-		auditEvent(c, "update_config", idStr, "success")
-		c.Status(http.StatusOK)
+		auditEventMeta(c, "update_config", idStr, "success", map[string]interface{}{"revision": rev})
+		c.JSON(http.StatusOK, gin.H{"revision": rev})
 	}
 }
 
-func ApplyConfigHandler(db *sql.DB, cfg *config.Config) gin.HandlerFunc {
+// respondRenderError 返回模板错误及其所在片段与行号
+func respondRenderError(c *gin.Context, status int, err error) {
+	resp := gin.H{"error": err.Error()}
+	var renderErr *pxe.RenderError
+	if errors.As(err, &renderErr) && renderErr.Snippet != "" {
+		resp["snippet"] = renderErr.Snippet
+	}
+	if renderErr != nil && renderErr.Line > 0 {
+		resp["line"] = renderErr.Line
+		if renderErr.Column > 0 {
+			resp["column"] = renderErr.Column
+		}
+	}
+	c.JSON(status, resp)
+}
+
+// respondUnresolved 返回未解析的必填变量与取值不合法的变量
+func respondUnresolved(c *gin.Context, res *pxe.Resolution) {
+	resp := gin.H{"error": "模板变量未解析", "missing": res.Missing}
+	if len(res.Invalid) > 0 {
+		resp["invalid"] = res.Invalid
+	}
+	c.JSON(http.StatusUnprocessableEntity, resp)
+}
+
+// newGenerator 按配置创建 PXE 配置生成器，模板中的 include 从 snippets 读取
+func newGenerator(cfg *config.Config, snippets database.SnippetStore) *pxe.Generator {
+	g := &pxe.Generator{TFTPRoot: cfg.TFTP.Root, PXEConfig: pxe.DefaultPXEConfig(), Settings: provisionSettings(cfg), Snippets: snippetLookup(snippets)}
+	if cfg.TFTP.EnableUEFI {
+		g.PXEConfig.EnableUEFI = true
+	}
+	return g
+}
+
+// provisionSettings 将配置转换为渲染参数，未配置的项使用默认值
+func provisionSettings(cfg *config.Config) pxe.Settings {
+	p := cfg.Provision
+	s := pxe.DefaultSettings()
+	s.MirrorURL, s.RootPasswordHash = p.MirrorURL, p.RootPasswordHash
+	if p.Timezone != "" {
+		s.Timezone = p.Timezone
+	}
+	if p.Locale != "" {
+		s.Locale = p.Locale
+	}
+	if p.Keyboard != "" {
+		s.Keyboard = p.Keyboard
+	}
+	return s
+}
+
+// revertApply 在应用失败时把服务器恢复到应用前的状态；恢复失败只记录日志
+func revertApply(c *gin.Context, servers database.ServerStore, serial, prev string, transitioned bool) {
+	if !transitioned {
+		return
+	}
+	if err := servers.RevertTransition(serial, database.StatusProvisioning, prev, actorOf(c), "应用配置失败，恢复原状态"); err != nil {
+		log.Printf("恢复服务器 %s 状态失败: %v", serial, err)
+	}
+}
+
+// ApplyConfigHandler 解析模板变量并生成 PXE 配置；存在未解析的必填变量或取值不合法时拒绝并列出变量名
+func ApplyConfigHandler(servers database.ServerStore, templates database.TemplateStore, variables database.VariableStore, snippets database.SnippetStore, cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idStr := c.Param("id")
 		id, _ := strconv.Atoi(idStr)
@@ -270,29 +472,71 @@ func ApplyConfigHandler(db *sql.DB, cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 		// 获取服务器与配置
-		server, err := database.GetServerBySerial(db, serial)
+		server, err := servers.GetServerBySerial(serial)
 		if err != nil {
 			auditEvent(c, "apply_config", serial, "failure")
 			c.JSON(http.StatusNotFound, gin.H{"error": "未找到服务器"})
 			return
 		}
-		conf, err := database.GetConfig(db, id)
+		conf, err := templates.GetConfig(id)
 		if err != nil {
 			auditEvent(c, "apply_config", idStr, "failure")
 			c.JSON(http.StatusNotFound, gin.H{"error": "未找到配置"})
 			return
 		}
-		g := &pxe.Generator{TFTPRoot: cfg.TFTP.Root, PXEConfig: pxe.DefaultPXEConfig()}
-		if cfg.TFTP.EnableUEFI {
-			g.PXEConfig.EnableUEFI = true
+		// 重复应用时服务器已处于 provisioning，无需再次迁移
+		needTransition := server.Status != database.StatusProvisioning
+		if needTransition && !database.CanTransition(server.Status, database.StatusProvisioning) {
+			auditEvent(c, "apply_config", serial, "failure")
+			respondTransitionError(c, &database.TransitionError{From: server.Status, To: database.StatusProvisioning})
+			return
+		}
+		res, err := resolveVariables(variables, conf, server)
+		if err != nil {
+			auditEvent(c, "apply_config", serial, "failure")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询变量失败"})
+			return
+		}
+		if !res.OK() {
+			auditEventMeta(c, "apply_config", serial, "failure", map[string]interface{}{"missing": res.Missing, "invalid": res.Invalid})
+			respondUnresolved(c, res)
+			return
 		}
-		if err := g.GenerateConfig(server, conf); err != nil {
+		// 先渲染（不写磁盘），模板错误不影响服务器状态
+		out, err := newGenerator(cfg, snippets).Render(server, conf, res.Values)
+		if err != nil {
 			auditEvent(c, "apply_config", serial, "failure")
+			var renderErr *pxe.RenderError
+			if errors.As(err, &renderErr) || errors.Is(err, pxe.ErrInvalidServerField) {
+				respondRenderError(c, http.StatusUnprocessableEntity, err)
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成PXE配置失败"})
 			return
 		}
-		auditEvent(c, "apply_config", serial, "success")
-		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "配置已应用到服务器"})
+		// 迁移成功后再写入文件，避免并发修改状态时 TFTP 目录已被覆盖
+		if needTransition {
+			reason := fmt.Sprintf("应用配置模板 %d（版本 %d）", conf.ID, conf.Revision)
+			if _, err := servers.TransitionServer(serial, database.StatusProvisioning, actorOf(c), reason); err != nil {
+				auditEvent(c, "apply_config", serial, "failure")
+				respondTransitionError(c, err)
+				return
+			}
+		}
+		if err := pxe.WriteFiles(out); err != nil {
+			revertApply(c, servers, serial, server.Status, needTransition)
+			auditEvent(c, "apply_config", serial, "failure")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "写入PXE配置失败"})
+			return
+		}
+		if err := servers.SetServerTemplate(serial, conf.ID, conf.Revision); err != nil {
+			revertApply(c, servers, serial, server.Status, needTransition)
+			auditEvent(c, "apply_config", serial, "failure")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "记录模板版本失败"})
+			return
+		}
+		auditEventMeta(c, "apply_config", serial, "success", map[string]interface{}{"template": conf.ID, "revision": conf.Revision})
+		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "配置已应用到服务器", "revision": conf.Revision})
 	}
 }
 
\ No newline at end of file
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"pxe-manager/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseServerQuery 解析 GET /api/servers 的查询参数
+//
+//	page/pageSize            分页（pageSize 最大 500）
+//	sort/order               排序列（如 hostname、createdAt）与方向 asc/desc
+//	status                   状态精确匹配
+//	hostname/serial          前缀匹配
+//	mac                      精确匹配（忽略大小写）
+//	ip                       IP 或 CIDR，如 192.168.88.0/24
+//	cpuModel                 包含匹配
+//	memMin/memMax            内存范围（mem_total）
+//	systemVersion            精确匹配
+//	createdFrom/createdTo    创建时间范围（RFC3339 或 2006-01-02[ 15:04:05]）
+//	updatedFrom/updatedTo    更新时间范围
+func parseServerQuery(c *gin.Context) (database.ServerQuery, error) {
+	q := database.ServerQuery{
+		Status:         c.Query("status"),
+		HostnamePrefix: c.Query("hostname"),
+		SerialPrefix:   c.Query("serial"),
+		MAC:            c.Query("mac"),
+		CPUModel:       c.Query("cpuModel"),
+		SystemVersion:  c.Query("systemVersion"),
+		Desc:           strings.EqualFold(c.Query("order"), "desc"),
+	}
+	var err error
+	if q.Page, err = intParam(c, "page"); err != nil {
+		return q, err
+	}
+	if q.PageSize, err = intParam(c, "pageSize"); err != nil {
+		return q, err
+	}
+	if s := c.Query("sort"); s != "" {
+		if _, ok := database.SortColumn(s); !ok {
+			return q, fmt.Errorf("不支持的排序字段: %s", s)
+		}
+		q.Sort = s
+	}
+	if v := c.Query("ip"); v != "" {
+		if q.IPPrefix, err = parsePrefix(v); err != nil {
+			return q, err
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  **int
+	}{{"memMin", &q.MemMin}, {"memMax", &q.MemMax}} {
+		if v := c.Query(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return q, fmt.Errorf("参数 %s 不是整数", p.name)
+			}
+			*p.dst = &n
+		}
+	}
+	for _, p := range []struct {
+		name string
+		end  bool
+		dst  *string
+	}{
+		{"createdFrom", false, &q.CreatedFrom}, {"createdTo", true, &q.CreatedTo},
+		{"updatedFrom", false, &q.UpdatedFrom}, {"updatedTo", true, &q.UpdatedTo},
+	} {
+		if v := c.Query(p.name); v != "" {
+			if *p.dst, err = parseTimeBound(v, p.end); err != nil {
+				return q, fmt.Errorf("参数 %s 时间格式无效", p.name)
+			}
+		}
+	}
+	return q, nil
+}
+
+func intParam(c *gin.Context, name string) (int, error) {
+	v := c.Query(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("参数 %s 不是有效的非负整数", name)
+	}
+	return n, nil
+}
+
+// parsePrefix 接受 CIDR 或单个 IP（视为 /32 或 /128）
+func parsePrefix(v string) (netip.Prefix, error) {
+	if strings.Contains(v, "/") {
+		p, err := netip.ParsePrefix(v)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("无效的网段: %s", v)
+		}
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(v)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("无效的 IP: %s", v)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// parseTimeBound 将时间参数规范化为 UTC "2006-01-02 15:04:05"；
+// 仅给出日期且作为上界时取当天 23:59:59
+func parseTimeBound(v string, end bool) (string, error) {
+	const layout = "2006-01-02 15:04:05"
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.UTC().Format(layout), nil
+	}
+	if t, err := time.Parse(layout, v); err == nil {
+		return t.Format(layout), nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return "", err
+	}
+	if end {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t.Format(layout), nil
+}
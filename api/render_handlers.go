@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"pxe-manager/config"
+	"pxe-manager/database"
+	"pxe-manager/pxe"
+	"pxe-manager/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 预览文件与 TFTP 目录中现有文件的比较结果
+const (
+	DiskMissing    = "missing"    // 磁盘上尚无该文件
+	DiskUnchanged  = "unchanged"  // 内容相同
+	DiskChanged    = "changed"    // 内容不同，Diff 为磁盘 → 预览的差异
+	DiskUnreadable = "unreadable" // 文件存在但无法读取
+)
+
+// RenderedFile 为预览中的文件及其与磁盘上现有文件的比较
+type RenderedFile struct {
+	pxe.GeneratedFile
+	Disk string `json:"disk"`
+	Diff string `json:"diff,omitempty"`
+}
+
+// compareWithDisk 读取 TFTP 目录中的现有文件并与预览内容比较，只读不写
+func compareWithDisk(root string, f pxe.GeneratedFile) RenderedFile {
+	rf := RenderedFile{GeneratedFile: f}
+	name := f.Path
+	if rel, err := filepath.Rel(root, f.Path); err == nil {
+		name = filepath.ToSlash(rel)
+	}
+	current, err := os.ReadFile(f.Path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		rf.Disk = DiskMissing
+	case err != nil:
+		rf.Disk = DiskUnreadable
+	case string(current) == f.Content:
+		rf.Disk = DiskUnchanged
+	default:
+		rf.Disk = DiskChanged
+		rf.Diff = utils.UnifiedDiff("a/"+name, "b/"+name, string(current), f.Content, diffContext)
+	}
+	return rf
+}
+
+// RenderConfigHandler 预览模板在服务器上的渲染结果与将写入的文件，不修改磁盘与服务器状态；
+// rev 指定历史版本（默认当前版本），每个文件附带与 TFTP 目录中现有文件的差异。
+// 渲染结果含 root 密码哈希等敏感内容，需要 configs:apply 权限
+// GET /api/configs/:id/render?serial=SN123&rev=2
+func RenderConfigHandler(servers database.ServerStore, templates database.TemplateStore, variables database.VariableStore, snippets database.SnippetStore, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conf := getConfig(c, templates)
+		if conf == nil {
+			return
+		}
+		if revStr := c.Query("rev"); revStr != "" {
+			r := getRevision(c, templates, conf.ID, revStr)
+			if r == nil {
+				return
+			}
+			conf = &r.Template
+		}
+		serial := c.Query("serial")
+		if serial == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 serial"})
+			return
+		}
+		server, err := servers.GetServerBySerial(serial)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "未找到服务器"})
+			return
+		}
+		res, err := resolveVariables(variables, conf, server)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询变量失败"})
+			return
+		}
+		if !res.OK() {
+			respondUnresolved(c, res)
+			return
+		}
+		g := newGenerator(cfg, snippets)
+		out, err := g.Render(server, conf, res.Values)
+		if err != nil {
+			// 模板错误、MAC 地址无效或系统类型不支持，均为应用时会失败的原因
+			respondRenderError(c, http.StatusUnprocessableEntity, err)
+			return
+		}
+		files := make([]RenderedFile, 0, len(out.Files))
+		for _, f := range out.Files {
+			files = append(files, compareWithDisk(g.TFTPRoot, f))
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"template":  conf.ID,
+			"revision":  conf.Revision,
+			"serial":    server.Serial,
+			"format":    out.Format,
+			"content":   out.Content,
+			"files":     files,
+			"variables": res,
+		})
+	}
+}
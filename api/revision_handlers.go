@@ -0,0 +1,217 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pxe-manager/database"
+	"pxe-manager/pxe"
+	"pxe-manager/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// diffContext 为差异中每处修改前后保留的上下文行数
+const diffContext = 3
+
+// RevisionSummary 为修订版本列表项，不含模板内容
+type RevisionSummary struct {
+	Revision  int    `json:"revision"`
+	Author    string `json:"author"`
+	Comment   string `json:"comment"`
+	CreatedAt string `json:"createdAt"`
+	Current   bool   `json:"current"`
+}
+
+// getConfig 按路由参数读取模板，失败时已写入响应
+func getConfig(c *gin.Context, templates database.TemplateStore) *database.ConfigTemplate {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的配置ID"})
+		return nil
+	}
+	conf, err := templates.GetConfig(id)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到配置"})
+		return nil
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询配置失败"})
+		return nil
+	}
+	return conf
+}
+
+// getRevision 读取模板的指定版本，失败时已写入响应
+func getRevision(c *gin.Context, templates database.TemplateStore, id int, revStr string) *database.TemplateRevision {
+	rev, err := strconv.Atoi(revStr)
+	if err != nil || rev <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的版本号: " + revStr})
+		return nil
+	}
+	r, err := templates.GetConfigRevision(id, rev)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("未找到版本 %d", rev)})
+		return nil
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询版本失败"})
+		return nil
+	}
+	return r
+}
+
+// ListConfigRevisionsHandler 按版本号升序列出模板的修订历史
+// GET /api/configs/:id/revisions
+func ListConfigRevisionsHandler(templates database.TemplateStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conf := getConfig(c, templates)
+		if conf == nil {
+			return
+		}
+		list, err := templates.ListConfigRevisions(conf.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询版本失败"})
+			return
+		}
+		res := make([]RevisionSummary, 0, len(list))
+		for _, r := range list {
+			res = append(res, RevisionSummary{
+				Revision: r.Revision, Author: r.Author, Comment: r.Comment, CreatedAt: r.CreatedAt,
+				Current: r.Revision == conf.Revision,
+			})
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// GetConfigRevisionHandler 返回模板某个版本的完整内容
+// GET /api/configs/:id/revisions/:rev
+func GetConfigRevisionHandler(templates database.TemplateStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conf := getConfig(c, templates)
+		if conf == nil {
+			return
+		}
+		if r := getRevision(c, templates, conf.ID, c.Param("rev")); r != nil {
+			c.JSON(http.StatusOK, r)
+		}
+	}
+}
+
+// revisionFields 返回参与比较的字段（名称 → 文本），变量定义以缩进 JSON 比较
+func revisionFields(t *database.ConfigTemplate) [][2]string {
+	vars, _ := json.MarshalIndent(t.Variables, "", "  ")
+	if len(t.Variables) == 0 {
+		vars = nil
+	}
+	return [][2]string{
+		{"name", t.Name},
+		{"description", t.Description},
+		{"systemType", t.SystemType},
+		{"systemVersion", t.SystemVersion},
+		{"configContent", t.ConfigContent},
+		{"kernelParams", t.KernelParams},
+		{"packages", t.Packages},
+		{"variables", string(vars)},
+	}
+}
+
+// diffRevisions 逐字段生成 unified diff，返回合并后的差异与有变化的字段
+func diffRevisions(from, to *database.TemplateRevision) (string, []string) {
+	a, b := revisionFields(&from.Template), revisionFields(&to.Template)
+	var sb strings.Builder
+	changed := []string{}
+	for i := range a {
+		d := utils.UnifiedDiff(
+			fmt.Sprintf("r%d/%s", from.Revision, a[i][0]),
+			fmt.Sprintf("r%d/%s", to.Revision, b[i][0]),
+			a[i][1], b[i][1], diffContext,
+		)
+		if d != "" {
+			changed = append(changed, a[i][0])
+			sb.WriteString(d)
+		}
+	}
+	return sb.String(), changed
+}
+
+// ConfigDiffHandler 返回模板两个版本之间的 unified diff；
+// 默认 to 为当前版本、from 为 to 的上一版本，format=text 时直接返回差异文本
+// GET /api/configs/:id/diff?from=1&to=3
+func ConfigDiffHandler(templates database.TemplateStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conf := getConfig(c, templates)
+		if conf == nil {
+			return
+		}
+		toStr := c.DefaultQuery("to", strconv.Itoa(conf.Revision))
+		to := getRevision(c, templates, conf.ID, toStr)
+		if to == nil {
+			return
+		}
+		if to.Revision == 1 && c.Query("from") == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "版本 1 没有上一版本，请指定 from"})
+			return
+		}
+		from := getRevision(c, templates, conf.ID, c.DefaultQuery("from", strconv.Itoa(to.Revision-1)))
+		if from == nil {
+			return
+		}
+		diff, changed := diffRevisions(from, to)
+		if c.Query("format") == "text" {
+			c.Data(http.StatusOK, "text/x-diff; charset=utf-8", []byte(diff))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"from": from.Revision, "to": to.Revision, "changed": changed, "diff": diff})
+	}
+}
+
+// RollbackConfigHandler 以指定版本的内容创建新版本，历史版本保持不变
+// POST /api/configs/:id/rollback?rev=2 {"comment": "..."}
+func RollbackConfigHandler(templates database.TemplateStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conf := getConfig(c, templates)
+		if conf == nil {
+			return
+		}
+		idStr := strconv.Itoa(conf.ID)
+		r := getRevision(c, templates, conf.ID, c.Query("rev"))
+		if r == nil {
+			auditEvent(c, "rollback_config", idStr, "failure")
+			return
+		}
+		if r.Revision == conf.Revision {
+			auditEvent(c, "rollback_config", idStr, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("版本 %d 已是当前版本", r.Revision)})
+			return
+		}
+		var req struct {
+			Comment string `json:"comment"`
+		}
+		// 请求体可省略
+		_ = c.ShouldBindJSON(&req)
+		comment := fmt.Sprintf("回滚到版本 %d", r.Revision)
+		if req.Comment != "" {
+			comment += ": " + req.Comment
+		}
+		// 回滚前的版本可能早于后来的语法校验，仍需检查
+		if err := pxe.ParseTemplate(r.Template.ConfigContent); err != nil {
+			auditEvent(c, "rollback_config", idStr, "failure")
+			respondRenderError(c, http.StatusUnprocessableEntity, err)
+			return
+		}
+		rev, err := templates.UpdateConfig(conf.ID, &r.Template, actorOf(c), comment)
+		if err != nil {
+			auditEvent(c, "rollback_config", idStr, "failure")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "回滚失败"})
+			return
+		}
+		auditEventMeta(c, "rollback_config", idStr, "success", map[string]interface{}{"from": conf.Revision, "to": r.Revision, "revision": rev})
+		c.JSON(http.StatusOK, gin.H{"revision": rev, "rolledBackTo": r.Revision})
+	}
+}
@@ -2,34 +2,67 @@ package api
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"pxe-manager/audit"
 	"pxe-manager/auth"
 	"pxe-manager/config"
+	"pxe-manager/database"
+	"pxe-manager/pki"
+	"pxe-manager/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRouter(db *sql.DB, cfg *config.Config) *gin.Engine {
+// Stores 汇总路由所依赖的存储接口
+type Stores struct {
+	Servers     database.ServerStore
+	Templates   database.TemplateStore
+	Idempotency database.IdempotencyStore
+	Users       database.UserStore
+	APIKeys     database.APIKeyStore
+	Certs       database.CertificateStore
+	Variables   database.VariableStore
+	Snippets    database.SnippetStore
+}
+
+// SetupRouter 注册全部路由；ca 为 nil 表示未启用内置 CA
+func SetupRouter(stores Stores, auditLogger *audit.AuditLogger, cfg *config.Config, ca *pki.CA) *gin.Engine {
+	production, development := false, false
+	switch cfg.Mode {
+	case "":
+	case "development":
+		development = true
+	case "production":
+		production = true
+		gin.SetMode(gin.ReleaseMode)
+	default:
+		log.Printf("mode 配置无效，按未指定处理: %s", cfg.Mode)
+	}
 	r := gin.Default()
 
-	// 反向代理信任列表（以确保正确获取 ClientIP）
-	if err := r.SetTrustedProxies([]string{"127.0.0.1/32", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}); err != nil {
-		log.Printf("配置 TrustedProxies 失败: %v", err)
+	// 只采信可信反向代理转发的 X-Forwarded-For，否则任何主机都可伪造来源 IP 进入白名单
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Printf("trusted_proxies 配置无效，不信任任何代理: %v", err)
+		_ = r.SetTrustedProxies(nil)
 	}
 
-	// 开发环境 CORS，允许从 8000 静态预览访问 8080 API
-	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE,OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+	// 跨域：配置了 allowed_origins 时按白名单处理；否则仅显式指定的开发模式使用宽松的开发策略，
+	// 未配置 mode 的部署不返回任何 CORS 头
+	switch {
+	case len(cfg.CORS.AllowedOrigins) > 0:
+		if cfg.CORS.AllowCredentials && contains(cfg.CORS.AllowedOrigins, "*") {
+			log.Printf("cors.allowed_origins 为 * 时不允许携带凭据，已忽略 allow_credentials")
+			cfg.CORS.AllowCredentials = false
 		}
-		c.Next()
-	})
+		r.Use(CORSMiddleware(cfg.CORS))
+	case development:
+		log.Printf("开发模式：CORS 允许任意来源访问 API")
+		r.Use(DevCORSMiddleware())
+	}
 
 	// 前端静态资源与模板（当使用 Go 服务时）
 	r.Static("/static", "./web/static")
@@ -38,47 +71,255 @@ func SetupRouter(db *sql.DB, cfg *config.Config) *gin.Engine {
 
 	sec := &auth.SecurityConfig{
 		AuthToken:    cfg.Auth.AuthToken,
-		WhitelistIPs: cfg.Auth.WhitelistIPs,
+		Whitelist:    whitelist(cfg),
 		EnableAudit:  cfg.Auth.EnableAudit,
 		AuditLogPath: cfg.Auth.AuditLogPath,
 		RateLimit:    cfg.Auth.RateLimit,
+		RateBurst:    cfg.Auth.RateBurst,
+		IPRateLimit:  cfg.Auth.IPRateLimit,
+		RouteLimits:  routeLimits(cfg),
+		TokenRoles:   configRoles("token_roles", cfg.Auth.TokenRoles),
 	}
 
-	// 限流中间件（白名单豁免）
-	r.Use(auth.RateLimitMiddleware(sec))
+	// 限流按主体计数，需在认证之后执行；未认证的接口按 IP 计数。
+	// 认证之前另有按 IP 的认证失败限额，防止暴力尝试凭据
+	limiter := auth.NewRateLimiter(sec)
 
-	// 审计日志中间件（全局）
-	var auditLogger *audit.AuditLogger
-	if sec.EnableAudit {
-		al, err := audit.NewAuditLogger(sec.AuditLogPath, true)
-		if err != nil {
-			log.Printf("初始化审计日志失败: %v", err)
-		} else {
-			auditLogger = al
-			r.Use(AuditRequestMiddleware(auditLogger))
-		}
+	// 审计日志中间件（全局）；auditLogger 为 nil 表示未启用
+	if auditLogger != nil {
+		r.Use(AuditRequestMiddleware(auditLogger))
 	}
 
+	sessions := auth.NewSessionManager(stores.Users, []byte(cfg.Auth.SessionSecret), sessionTTL(cfg))
+	// 生产模式通常由 HTTPS 反向代理终结 TLS，Cookie 同样需要 Secure
+	sessions.SetSecureCookies(production || cfg.TLS.CertFile != "")
+
+	keys := auth.NewAPIKeyManager(stores.APIKeys)
+	keys.SetEnrolledKeyTTL(parseTTL("enrolled_key_ttl", cfg.Auth.EnrolledKeyTTL, auth.DefaultEnrolledKeyTTL))
+
+	ldap := ldapAuthenticator(cfg)
+
+	// 登录与注册接口无需认证（仍受限流保护）
+	public := r.Group("/api", limiter.Middleware())
+	public.POST("/auth/login", LoginHandler(sessions, ldap, stores.Users))
+	public.POST("/enroll", EnrollHandler(keys))
+	if ca != nil {
+		public.POST("/certs/enroll", CertEnrollHandler(ca, keys))
+		public.GET("/ca.pem", CACertificateHandler(ca))
+		public.GET("/ca.crl", CRLHandler(ca))
+	}
+
+	// OIDC 单点登录（可选）
+	var oidc *auth.OIDCProvider
+	if o := cfg.Auth.OIDC; o.Enabled && (o.Issuer == "" || o.ClientID == "" || o.RedirectURL == "") {
+		log.Printf("oidc 已启用但缺少 issuer/client_id/redirect_url，已禁用单点登录")
+	} else if o.Enabled {
+		oidc = auth.NewOIDCProvider(cfg.Auth.OIDC)
+		public.GET("/auth/oidc/login", OIDCLoginHandler(oidc, sessions))
+		public.GET("/auth/oidc/callback", OIDCCallbackHandler(oidc, sessions, stores.Users))
+	}
+	public.GET("/auth/providers", AuthProvidersHandler(oidc, ldap))
+
 	apiGroup := r.Group("/api")
-	apiGroup.Use(auth.Middleware(sec))
+	apiGroup.Use(limiter.IPMiddleware(), auth.Middleware(sec, sessions, keys), limiter.Middleware(), auth.CSRFMiddleware(sessions))
 
 	// 健康检查
 	apiGroup.GET("/health", HealthHandler())
 
-	apiGroup.POST("/report", ReportHandler(db))
-	apiGroup.GET("/servers", ListServersHandler(db))
-	apiGroup.GET("/servers/:serial", GetServerHandler(db))
-	apiGroup.POST("/servers/:serial/confirm", ConfirmServerHandler(db))
-	apiGroup.POST("/servers/:serial/install", MarkInstalledHandler(db))
+	apiGroup.POST("/auth/logout", LogoutHandler(sessions))
+	apiGroup.POST("/auth/password", ChangePasswordHandler(sessions))
+	apiGroup.GET("/auth/whoami", WhoamiHandler())
+
+	// 每个路由声明所需权限
+	// 装机网络内的 Agent 可凭白名单上报，其余路由均需认证凭据
+	reportChain := []gin.HandlerFunc{auth.RequireOrWhitelisted(auth.PermReportWrite)}
+	if cfg.TLS.RequireAgentCert {
+		reportChain = append(reportChain, auth.RequireClientCert())
+	}
+	apiGroup.POST("/report", append(reportChain, ReportHandler(stores.Servers, stores.Idempotency))...)
+	apiGroup.GET("/servers", auth.Require(auth.PermServersRead), ListServersHandler(stores.Servers))
+	apiGroup.GET("/servers/:serial", auth.Require(auth.PermServersRead), GetServerHandler(stores.Servers))
+	apiGroup.POST("/servers/:serial/confirm", auth.Require(auth.PermServersWrite), ConfirmServerHandler(stores.Servers))
+	apiGroup.POST("/servers/:serial/install", auth.Require(auth.PermServersWrite), MarkInstalledHandler(stores.Servers))
+	apiGroup.POST("/servers/:serial/transition", auth.Require(auth.PermServersWrite), TransitionServerHandler(stores.Servers))
+	apiGroup.GET("/servers/:serial/history", auth.Require(auth.PermServersRead), ServerHistoryHandler(stores.Servers))
 
-	apiGroup.GET("/configs", ListConfigsHandler(db))
-	apiGroup.GET("/configs/:id", GetConfigHandler(db))
-	apiGroup.POST("/configs", CreateConfigHandler(db))
-	apiGroup.PUT("/configs/:id", UpdateConfigHandler(db))
-	apiGroup.POST("/configs/:id/apply", ApplyConfigHandler(db, cfg))
+	apiGroup.GET("/configs", auth.Require(auth.PermTemplatesRead), ListConfigsHandler(stores.Templates))
+	apiGroup.GET("/configs/:id", auth.Require(auth.PermTemplatesRead), GetConfigHandler(stores.Templates))
+	apiGroup.POST("/configs", auth.Require(auth.PermTemplatesWrite), CreateConfigHandler(stores.Templates))
+	apiGroup.PUT("/configs/:id", auth.Require(auth.PermTemplatesWrite), UpdateConfigHandler(stores.Templates))
+	apiGroup.POST("/configs/:id/apply", auth.Require(auth.PermConfigsApply), ApplyConfigHandler(stores.Servers, stores.Templates, stores.Variables, stores.Snippets, cfg))
+	// 预览包含完整的安装配置（含 root 密码哈希），与应用所需权限相同
+	apiGroup.GET("/configs/:id/render", auth.Require(auth.PermConfigsApply), RenderConfigHandler(stores.Servers, stores.Templates, stores.Variables, stores.Snippets, cfg))
+	apiGroup.GET("/configs/:id/revisions", auth.Require(auth.PermTemplatesRead), ListConfigRevisionsHandler(stores.Templates))
+	apiGroup.GET("/configs/:id/revisions/:rev", auth.Require(auth.PermTemplatesRead), GetConfigRevisionHandler(stores.Templates))
+	apiGroup.GET("/configs/:id/diff", auth.Require(auth.PermTemplatesRead), ConfigDiffHandler(stores.Templates))
+	apiGroup.POST("/configs/:id/rollback", auth.Require(auth.PermTemplatesWrite), RollbackConfigHandler(stores.Templates))
+	apiGroup.GET("/configs/:id/snippets", auth.Require(auth.PermTemplatesRead), ConfigSnippetsHandler(stores.Templates, stores.Snippets))
+
+	// 模板片段
+	apiGroup.GET("/snippets", auth.Require(auth.PermTemplatesRead), ListSnippetsHandler(stores.Snippets))
+	apiGroup.GET("/snippets/:id", auth.Require(auth.PermTemplatesRead), GetSnippetHandler(stores.Snippets))
+	apiGroup.GET("/snippets/:id/usage", auth.Require(auth.PermTemplatesRead), SnippetUsageHandler(stores.Templates, stores.Snippets))
+	apiGroup.POST("/snippets", auth.Require(auth.PermTemplatesWrite), CreateSnippetHandler(stores.Templates, stores.Snippets))
+	apiGroup.PUT("/snippets/:id", auth.Require(auth.PermTemplatesWrite), UpdateSnippetHandler(stores.Templates, stores.Snippets))
+	apiGroup.DELETE("/snippets/:id", auth.Require(auth.PermTemplatesWrite), DeleteSnippetHandler(stores.Templates, stores.Snippets))
+
+	// 模板变量的服务器/分组覆盖
+	apiGroup.GET("/variables", auth.Require(auth.PermTemplatesRead), ListVariablesHandler(stores.Variables))
+	apiGroup.PUT("/variables", auth.Require(auth.PermTemplatesWrite), SetVariableHandler(stores.Variables))
+	apiGroup.DELETE("/variables/:id", auth.Require(auth.PermTemplatesWrite), DeleteVariableHandler(stores.Variables))
+	apiGroup.GET("/servers/:serial/variables", auth.Require(auth.PermTemplatesRead), ServerVariablesHandler(stores.Servers, stores.Templates, stores.Variables))
 
 	// 审计日志查看
-	apiGroup.GET("/audit/logs", ListAuditLogsHandler(cfg))
+	apiGroup.GET("/audit/logs", auth.Require(auth.PermAuditRead), ListAuditLogsHandler(auditLogger))
+	apiGroup.GET("/audit/verify", auth.Require(auth.PermAuditRead), VerifyAuditLogHandler(auditLogger))
+
+	// 账号与角色管理
+	apiGroup.GET("/roles", auth.Require(auth.PermUsersManage), ListRolesHandler())
+	apiGroup.GET("/users", auth.Require(auth.PermUsersManage), ListUsersHandler(stores.Users))
+	apiGroup.POST("/users", auth.Require(auth.PermUsersManage), CreateUserHandler(stores.Users))
+	apiGroup.PUT("/users/:id/roles", auth.Require(auth.PermUsersManage), SetUserRolesHandler(stores.Users))
+
+	// API 密钥与注册令牌
+	apiGroup.GET("/keys", auth.Require(auth.PermKeysManage), ListAPIKeysHandler(stores.APIKeys))
+	apiGroup.POST("/keys", auth.Require(auth.PermKeysManage), CreateAPIKeyHandler(keys))
+	apiGroup.POST("/keys/:id/revoke", auth.Require(auth.PermKeysManage), RevokeAPIKeyHandler(stores.APIKeys))
+	apiGroup.GET("/enrollment-tokens", auth.Require(auth.PermKeysManage), ListEnrollmentTokensHandler(stores.APIKeys))
+	apiGroup.POST("/enrollment-tokens", auth.Require(auth.PermKeysManage), CreateEnrollmentTokenHandler(keys))
+	apiGroup.POST("/enrollment-tokens/:id/revoke", auth.Require(auth.PermKeysManage), RevokeEnrollmentTokenHandler(stores.APIKeys))
+
+	// 内置 CA 签发的客户端证书
+	if ca != nil {
+		apiGroup.POST("/certs/renew", auth.Require(auth.PermReportWrite), CertRenewHandler(ca))
+		apiGroup.GET("/certs", auth.Require(auth.PermKeysManage), ListCertificatesHandler(stores.Certs))
+		apiGroup.POST("/certs/:serial/revoke", auth.Require(auth.PermKeysManage), RevokeCertificateHandler(ca))
+	}
 
 	return r
 }
+
+// NewAuditLogger 按配置选择审计存储后端（file/database）并创建审计日志记录器
+func NewAuditLogger(cfg *config.Config, db *sql.DB) (*audit.AuditLogger, error) {
+	var sink audit.AuditSink
+	switch cfg.Auth.AuditSink {
+	case "", "file":
+		fs, err := audit.NewFileSink(cfg.Auth.AuditLogPath, auditRotation(cfg))
+		if err != nil {
+			return nil, err
+		}
+		sink = fs
+	case "database":
+		sink = audit.NewSQLSink(db)
+	default:
+		return nil, fmt.Errorf("不支持的审计存储: %s", cfg.Auth.AuditSink)
+	}
+	return audit.NewAuditLogger(sink, []byte(cfg.Auth.AuditHMACKey))
+}
+
+// whitelist 解析 IP 白名单，无法解析的条目记录日志后忽略
+func whitelist(cfg *config.Config) *utils.IPAllowList {
+	l, invalid := utils.ParseIPAllowList(cfg.Auth.WhitelistIPs)
+	for _, item := range invalid {
+		log.Printf("ip_whitelist 条目无效，已忽略: %q", item)
+	}
+	return l
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// routeLimits 将配置中的路由限流覆盖转换为 auth.RouteLimit
+func routeLimits(cfg *config.Config) []auth.RouteLimit {
+	var res []auth.RouteLimit
+	for _, r := range cfg.Auth.RateLimitRoutes {
+		if r.Path == "" || r.RequestsPerMinute < 0 || r.Burst < 0 {
+			log.Printf("rate_limit_routes 条目无效，已忽略: %+v", r)
+			continue
+		}
+		res = append(res, auth.RouteLimit{
+			Method:            strings.ToUpper(r.Method),
+			Path:              r.Path,
+			RequestsPerMinute: r.RequestsPerMinute,
+			Burst:             r.Burst,
+			Shared:            r.Shared,
+		})
+	}
+	return res
+}
+
+// configRoles 过滤配置中的未知角色
+func configRoles(key string, roles []string) []string {
+	var valid []string
+	for _, r := range roles {
+		if !auth.IsValidRole(r) {
+			log.Printf("%s 包含未知角色 %q，已忽略", key, r)
+			continue
+		}
+		valid = append(valid, r)
+	}
+	res, _ := auth.NormalizeRoles(valid)
+	return res
+}
+
+// sessionTTL 解析会话有效期，无效时使用默认 12 小时
+func sessionTTL(cfg *config.Config) time.Duration {
+	return parseTTL("session_ttl", cfg.Auth.SessionTTL, 12*time.Hour)
+}
+
+// parseTTL 解析配置中的时长，为空或无效时使用 def（def 为 0 表示禁用对应功能）
+func parseTTL(name, value string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		if value != "" && (err != nil || d != def) {
+			log.Printf("%s 配置无效，使用默认 %v: %v", name, def, value)
+		}
+		return def
+	}
+	return d
+}
+
+// ldapAuthenticator 按配置创建 LDAP 认证器，未启用或配置不完整时返回 nil
+func ldapAuthenticator(cfg *config.Config) *auth.LDAPAuthenticator {
+	l := cfg.Auth.LDAP
+	if !l.Enabled {
+		return nil
+	}
+	if l.URL == "" || l.UserBaseDN == "" {
+		log.Printf("ldap 已启用但缺少 url/user_base_dn，已禁用 LDAP 登录")
+		return nil
+	}
+	timeout := parseTTL("ldap.timeout", l.Timeout, 5*time.Second)
+	cacheTTL := parseTTL("ldap.cache_ttl", l.CacheTTL, 0)
+	return auth.NewLDAPAuthenticator(l, timeout, cacheTTL)
+}
+
+// NewCA 按配置加载或创建内置 CA，未启用时返回 nil
+func NewCA(cfg *config.Config, store database.CertificateStore) (*pki.CA, error) {
+	c := cfg.TLS.CA
+	if !c.Enabled {
+		return nil, nil
+	}
+	dir := c.Dir
+	if dir == "" {
+		dir = "./data/ca"
+	}
+	return pki.LoadOrCreate(dir, store, parseTTL("tls.ca.cert_ttl", c.CertTTL, 72*time.Hour), parseTTL("tls.ca.crl_ttl", c.CRLTTL, 24*time.Hour))
+}
+
+// auditRotation 将配置转换为审计日志文件切分参数
+func auditRotation(cfg *config.Config) audit.Rotation {
+	return audit.Rotation{
+		MaxSize:    int64(cfg.Auth.AuditMaxSizeMB) * 1024 * 1024,
+		MaxBackups: cfg.Auth.AuditMaxBackups,
+		MaxAge:     time.Duration(cfg.Auth.AuditMaxAgeDays) * 24 * time.Hour,
+		Compress:   cfg.Auth.AuditCompress,
+		Interval:   parseTTL("audit_rotate_every", cfg.Auth.AuditRotateEvery, 0),
+	}
+}
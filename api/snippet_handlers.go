@@ -0,0 +1,304 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pxe-manager/database"
+	"pxe-manager/pxe"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SnippetRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Content     string `json:"content"`
+}
+
+// SnippetUsage 为片段的影响范围
+type SnippetUsage struct {
+	Snippets  []string      `json:"snippets"`  // 直接或间接 include 了该片段的片段
+	Templates []TemplateRef `json:"templates"` // 直接或经其他片段间接使用该片段的模板
+}
+
+type TemplateRef struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Direct bool   `json:"direct"` // 模板内容中直接 include
+}
+
+// snippetLookup 为渲染提供按名称读取片段的函数
+func snippetLookup(store database.SnippetStore) pxe.SnippetLookup {
+	return func(name string) (string, error) {
+		s, err := store.GetSnippetByName(name)
+		if errors.Is(err, database.ErrNotFound) {
+			return "", fmt.Errorf("%w: %s", pxe.ErrSnippetNotFound, name)
+		}
+		if err != nil {
+			return "", err
+		}
+		return s.Content, nil
+	}
+}
+
+// includeGraph 读取全部片段并构建引用关系；override 非空时以其替换（或新增）对应片段的内容
+func includeGraph(store database.SnippetStore, override map[string]string) (pxe.IncludeGraph, error) {
+	list, err := store.ListSnippets()
+	if err != nil {
+		return nil, err
+	}
+	contents := make(map[string]string, len(list)+len(override))
+	for _, s := range list {
+		contents[s.Name] = s.Content
+	}
+	for name, content := range override {
+		contents[name] = content
+	}
+	return pxe.NewIncludeGraph(contents), nil
+}
+
+// snippetUsage 计算片段的影响范围
+func snippetUsage(templates database.TemplateStore, snippets database.SnippetStore, name string) (*SnippetUsage, error) {
+	g, err := includeGraph(snippets, nil)
+	if err != nil {
+		return nil, err
+	}
+	usage := &SnippetUsage{Snippets: g.Dependents(name), Templates: []TemplateRef{}}
+	affected := map[string]bool{name: true}
+	for _, n := range usage.Snippets {
+		affected[n] = true
+	}
+	list, err := templates.ListConfigs()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range list {
+		direct, used := false, false
+		for _, inc := range pxe.Includes(t.ConfigContent) {
+			direct = direct || inc == name
+			used = used || affected[inc]
+		}
+		if used {
+			usage.Templates = append(usage.Templates, TemplateRef{ID: t.ID, Name: t.Name, Direct: direct})
+		}
+	}
+	return usage, nil
+}
+
+func (u *SnippetUsage) inUse() bool {
+	return len(u.Snippets) > 0 || len(u.Templates) > 0
+}
+
+func ListSnippetsHandler(store database.SnippetStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := store.ListSnippets()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询片段失败"})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// getSnippet 按路由参数读取片段，失败时已写入响应
+func getSnippet(c *gin.Context, store database.SnippetStore) *database.TemplateSnippet {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的片段ID"})
+		return nil
+	}
+	s, err := store.GetSnippet(id)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到片段"})
+		return nil
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询片段失败"})
+		return nil
+	}
+	return s
+}
+
+func GetSnippetHandler(store database.SnippetStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s := getSnippet(c, store); s != nil {
+			c.JSON(http.StatusOK, s)
+		}
+	}
+}
+
+// SnippetUsageHandler 返回引用该片段的片段与模板，用于评估修改片段的影响范围
+// GET /api/snippets/:id/usage
+func SnippetUsageHandler(templates database.TemplateStore, snippets database.SnippetStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := getSnippet(c, snippets)
+		if s == nil {
+			return
+		}
+		usage, err := snippetUsage(templates, snippets, s.Name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询片段引用失败"})
+			return
+		}
+		c.JSON(http.StatusOK, usage)
+	}
+}
+
+// validateSnippet 校验片段名、语法与循环引用；oldName 为改名前的名称（新建时为空）
+func validateSnippet(store database.SnippetStore, req *SnippetRequest, oldName string) (int, error) {
+	if !pxe.ValidSnippetName(req.Name) {
+		return http.StatusBadRequest, errors.New("片段名只能包含字母、数字、点、下划线与连字符，且不超过 64 个字符")
+	}
+	if err := pxe.ParseTemplate(req.Content); err != nil {
+		return http.StatusBadRequest, err
+	}
+	g, err := includeGraph(store, map[string]string{req.Name: req.Content})
+	if err != nil {
+		return http.StatusInternalServerError, errors.New("查询片段失败")
+	}
+	if oldName != "" && oldName != req.Name {
+		delete(g, oldName)
+	}
+	if cycle := g.FindCycle(req.Name); cycle != nil {
+		return http.StatusBadRequest, fmt.Errorf("%w: %s", pxe.ErrIncludeCycle, strings.Join(cycle, " → "))
+	}
+	return 0, nil
+}
+
+// CreateSnippetHandler 新建片段
+// POST /api/snippets {"name": "ssh-hardening", "description": "...", "content": "..."}
+func CreateSnippetHandler(templates database.TemplateStore, snippets database.SnippetStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req SnippetRequest
+		if err := c.BindJSON(&req); err != nil {
+			auditEvent(c, "create_snippet", "", "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+		if status, err := validateSnippet(snippets, &req, ""); err != nil {
+			auditEvent(c, "create_snippet", req.Name, "failure")
+			respondRenderError(c, status, err)
+			return
+		}
+		id, err := snippets.CreateSnippet(&database.TemplateSnippet{
+			Name: req.Name, Description: req.Description, Content: req.Content, UpdatedBy: actorOf(c),
+		})
+		if err != nil {
+			auditEvent(c, "create_snippet", req.Name, "failure")
+			if errors.Is(err, database.ErrSnippetExists) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建片段失败"})
+			return
+		}
+		auditEvent(c, "create_snippet", req.Name, "success")
+		c.JSON(http.StatusCreated, gin.H{"id": id})
+	}
+}
+
+// UpdateSnippetHandler 修改片段，响应中返回受影响的模板；
+// 改名会使引用旧名称的模板失效，片段仍被引用时需带 ?force=true
+// PUT /api/snippets/:id
+func UpdateSnippetHandler(templates database.TemplateStore, snippets database.SnippetStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		old := getSnippet(c, snippets)
+		if old == nil {
+			return
+		}
+		var req SnippetRequest
+		if err := c.BindJSON(&req); err != nil {
+			auditEvent(c, "update_snippet", old.Name, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+		if status, err := validateSnippet(snippets, &req, old.Name); err != nil {
+			auditEvent(c, "update_snippet", old.Name, "failure")
+			respondRenderError(c, status, err)
+			return
+		}
+		usage, err := snippetUsage(templates, snippets, old.Name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询片段引用失败"})
+			return
+		}
+		if req.Name != old.Name && usage.inUse() && c.Query("force") != "true" {
+			auditEvent(c, "update_snippet", old.Name, "failure")
+			c.JSON(http.StatusConflict, gin.H{"error": "片段仍被引用，改名会导致引用失效", "usage": usage})
+			return
+		}
+		err = snippets.UpdateSnippet(old.ID, &database.TemplateSnippet{
+			Name: req.Name, Description: req.Description, Content: req.Content, UpdatedBy: actorOf(c),
+		})
+		if err != nil {
+			auditEvent(c, "update_snippet", old.Name, "failure")
+			if errors.Is(err, database.ErrSnippetExists) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新片段失败"})
+			return
+		}
+		auditEventMeta(c, "update_snippet", old.Name, "success", map[string]interface{}{"affectedTemplates": len(usage.Templates)})
+		c.JSON(http.StatusOK, gin.H{"message": "片段已更新", "usage": usage})
+	}
+}
+
+// DeleteSnippetHandler 删除片段；仍被引用时需带 ?force=true
+// DELETE /api/snippets/:id
+func DeleteSnippetHandler(templates database.TemplateStore, snippets database.SnippetStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := getSnippet(c, snippets)
+		if s == nil {
+			return
+		}
+		usage, err := snippetUsage(templates, snippets, s.Name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询片段引用失败"})
+			return
+		}
+		if usage.inUse() && c.Query("force") != "true" {
+			auditEvent(c, "delete_snippet", s.Name, "failure")
+			c.JSON(http.StatusConflict, gin.H{"error": "片段仍被引用", "usage": usage})
+			return
+		}
+		if err := snippets.DeleteSnippet(s.ID); err != nil {
+			auditEvent(c, "delete_snippet", s.Name, "failure")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除片段失败"})
+			return
+		}
+		auditEvent(c, "delete_snippet", s.Name, "success")
+		c.JSON(http.StatusOK, gin.H{"message": "片段已删除"})
+	}
+}
+
+// ConfigSnippetsHandler 返回模板直接与间接引用的片段，以及其中不存在的片段
+// GET /api/configs/:id/snippets
+func ConfigSnippetsHandler(templates database.TemplateStore, snippets database.SnippetStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		conf, err := templates.GetConfig(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "未找到配置"})
+			return
+		}
+		g, err := includeGraph(snippets, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询片段失败"})
+			return
+		}
+		direct := pxe.Includes(conf.ConfigContent)
+		all := g.Closure(direct)
+		missing := []string{}
+		for _, name := range all {
+			if _, ok := g[name]; !ok {
+				missing = append(missing, name)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"direct": direct, "all": all, "missing": missing})
+	}
+}
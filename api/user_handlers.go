@@ -0,0 +1,156 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"pxe-manager/auth"
+	"pxe-manager/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateUserRequest struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Roles    []string `json:"roles"`
+}
+
+type SetRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+// ListRolesHandler 返回内置角色及其权限
+func ListRolesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, auth.Roles())
+	}
+}
+
+func ListUsersHandler(users database.UserStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := users.ListUsers()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询用户失败"})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// CreateUserHandler 新建账号并分配角色
+// POST /api/users {"username": "...", "password": "...", "roles": ["viewer"]}
+func CreateUserHandler(users database.UserStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateUserRequest
+		if err := c.BindJSON(&req); err != nil || req.Username == "" {
+			auditEvent(c, "create_user", req.Username, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+		roles, bad := auth.NormalizeRoles(req.Roles)
+		if bad != "" {
+			auditEvent(c, "create_user", req.Username, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "未知角色: " + bad})
+			return
+		}
+		hash, err := auth.HashPassword(req.Password)
+		if err != nil {
+			auditEvent(c, "create_user", req.Username, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		id, err := users.CreateUser(&database.User{Username: req.Username, PasswordHash: hash, Roles: roles})
+		if err != nil {
+			auditEvent(c, "create_user", req.Username, "failure")
+			if errors.Is(err, database.ErrUserExists) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建用户失败"})
+			return
+		}
+		auditEventMeta(c, "create_user", req.Username, "success", map[string]interface{}{"roles": roles})
+		c.JSON(http.StatusCreated, gin.H{"id": id, "username": req.Username, "roles": roles})
+	}
+}
+
+// SetUserRolesHandler 整体替换用户角色；不允许移除最后一个 admin
+// PUT /api/users/:id/roles {"roles": ["operator", "auditor"]}
+func SetUserRolesHandler(users database.UserStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+			return
+		}
+		var req SetRolesRequest
+		if err := c.BindJSON(&req); err != nil {
+			auditEvent(c, "set_roles", c.Param("id"), "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+		roles, bad := auth.NormalizeRoles(req.Roles)
+		if bad != "" {
+			auditEvent(c, "set_roles", c.Param("id"), "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "未知角色: " + bad})
+			return
+		}
+		u, err := users.GetUserByID(id)
+		if err != nil {
+			auditEvent(c, "set_roles", c.Param("id"), "failure")
+			if errors.Is(err, database.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "未找到用户"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询用户失败"})
+			return
+		}
+		if hasRole(u.Roles, auth.RoleAdmin) && !hasRole(roles, auth.RoleAdmin) {
+			last, err := isLastAdmin(users, u.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "查询用户失败"})
+				return
+			}
+			if last {
+				auditEvent(c, "set_roles", u.Username, "failure")
+				c.JSON(http.StatusConflict, gin.H{"error": "不能移除最后一个管理员的 admin 角色"})
+				return
+			}
+		}
+		if err := users.SetUserRoles(id, roles); err != nil {
+			auditEvent(c, "set_roles", u.Username, "failure")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新角色失败"})
+			return
+		}
+		auditEventMeta(c, "set_roles", u.Username, "success", map[string]interface{}{
+			"from": u.Roles,
+			"to":   roles,
+		})
+		c.JSON(http.StatusOK, gin.H{"id": id, "username": u.Username, "roles": roles})
+	}
+}
+
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// isLastAdmin 判断 userID 是否为唯一启用的 admin
+func isLastAdmin(users database.UserStore, userID int) (bool, error) {
+	list, err := users.ListUsers()
+	if err != nil {
+		return false, err
+	}
+	for _, u := range list {
+		if u.ID != userID && !u.Disabled && hasRole(u.Roles, auth.RoleAdmin) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+
+	"pxe-manager/database"
+	"pxe-manager/pxe"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SetVariableRequest struct {
+	Scope    string      `json:"scope"`  // server/group
+	Target   string      `json:"target"` // 序列号或分组通配模式
+	Name     string      `json:"name"`
+	Value    interface{} `json:"value"`
+	Priority int         `json:"priority"` // 仅分组有效
+}
+
+// ListVariablesHandler 列出变量覆盖
+// GET /api/variables?scope=group&target=web-*
+func ListVariablesHandler(store database.VariableStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := store.ListServerVariables(c.Query("scope"), c.Query("target"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询变量失败"})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// SetVariableHandler 新建或覆盖一个服务器/分组变量
+// PUT /api/variables {"scope": "group", "target": "web-*", "name": "timezone", "value": "UTC"}
+func SetVariableHandler(store database.VariableStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req SetVariableRequest
+		if err := c.BindJSON(&req); err != nil {
+			auditEvent(c, "set_variable", "", "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+		target := req.Scope + ":" + req.Target + "/" + req.Name
+		if err := validateVariableRequest(&req); err != nil {
+			auditEvent(c, "set_variable", target, "failure")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		v := &database.ServerVariable{
+			Scope:     req.Scope,
+			Target:    req.Target,
+			Name:      req.Name,
+			Value:     req.Value,
+			Priority:  req.Priority,
+			UpdatedBy: actorOf(c),
+		}
+		id, err := store.SetServerVariable(v)
+		if err != nil {
+			auditEvent(c, "set_variable", target, "failure")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存变量失败"})
+			return
+		}
+		// 值可能是密码哈希等敏感信息，审计只记录位置不记录值
+		auditEvent(c, "set_variable", target, "success")
+		c.JSON(http.StatusOK, gin.H{"id": id})
+	}
+}
+
+func validateVariableRequest(req *SetVariableRequest) error {
+	switch req.Scope {
+	case database.VarScopeServer:
+		req.Priority = 0
+	case database.VarScopeGroup:
+		if _, err := path.Match(req.Target, ""); err != nil {
+			return errors.New("分组模式无效: " + req.Target)
+		}
+	default:
+		return errors.New("scope 只能为 server 或 group")
+	}
+	if req.Target == "" || len(req.Target) > 191 {
+		return errors.New("target 不能为空且不超过 191 个字符")
+	}
+	if !pxe.ValidVariableName(req.Name) {
+		return errors.New("变量名无效: " + req.Name)
+	}
+	switch req.Value.(type) {
+	case string, float64, bool:
+	default:
+		return errors.New("变量值只能为字符串、数值或布尔值")
+	}
+	return nil
+}
+
+// DeleteVariableHandler 删除变量覆盖
+// DELETE /api/variables/:id
+func DeleteVariableHandler(store database.VariableStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的变量ID"})
+			return
+		}
+		if err := store.DeleteServerVariable(id); err != nil {
+			auditEvent(c, "delete_variable", c.Param("id"), "failure")
+			if errors.Is(err, database.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "未找到变量"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除变量失败"})
+			return
+		}
+		auditEvent(c, "delete_variable", c.Param("id"), "success")
+		c.JSON(http.StatusOK, gin.H{"message": "变量已删除"})
+	}
+}
+
+// ServerVariablesHandler 返回作用于服务器的变量覆盖；指定 config 时返回该模板的解析结果（含缺失的必填变量）
+// GET /api/servers/:serial/variables?config=1
+func ServerVariablesHandler(servers database.ServerStore, templates database.TemplateStore, variables database.VariableStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		server, err := servers.GetServerBySerial(c.Param("serial"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "未找到服务器"})
+			return
+		}
+		conf := &database.ConfigTemplate{}
+		if idStr := c.Query("config"); idStr != "" {
+			id, _ := strconv.Atoi(idStr)
+			if conf, err = templates.GetConfig(id); err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "未找到配置"})
+				return
+			}
+		}
+		overrides, err := serverOverrides(variables, server)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询变量失败"})
+			return
+		}
+		res := pxe.ResolveVariables(conf.Variables, overrides, server)
+		c.JSON(http.StatusOK, gin.H{"overrides": overrides, "resolution": res})
+	}
+}
+
+// serverOverrides 返回作用于服务器的全部变量覆盖（服务器级与匹配的分组）
+func serverOverrides(variables database.VariableStore, server *database.Server) ([]database.ServerVariable, error) {
+	own, err := variables.ListServerVariables(database.VarScopeServer, server.Serial)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := variables.ListServerVariables(database.VarScopeGroup, "")
+	if err != nil {
+		return nil, err
+	}
+	res := own
+	for i := range groups {
+		if pxe.MatchesServer(&groups[i], server) {
+			res = append(res, groups[i])
+		}
+	}
+	return res, nil
+}
+
+// resolveVariables 解析模板在服务器上的变量取值
+func resolveVariables(variables database.VariableStore, conf *database.ConfigTemplate, server *database.Server) (*pxe.Resolution, error) {
+	overrides, err := serverOverrides(variables, server)
+	if err != nil {
+		return nil, err
+	}
+	return pxe.ResolveVariables(conf.Variables, overrides, server), nil
+}
@@ -0,0 +1,169 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// chainHash 计算 H(prevHash "\n" body)，body 为不含 hash 字段的日志 JSON；
+// 配置了密钥时使用 HMAC-SHA256，否则使用 SHA-256
+func chainHash(key []byte, prevHash string, body []byte) string {
+	var h interface {
+		io.Writer
+		Sum([]byte) []byte
+	}
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	h.Write([]byte(prevHash))
+	h.Write([]byte{'\n'})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// splitHash 从原始日志行中剥离末尾的 "hash" 字段，返回计算哈希时使用的 body
+func splitHash(line []byte) (body []byte, hash string, ok bool) {
+	const prefix = `,"hash":"`
+	const suffix = `"}`
+	if !bytes.HasSuffix(line, []byte(suffix)) {
+		return nil, "", false
+	}
+	idx := bytes.LastIndex(line, []byte(prefix))
+	if idx < 0 {
+		return nil, "", false
+	}
+	hash = string(line[idx+len(prefix) : len(line)-len(suffix)])
+	body = append(append([]byte{}, line[:idx]...), '}')
+	return body, hash, true
+}
+
+// BrokenLink 描述哈希链中第一个断裂的位置
+type BrokenLink struct {
+	Segment string `json:"segment"`
+	Line    int    `json:"line"`
+	Seq     uint64 `json:"seq"`
+	Reason  string `json:"reason"`
+}
+
+// VerifyResult 为哈希链校验结果
+type VerifyResult struct {
+	OK       bool        `json:"ok"`
+	Entries  int         `json:"entries"`  // 已校验的链上日志数
+	Legacy   int         `json:"legacy"`   // 启用哈希链之前的旧日志数（不参与校验）
+	FirstSeq uint64      `json:"firstSeq"` // 链起点（更早的归档可能已被清理）
+	LastSeq  uint64      `json:"lastSeq"`
+	Broken   *BrokenLink `json:"broken,omitempty"`
+}
+
+// chainVerifier 逐条校验日志原始 JSON，文件与数据库后端共用
+type chainVerifier struct {
+	key      []byte
+	res      *VerifyResult
+	prevSeq  uint64
+	prevHash string
+	started  bool
+}
+
+func newChainVerifier(key []byte) *chainVerifier {
+	return &chainVerifier{key: key, res: &VerifyResult{}}
+}
+
+// check 校验一条日志；发现断点时记录到 res.Broken 并返回 false
+func (v *chainVerifier) check(raw []byte, segment string, line int) bool {
+	fail := func(seq uint64, format string, args ...interface{}) bool {
+		v.res.Broken = &BrokenLink{Segment: segment, Line: line, Seq: seq, Reason: fmt.Sprintf(format, args...)}
+		return false
+	}
+	var e AuditLog
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return fail(0, "无法解析日志行")
+	}
+	if e.Seq == 0 && e.Hash == "" {
+		if v.started {
+			return fail(0, "哈希链中出现未签名日志")
+		}
+		v.res.Legacy++
+		return true
+	}
+	body, hash, ok := splitHash(raw)
+	if !ok || hash != e.Hash {
+		return fail(e.Seq, "hash 字段格式错误")
+	}
+	if v.started {
+		if e.Seq != v.prevSeq+1 {
+			return fail(e.Seq, "序号不连续: 期望 %d", v.prevSeq+1)
+		}
+		if e.PrevHash != v.prevHash {
+			return fail(e.Seq, "prevHash 与上一条日志不一致")
+		}
+	} else {
+		v.started, v.res.FirstSeq = true, e.Seq
+	}
+	if chainHash(v.key, e.PrevHash, body) != e.Hash {
+		return fail(e.Seq, "日志内容与 hash 不匹配")
+	}
+	v.prevSeq, v.prevHash = e.Seq, e.Hash
+	v.res.Entries++
+	v.res.LastSeq = e.Seq
+	return true
+}
+
+// result 在全部日志校验通过后调用
+func (v *chainVerifier) result() *VerifyResult {
+	v.res.OK = v.res.Broken == nil
+	return v.res
+}
+
+// Verify 按时间顺序遍历当前日志文件及归档，校验序号连续、prevHash 衔接与每条日志的哈希，
+// 遇到第一个断点即停止。
+func Verify(path string, key []byte) (*VerifyResult, error) {
+	segs, err := listSegments(path)
+	if err != nil {
+		return nil, err
+	}
+	v := newChainVerifier(key)
+	for _, seg := range segs {
+		ok, err := verifySegment(v, seg)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+	}
+	return v.result(), nil
+}
+
+func verifySegment(v *chainVerifier, seg segment) (bool, error) {
+	r, err := openSegment(seg)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	defer r.Close()
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		raw, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			// 末尾不完整的行可能正在写入，不参与校验
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if !v.check(bytes.TrimRight(raw, "\r\n"), seg.name, n) {
+			return false, nil
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// FileSink 将审计日志以 JSON 行写入文件，支持切分、压缩与保留
+type FileSink struct {
+	mu       sync.Mutex
+	file     *os.File
+	path     string
+	rot      Rotation
+	size     int64     // 当前文件大小
+	openedAt time.Time // 当前分段起始时间
+	wg       sync.WaitGroup
+}
+
+var _ AuditSink = (*FileSink)(nil)
+
+func NewFileSink(logPath string, rot Rotation) (*FileSink, error) {
+	// 确保目录存在
+	if err := os.MkdirAll(dirOf(logPath), 0755); err != nil {
+		return nil, err
+	}
+	f := &FileSink{path: logPath, rot: rot}
+	if err := f.openFile(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// openFile 打开（或创建）当前日志文件并记录大小与起始时间
+func (f *FileSink) openFile() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	st, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, st.Size()
+	if f.size > 0 {
+		f.openedAt = segmentStart(f.path)
+	} else {
+		f.openedAt = time.Now()
+	}
+	return nil
+}
+
+func (f *FileSink) Write(_ *AuditLog, line []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b := append(line, '\n')
+	if f.shouldRotate(len(b)) {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := f.file.Write(b)
+	f.size += int64(n)
+	return err
+}
+
+// Last 返回最新一条日志（可能位于归档中）
+func (f *FileSink) Last() (*AuditLog, error) {
+	page, err := ReadLogs(f.path, Query{Desc: true, Limit: 1})
+	if err != nil || len(page.Items) == 0 {
+		return nil, err
+	}
+	return &page.Items[0], nil
+}
+
+func (f *FileSink) Query(q Query) (*Page, error) {
+	return ReadLogs(f.path, q)
+}
+
+func (f *FileSink) Verify(key []byte) (*VerifyResult, error) {
+	return Verify(f.path, key)
+}
+
+// Close 关闭当前文件并等待后台压缩/清理完成
+func (f *FileSink) Close() error {
+	f.wg.Wait()
+	if f.file != nil {
+		return f.file.Close()
+	}
+	return nil
+}
@@ -2,7 +2,6 @@ package audit
 
 import (
 	"encoding/json"
-	"os"
 	"sync"
 	"time"
 )
@@ -10,6 +9,7 @@ import (
 type AuditLog struct {
 	Timestamp string                 `json:"timestamp"`
 	ClientIP  string                 `json:"clientIP"`
+	Actor     string                 `json:"actor,omitempty"` // 登录用户名，共享令牌/白名单访问时为空
 	UserAgent string                 `json:"userAgent"`
 	Method    string                 `json:"method"`
 	Path      string                 `json:"path"`
@@ -18,49 +18,79 @@ type AuditLog struct {
 	Status    string                 `json:"status"`
 	Error     string                 `json:"error,omitempty"`
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	// 哈希链字段：Hash 必须是最后一个字段，校验时据此从原始行中剥离
+	Seq      uint64 `json:"seq,omitempty"`
+	PrevHash string `json:"prevHash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
 }
 
+// AuditSink 为审计日志的存储后端（JSON 行文件或数据库）
+type AuditSink interface {
+	// Write 持久化一条已计算好哈希的日志；line 为其 JSON 编码（不含换行）
+	Write(e *AuditLog, line []byte) error
+	// Last 返回最新一条日志，用于启动时恢复哈希链；没有日志时返回 nil
+	Last() (*AuditLog, error)
+	Query(q Query) (*Page, error)
+	Verify(key []byte) (*VerifyResult, error)
+	Close() error
+}
+
+// AuditLogger 负责计算哈希链并写入 AuditSink
 type AuditLogger struct {
-	file   *os.File
-	mu     sync.Mutex
-	enable bool
+	mu   sync.Mutex
+	sink AuditSink
+
+	key      []byte // 非空时使用 HMAC-SHA256 计算哈希链
+	seq      uint64 // 最后一条日志的序号
+	lastHash string // 最后一条日志的哈希
 }
 
-func NewAuditLogger(logPath string, enable bool) (*AuditLogger, error) {
-	if !enable {
-		return &AuditLogger{enable: false}, nil
-	}
-	// 确保目录存在
-	if err := os.MkdirAll(dirOf(logPath), 0755); err != nil {
-		return nil, err
-	}
-	file, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+func NewAuditLogger(sink AuditSink, hmacKey []byte) (*AuditLogger, error) {
+	a := &AuditLogger{sink: sink, key: hmacKey}
+	// 从最新一条日志恢复哈希链
+	last, err := sink.Last()
 	if err != nil {
 		return nil, err
 	}
-	return &AuditLogger{file: file, enable: enable}, nil
+	if last != nil {
+		a.seq, a.lastHash = last.Seq, last.Hash
+	}
+	return a, nil
 }
 
 func (a *AuditLogger) LogEvent(event AuditLog) error {
-	if !a.enable {
-		return nil
-	}
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	event.Timestamp = time.Now().Format(time.RFC3339)
-	b, err := json.Marshal(event)
+	event.Seq, event.PrevHash, event.Hash = a.seq+1, a.lastHash, ""
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	event.Hash = chainHash(a.key, event.PrevHash, body)
+	line, err := json.Marshal(event)
 	if err != nil {
 		return err
 	}
-	_, err = a.file.Write(append(b, '\n'))
-	return err
+	if err := a.sink.Write(&event, line); err != nil {
+		return err
+	}
+	a.seq, a.lastHash = event.Seq, event.Hash
+	return nil
+}
+
+// Query 按条件分页查询审计日志
+func (a *AuditLogger) Query(q Query) (*Page, error) {
+	return a.sink.Query(q)
+}
+
+// Verify 使用当前密钥校验哈希链
+func (a *AuditLogger) Verify() (*VerifyResult, error) {
+	return a.sink.Verify(a.key)
 }
 
 func (a *AuditLogger) Close() error {
-	if a.file != nil {
-		return a.file.Close()
-	}
-	return nil
+	return a.sink.Close()
 }
 
 func dirOf(path string) string {
@@ -0,0 +1,317 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultQueryLimit = 100
+	MaxQueryLimit     = 1000
+)
+
+// Query 为审计日志的服务端筛选条件，空字段表示不限制
+type Query struct {
+	Method   string // 精确匹配（忽略大小写）
+	Path     string // 包含匹配
+	Action   string // 包含匹配
+	Status   string // 精确匹配
+	ClientIP string // 精确匹配
+	Actor    string // 精确匹配
+	Target   string // 包含匹配
+	From     time.Time
+	To       time.Time
+
+	Desc   bool   // true: 最新在前
+	Limit  int    // 默认 100，最大 1000
+	Cursor string // 上一页返回的 NextCursor
+}
+
+// Page 为一页查询结果；NextCursor 为空表示没有更多数据
+type Page struct {
+	Items      []AuditLog `json:"items"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+// ErrInvalidCursor 表示分页游标无法解析
+var ErrInvalidCursor = errors.New("无效的分页游标")
+
+// Match 判断一条日志是否满足筛选条件
+func (q *Query) Match(e *AuditLog) bool {
+	switch {
+	case q.Method != "" && !strings.EqualFold(e.Method, q.Method),
+		q.Path != "" && !strings.Contains(e.Path, q.Path),
+		q.Action != "" && !strings.Contains(e.Action, q.Action),
+		q.Status != "" && e.Status != q.Status,
+		q.ClientIP != "" && e.ClientIP != q.ClientIP,
+		q.Actor != "" && e.Actor != q.Actor,
+		q.Target != "" && !strings.Contains(e.Target, q.Target):
+		return false
+	}
+	if !q.From.IsZero() || !q.To.IsZero() {
+		ts, err := time.Parse(time.RFC3339, e.Timestamp)
+		if err != nil {
+			return false
+		}
+		if !q.From.IsZero() && ts.Before(q.From) {
+			return false
+		}
+		if !q.To.IsZero() && ts.After(q.To) {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *Query) normalize() {
+	if q.Limit <= 0 {
+		q.Limit = DefaultQueryLimit
+	}
+	if q.Limit > MaxQueryLimit {
+		q.Limit = MaxQueryLimit
+	}
+}
+
+// matchedLine 为命中的日志及其所在分段与行号（从 1 开始）
+type matchedLine struct {
+	seg   segment
+	line  int
+	entry AuditLog
+}
+
+// cursor 为分页位置。哈希链日志以 seq 定位，seq 跨分段单调递增，日志轮转后仍然有效；
+// 启用哈希链之前写入的日志没有 seq（均早于有 seq 的日志），以 "<分段>:<行号>" 定位
+type cursor struct {
+	seq  uint64
+	key  string // 无 seq 时的分段排序键
+	line int
+}
+
+// parseCursor 解析 "<seq>" 或 "<分段名>:<行号>" 形式的游标；path 为当前日志文件
+func parseCursor(path, s string) (*cursor, error) {
+	if seq, err := strconv.ParseUint(s, 10, 64); err == nil {
+		if seq == 0 {
+			return nil, ErrInvalidCursor
+		}
+		return &cursor{seq: seq}, nil
+	}
+	idx := strings.LastIndexByte(s, ':')
+	if idx <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	n, err := strconv.Atoi(s[idx+1:])
+	if err != nil || n <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	// 当前文件的游标名即文件名，排序键需与 listSegments 一致
+	key := s[:idx]
+	if key == filepath.Base(path) {
+		key = "\xff"
+	}
+	return &cursor{key: key, line: n}, nil
+}
+
+// compare 返回日志相对游标的位置：负数在前，0 相同，正数在后
+func (c *cursor) compare(seg segment, line int, e *AuditLog) int {
+	if c.seq > 0 || e.Seq > 0 {
+		switch {
+		case e.Seq < c.seq:
+			return -1
+		case e.Seq > c.seq:
+			return 1
+		}
+		return 0
+	}
+	if seg.key != c.key {
+		return strings.Compare(seg.key, c.key)
+	}
+	return line - c.line
+}
+
+// cursor 返回指向该日志的游标
+func (h *matchedLine) cursor() string {
+	if h.entry.Seq > 0 {
+		return strconv.FormatUint(h.entry.Seq, 10)
+	}
+	return h.seg.name + ":" + strconv.Itoa(h.line)
+}
+
+// firstSeq 返回分段第一条日志的 seq，分段为空或第一条日志没有 seq 时返回 0
+func firstSeq(seg segment) (uint64, error) {
+	var seq uint64
+	err := scanSegment(seg, func(_ int, e *AuditLog) bool {
+		seq = e.Seq
+		return false
+	})
+	return seq, err
+}
+
+// ReadLogs 流式扫描当前日志及其归档（含 .gz）并分页返回命中的日志，
+// 内存占用只与 Limit 相关。游标为上一页最后一条日志的 seq：
+// 正序取其后的记录，倒序取其前的记录；借助各分段首条日志的 seq 跳过无关分段。
+func ReadLogs(path string, q Query) (*Page, error) {
+	q.normalize()
+	var cur *cursor
+	if q.Cursor != "" {
+		var err error
+		if cur, err = parseCursor(path, q.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	page := &Page{Items: []AuditLog{}}
+	segs, err := listSegments(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var hits []matchedLine
+	need := q.Limit + 1 // 多取一条用于判断是否还有下一页
+	if !q.Desc {
+		for i, seg := range segs {
+			if cur != nil {
+				skip, err := beforeCursor(segs, i, cur)
+				if err != nil {
+					return nil, err
+				}
+				if skip {
+					continue
+				}
+			}
+			err := scanSegment(seg, func(n int, e *AuditLog) bool {
+				if (cur != nil && cur.compare(seg, n, e) <= 0) || !q.Match(e) {
+					return true
+				}
+				hits = append(hits, matchedLine{seg, n, *e})
+				return len(hits) < need
+			})
+			if err != nil {
+				return nil, err
+			}
+			if len(hits) >= need {
+				break
+			}
+		}
+		return buildPage(page, hits, q.Limit), nil
+	}
+
+	// 倒序：从最新分段向前，分段内用环形缓冲保留游标之前最后 need 条命中记录
+	for i := len(segs) - 1; i >= 0 && len(hits) < need; i-- {
+		seg := segs[i]
+		if cur != nil {
+			skip, err := afterCursor(seg, cur)
+			if err != nil {
+				return nil, err
+			}
+			if skip {
+				continue
+			}
+		}
+		want := need - len(hits)
+		ring := make([]matchedLine, want)
+		count := 0
+		err := scanSegment(seg, func(n int, e *AuditLog) bool {
+			// 分段内日志按位置递增，到达游标即可停止
+			if cur != nil && cur.compare(seg, n, e) >= 0 {
+				return false
+			}
+			if q.Match(e) {
+				ring[count%want] = matchedLine{seg, n, *e}
+				count++
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		size := count
+		if size > want {
+			size = want
+		}
+		for j := 0; j < size; j++ {
+			hits = append(hits, ring[(count-1-j)%want])
+		}
+	}
+	return buildPage(page, hits, q.Limit), nil
+}
+
+// beforeCursor 判断 segs[i] 是否整体位于游标之前（正序时可跳过）
+func beforeCursor(segs []segment, i int, cur *cursor) (bool, error) {
+	if cur.seq == 0 {
+		// 无 seq 的日志早于所有哈希链日志，游标所在分段之前只有无 seq 的日志
+		return segs[i].key < cur.key, nil
+	}
+	if i+1 == len(segs) {
+		return false, nil
+	}
+	next, err := firstSeq(segs[i+1])
+	if err != nil {
+		return false, err
+	}
+	// 下一分段从 next 开始，本分段的 seq 均小于 next
+	return next > 0 && next-1 <= cur.seq, nil
+}
+
+// afterCursor 判断分段是否整体位于游标之后（倒序时可跳过）
+func afterCursor(seg segment, cur *cursor) (bool, error) {
+	if cur.seq == 0 {
+		return seg.key > cur.key, nil
+	}
+	first, err := firstSeq(seg)
+	if err != nil {
+		return false, err
+	}
+	return first >= cur.seq, nil
+}
+
+// buildPage hits 最多 limit+1 条，第 limit+1 条仅用于判断是否有下一页
+func buildPage(page *Page, hits []matchedLine, limit int) *Page {
+	more := len(hits) > limit
+	if more {
+		hits = hits[:limit]
+	}
+	for _, h := range hits {
+		page.Items = append(page.Items, h.entry)
+	}
+	if more && len(hits) > 0 {
+		page.NextCursor = hits[len(hits)-1].cursor()
+	}
+	return page
+}
+
+// scanSegment 打开分段并逐行回调；分段在读取前被清理时视为空
+func scanSegment(seg segment, fn func(line int, e *AuditLog) bool) error {
+	r, err := openSegment(seg)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer r.Close()
+	return scanLines(r, fn)
+}
+
+// scanLines 逐行解析日志，fn 返回 false 时停止；无法解析的行跳过但仍计入行号
+func scanLines(r io.Reader, fn func(line int, e *AuditLog) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	n := 0
+	for scanner.Scan() {
+		n++
+		var e AuditLog
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if !fn(n, &e) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,182 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestLogger(t *testing.T, rot Rotation) (*AuditLogger, *FileSink) {
+	t.Helper()
+	sink, err := NewFileSink(filepath.Join(t.TempDir(), "audit.log"), rot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sink.Close() })
+	logger, err := NewAuditLogger(sink, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logger, sink
+}
+
+func logN(t *testing.T, a *AuditLogger, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := a.LogEvent(AuditLog{Action: "test", Target: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func forceRotate(t *testing.T, f *FileSink) {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.rotate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func seqs(p *Page) []uint64 {
+	res := []uint64{}
+	for _, e := range p.Items {
+		res = append(res, e.Seq)
+	}
+	return res
+}
+
+func readPage(t *testing.T, f *FileSink, q Query) *Page {
+	t.Helper()
+	p, err := ReadLogs(f.path, q)
+	if err != nil {
+		t.Fatalf("ReadLogs(%+v): %v", q, err)
+	}
+	return p
+}
+
+// 翻页过程中发生轮转，游标仍指向同一条日志
+func TestCursorSurvivesRotation(t *testing.T) {
+	a, f := newTestLogger(t, Rotation{})
+	logN(t, a, 5)
+
+	p := readPage(t, f, Query{Limit: 2})
+	if !reflect.DeepEqual(seqs(p), []uint64{1, 2}) || p.NextCursor != "2" {
+		t.Fatalf("page 1 = %v cursor %q", seqs(p), p.NextCursor)
+	}
+	desc := readPage(t, f, Query{Desc: true, Limit: 2})
+	if !reflect.DeepEqual(seqs(desc), []uint64{5, 4}) || desc.NextCursor != "4" {
+		t.Fatalf("desc page 1 = %v cursor %q", seqs(desc), desc.NextCursor)
+	}
+
+	forceRotate(t, f)
+	logN(t, a, 3)
+
+	p = readPage(t, f, Query{Limit: 2, Cursor: p.NextCursor})
+	if !reflect.DeepEqual(seqs(p), []uint64{3, 4}) {
+		t.Fatalf("page 2 = %v", seqs(p))
+	}
+	p = readPage(t, f, Query{Limit: 2, Cursor: p.NextCursor})
+	if !reflect.DeepEqual(seqs(p), []uint64{5, 6}) {
+		t.Fatalf("page 3 = %v", seqs(p))
+	}
+	desc = readPage(t, f, Query{Desc: true, Limit: 2, Cursor: desc.NextCursor})
+	if !reflect.DeepEqual(seqs(desc), []uint64{3, 2}) {
+		t.Fatalf("desc page 2 = %v", seqs(desc))
+	}
+}
+
+// 按大小频繁轮转并压缩归档，正序与倒序翻页都能完整遍历
+func TestPaginateAcrossSegments(t *testing.T) {
+	a, f := newTestLogger(t, Rotation{MaxSize: 600, Compress: true})
+	logN(t, a, 30)
+	f.Close()
+	if segs, _ := listSegments(f.path); len(segs) < 3 {
+		t.Fatalf("expected several segments, got %d", len(segs))
+	}
+
+	for _, desc := range []bool{false, true} {
+		var got []uint64
+		cur := ""
+		for i := 0; i < 20; i++ {
+			p := readPage(t, f, Query{Desc: desc, Limit: 4, Cursor: cur, Target: "1"})
+			got = append(got, seqs(p)...)
+			if cur = p.NextCursor; cur == "" {
+				break
+			}
+		}
+		// Target 为包含匹配："1", "10".."19", "21"
+		want := []uint64{2, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 22}
+		if desc {
+			for i, j := 0, len(want)-1; i < j; i, j = i+1, j-1 {
+				want[i], want[j] = want[j], want[i]
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("desc=%v: got %v, want %v", desc, got, want)
+		}
+	}
+}
+
+// 启用哈希链之前写入的日志没有 seq，排在所有哈希链日志之前，仍可翻页
+func TestPaginateLegacyEntries(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	legacy := `{"timestamp":"2024-01-01T00:00:00Z","action":"old","target":"a"}
+{"timestamp":"2024-01-01T00:00:01Z","action":"old","target":"b"}
+{"timestamp":"2024-01-01T00:00:02Z","action":"old","target":"c"}
+`
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sink, err := NewFileSink(path, Rotation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	a, err := NewAuditLogger(sink, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logN(t, a, 2)
+
+	key := func(e AuditLog) string {
+		if e.Seq > 0 {
+			return fmt.Sprint(e.Seq)
+		}
+		return e.Target
+	}
+	for _, desc := range []bool{false, true} {
+		var got []string
+		cur := ""
+		for i := 0; i < 10; i++ {
+			p := readPage(t, sink, Query{Desc: desc, Limit: 2, Cursor: cur})
+			for _, e := range p.Items {
+				got = append(got, key(e))
+			}
+			if cur = p.NextCursor; cur == "" {
+				break
+			}
+		}
+		want := "a b c 1 2"
+		if desc {
+			want = "2 1 c b a"
+		}
+		if strings.Join(got, " ") != want {
+			t.Fatalf("desc=%v: got %v, want %s", desc, got, want)
+		}
+	}
+}
+
+func TestInvalidCursor(t *testing.T) {
+	_, f := newTestLogger(t, Rotation{})
+	for _, c := range []string{"0", "abc", "audit.log:0", ":3"} {
+		if _, err := ReadLogs(f.path, Query{Cursor: c}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("cursor %q: err = %v", c, err)
+		}
+	}
+}
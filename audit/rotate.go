@@ -0,0 +1,250 @@
+package audit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Rotation 控制审计日志的切分与保留，零值表示不切分
+type Rotation struct {
+	MaxSize    int64         // 当前文件超过该字节数时切分，0 表示不按大小
+	Interval   time.Duration // 当前文件存在超过该时长时切分，0 表示不按时间
+	MaxBackups int           // 保留的归档数量，0 表示不限
+	MaxAge     time.Duration // 归档最长保留时间，0 表示不限
+	Compress   bool          // 归档后 gzip 压缩
+}
+
+// 归档文件名：<base>-<时间戳>.<ext>[.gz]，时间戳按字典序即时间顺序
+const rotateTimeLayout = "20060102T150405.000"
+
+// segment 为一个日志分段（归档或当前文件）
+type segment struct {
+	path string // 实际文件路径（可能带 .gz）
+	name string // 逻辑名称（不含 .gz），用于游标
+	key  string // 排序键，当前文件最大
+}
+
+func splitExt(path string) (string, string) {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext), ext
+}
+
+// rotatedName 生成归档文件名；同一毫秒内多次切分时顺延，避免覆盖已有归档
+func rotatedName(path string, t time.Time) string {
+	base, ext := splitExt(path)
+	for {
+		name := base + "-" + t.Format(rotateTimeLayout) + ext
+		_, err1 := os.Stat(name)
+		_, err2 := os.Stat(name + ".gz")
+		if os.IsNotExist(err1) && os.IsNotExist(err2) {
+			return name
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// rotatedTime 解析归档文件名中的时间戳
+func rotatedTime(path, name string) (time.Time, bool) {
+	base, ext := splitExt(filepath.Base(path))
+	name = strings.TrimSuffix(name, ".gz")
+	if !strings.HasPrefix(name, base+"-") || !strings.HasSuffix(name, ext) {
+		return time.Time{}, false
+	}
+	ts := strings.TrimSuffix(strings.TrimPrefix(name, base+"-"), ext)
+	t, err := time.ParseInLocation(rotateTimeLayout, ts, time.Local)
+	return t, err == nil
+}
+
+// listSegments 按时间顺序返回全部分段（归档在前，当前文件最后）。
+// 压缩过程中可能短暂同时存在 x.log 与 x.log.gz，此时优先使用未压缩文件。
+func listSegments(path string) ([]segment, error) {
+	dir := filepath.Dir(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	byName := map[string]segment{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if _, ok := rotatedTime(path, e.Name()); !ok {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), ".gz")
+		if old, ok := byName[name]; ok && !strings.HasSuffix(old.path, ".gz") {
+			continue
+		}
+		byName[name] = segment{path: filepath.Join(dir, e.Name()), name: name, key: name}
+	}
+	segs := make([]segment, 0, len(byName)+1)
+	for _, s := range byName {
+		segs = append(segs, s)
+	}
+	sort.Slice(segs, func(i, j int) bool { return segs[i].key < segs[j].key })
+	if _, err := os.Stat(path); err == nil {
+		segs = append(segs, segment{path: path, name: filepath.Base(path), key: "\xff"})
+	}
+	return segs, nil
+}
+
+// openSegment 打开分段，.gz 文件透明解压
+func openSegment(s segment) (io.ReadCloser, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(s.path, ".gz") {
+		return f, nil
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{zr, f}, nil
+}
+
+// segmentStart 读取文件首条日志的时间作为分段起始时间，失败时返回当前时间
+func segmentStart(path string) time.Time {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Now()
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return time.Now()
+	}
+	var e AuditLog
+	if json.Unmarshal(line, &e) != nil {
+		return time.Now()
+	}
+	t, err := time.Parse(time.RFC3339, e.Timestamp)
+	if err != nil {
+		return time.Now()
+	}
+	return t
+}
+
+// shouldRotate 调用方需持有锁
+func (f *FileSink) shouldRotate(next int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.rot.MaxSize > 0 && f.size+int64(next) > f.rot.MaxSize {
+		return true
+	}
+	return f.rot.Interval > 0 && time.Since(f.openedAt) >= f.rot.Interval
+}
+
+// rotate 关闭当前文件并重命名为归档，随后在后台压缩与清理；调用方需持有锁
+func (f *FileSink) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	archived := rotatedName(f.path, time.Now())
+	if err := os.Rename(f.path, archived); err != nil {
+		// 重命名失败时重新打开原文件，保证后续仍可写入
+		if oerr := f.openFile(); oerr != nil {
+			return oerr
+		}
+		return err
+	}
+	if err := f.openFile(); err != nil {
+		return err
+	}
+	rot := f.rot
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		if rot.Compress {
+			// 归档可能已被并发的清理删除
+			if err := compressFile(archived); err != nil && !os.IsNotExist(err) {
+				log.Printf("压缩审计日志归档失败: %v", err)
+			}
+		}
+		if err := prune(f.path, rot, time.Now()); err != nil {
+			log.Printf("清理审计日志归档失败: %v", err)
+		}
+	}()
+	return nil
+}
+
+// compressFile 先写入临时文件再重命名，避免读取到半成品
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// prune 按数量与时间清理归档
+func prune(path string, rot Rotation, now time.Time) error {
+	if rot.MaxBackups <= 0 && rot.MaxAge <= 0 {
+		return nil
+	}
+	segs, err := listSegments(path)
+	if err != nil {
+		return err
+	}
+	var archives []segment
+	for _, s := range segs {
+		if s.path != path {
+			archives = append(archives, s)
+		}
+	}
+	for i, s := range archives {
+		expired := rot.MaxBackups > 0 && len(archives)-i > rot.MaxBackups
+		if !expired && rot.MaxAge > 0 {
+			if t, ok := rotatedTime(path, s.name); ok && now.Sub(t) > rot.MaxAge {
+				expired = true
+			}
+		}
+		if expired {
+			if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SQLSink 将审计日志写入 audit_events 表（SQLite/MySQL），
+// raw 列保存原始 JSON 以便哈希链校验与字段完整还原
+type SQLSink struct {
+	db *sql.DB
+}
+
+var _ AuditSink = (*SQLSink)(nil)
+
+func NewSQLSink(db *sql.DB) *SQLSink {
+	return &SQLSink{db: db}
+}
+
+// ts 列统一存储 UTC，与 CURRENT_TIMESTAMP 格式一致
+const sqlTimeLayout = "2006-01-02 15:04:05"
+
+func sqlTime(t time.Time) string {
+	return t.UTC().Format(sqlTimeLayout)
+}
+
+func (s *SQLSink) Write(e *AuditLog, line []byte) error {
+	ts, err := time.Parse(time.RFC3339, e.Timestamp)
+	if err != nil {
+		ts = time.Now()
+	}
+	_, err = s.db.Exec(`INSERT INTO audit_events(seq, ts, client_ip, actor, user_agent, method, path, action, target, status, error, prev_hash, hash, raw)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		e.Seq, sqlTime(ts), clip(e.ClientIP, 45), clip(e.Actor, 64), clip(e.UserAgent, 512), clip(e.Method, 10), clip(e.Path, 255),
+		clip(e.Action, 64), clip(e.Target, 255), clip(e.Status, 20), e.Error, e.PrevHash, e.Hash, string(line))
+	return err
+}
+
+// clip 截断索引列以适配列宽（MySQL 严格模式下超长会报错），完整内容保存在 raw 中
+func clip(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	// 避免截断在 UTF-8 多字节字符中间
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func (s *SQLSink) Last() (*AuditLog, error) {
+	var raw string
+	err := s.db.QueryRow(`SELECT raw FROM audit_events ORDER BY seq DESC LIMIT 1`).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var e AuditLog
+	if err := json.Unmarshal([]byte(raw), &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// likeContains 生成包含匹配的 LIKE 参数，配合 ESCAPE '!' 使用
+func likeContains(v string) string {
+	return "%" + strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(v) + "%"
+}
+
+// Query 游标为上一页最后一条日志的 seq
+func (s *SQLSink) Query(q Query) (*Page, error) {
+	q.normalize()
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+	if q.Cursor != "" {
+		seq, err := strconv.ParseUint(q.Cursor, 10, 64)
+		if err != nil || seq == 0 {
+			return nil, ErrInvalidCursor
+		}
+		if q.Desc {
+			add("seq<?", seq)
+		} else {
+			add("seq>?", seq)
+		}
+	}
+	if q.Method != "" {
+		add("method=?", strings.ToUpper(q.Method))
+	}
+	if q.Path != "" {
+		add("path LIKE ? ESCAPE '!'", likeContains(q.Path))
+	}
+	if q.Action != "" {
+		add("action LIKE ? ESCAPE '!'", likeContains(q.Action))
+	}
+	if q.Status != "" {
+		add("status=?", q.Status)
+	}
+	if q.ClientIP != "" {
+		add("client_ip=?", q.ClientIP)
+	}
+	if q.Actor != "" {
+		add("actor=?", q.Actor)
+	}
+	if q.Target != "" {
+		add("target LIKE ? ESCAPE '!'", likeContains(q.Target))
+	}
+	if !q.From.IsZero() {
+		add("ts>=?", sqlTime(q.From))
+	}
+	if !q.To.IsZero() {
+		add("ts<=?", sqlTime(q.To))
+	}
+	stmt := `SELECT seq, raw FROM audit_events`
+	if len(conds) > 0 {
+		stmt += " WHERE " + strings.Join(conds, " AND ")
+	}
+	if q.Desc {
+		stmt += " ORDER BY seq DESC"
+	} else {
+		stmt += " ORDER BY seq"
+	}
+	stmt += " LIMIT ?"
+	args = append(args, q.Limit+1) // 多取一条用于判断是否还有下一页
+
+	rows, err := s.db.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	page := &Page{Items: []AuditLog{}}
+	var lastSeq uint64
+	for rows.Next() {
+		var seq uint64
+		var raw string
+		if err := rows.Scan(&seq, &raw); err != nil {
+			return nil, err
+		}
+		if len(page.Items) == q.Limit {
+			page.NextCursor = strconv.FormatUint(lastSeq, 10)
+			break
+		}
+		var e AuditLog
+		if err := json.Unmarshal([]byte(raw), &e); err != nil {
+			continue
+		}
+		page.Items = append(page.Items, e)
+		lastSeq = seq
+	}
+	return page, rows.Err()
+}
+
+func (s *SQLSink) Verify(key []byte) (*VerifyResult, error) {
+	rows, err := s.db.Query(`SELECT seq, raw FROM audit_events ORDER BY seq`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	v := newChainVerifier(key)
+	for rows.Next() {
+		var seq int
+		var raw string
+		if err := rows.Scan(&seq, &raw); err != nil {
+			return nil, err
+		}
+		if !v.check([]byte(raw), "audit_events", seq) {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return v.result(), nil
+}
+
+// Close 数据库连接由调用方管理
+func (s *SQLSink) Close() error {
+	return nil
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"pxe-manager/database"
+)
+
+// 明文前缀用于区分凭据类型，也便于在日志或代码仓库中扫描泄露
+const (
+	apiKeyPrefix     = "pxk_"
+	enrollmentPrefix = "pxt_"
+)
+
+// touchInterval 为 last_used_at 的最小更新间隔，避免每个请求都写库
+const touchInterval = time.Minute
+
+// DefaultEnrolledKeyTTL 为 Agent 以注册令牌换取的 API 密钥的默认有效期
+const DefaultEnrolledKeyTTL = 90 * 24 * time.Hour
+
+var (
+	// ErrInvalidAPIKey 表示 API 密钥不存在、已吊销或已过期
+	ErrInvalidAPIKey = errors.New("API 密钥无效或已过期")
+	// ErrInvalidEnrollment 表示注册令牌不存在、已吊销、已过期或次数用尽
+	ErrInvalidEnrollment = errors.New("注册令牌无效、已过期或已用尽")
+	// ErrEnrollmentScope 表示注册令牌请求了 Agent 以外的作用域
+	ErrEnrollmentScope = errors.New("注册令牌只能授予 Agent 作用域")
+	// ErrEnrollmentPattern 表示注册令牌的序列号通配模式无效
+	ErrEnrollmentPattern = errors.New("序列号通配模式无效")
+)
+
+// APIKeyManager 负责 API 密钥与注册令牌的签发和校验；只保存凭据的 sha256
+type APIKeyManager struct {
+	store          database.APIKeyStore
+	enrolledKeyTTL time.Duration
+}
+
+func NewAPIKeyManager(store database.APIKeyStore) *APIKeyManager {
+	return &APIKeyManager{store: store, enrolledKeyTTL: DefaultEnrolledKeyTTL}
+}
+
+// SetEnrolledKeyTTL 设置注册换取的 API 密钥有效期，d<=0 时使用默认值
+func (m *APIKeyManager) SetEnrolledKeyTTL(d time.Duration) {
+	if d <= 0 {
+		d = DefaultEnrolledKeyTTL
+	}
+	m.enrolledKeyTTL = d
+}
+
+// agentScopes 返回 scopes 中属于 agent 角色的作用域
+func agentScopes(scopes []string) []string {
+	allowed := permissionsOf([]string{RoleAgent})
+	res := []string{}
+	for _, s := range scopes {
+		if allowed[Permission(s)] {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// IsAPIKey 判断 Bearer 令牌是否为 API 密钥格式
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// newSecret 生成带类型前缀的随机凭据，返回明文、展示前缀与哈希
+func newSecret(prefix string) (string, string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", "", err
+	}
+	secret := prefix + base64.RawURLEncoding.EncodeToString(raw)
+	return secret, secret[:len(prefix)+8], hashSecret(secret), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// expiry ttl<=0 表示永不过期
+func expiry(ttl time.Duration) *time.Time {
+	if ttl <= 0 {
+		return nil
+	}
+	t := time.Now().Add(ttl).UTC().Truncate(time.Second)
+	return &t
+}
+
+// Create 签发 API 密钥，返回只出现一次的明文密钥
+func (m *APIKeyManager) Create(name string, scopes []string, ttl time.Duration, createdBy string) (string, *database.APIKey, error) {
+	secret, prefix, hash, err := newSecret(apiKeyPrefix)
+	if err != nil {
+		return "", nil, err
+	}
+	k := &database.APIKey{
+		Name: name, Prefix: prefix, KeyHash: hash, Scopes: scopes,
+		CreatedBy: createdBy, ExpiresAt: expiry(ttl),
+	}
+	id, err := m.store.CreateAPIKey(k)
+	if err != nil {
+		return "", nil, err
+	}
+	k.ID = int(id)
+	return secret, k, nil
+}
+
+// Authenticate 校验 API 密钥并按间隔更新最近使用时间
+func (m *APIKeyManager) Authenticate(key string) (*database.APIKey, error) {
+	k, err := m.store.GetAPIKeyByHash(hashSecret(key))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if k.Revoked || (k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)) {
+		return nil, ErrInvalidAPIKey
+	}
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= touchInterval {
+		if err := m.store.TouchAPIKey(k.ID, now); err != nil {
+			log.Printf("更新 API 密钥使用时间失败: %v", err)
+		}
+	}
+	return k, nil
+}
+
+// CreateEnrollmentToken 签发可使用 maxUses 次的注册令牌，换取的密钥获得 scopes；
+// 注册令牌面向批量上架的机器，scopes 只能是 agent 角色的权限，否则返回 ErrEnrollmentScope。
+// serialPattern 非空时，凭令牌换取的证书只能绑定与之匹配的服务器序列号
+func (m *APIKeyManager) CreateEnrollmentToken(name string, scopes []string, maxUses int, serialPattern string, ttl time.Duration, createdBy string) (string, *database.EnrollmentToken, error) {
+	allowed := agentScopes(scopes)
+	for _, s := range scopes {
+		if !contains(allowed, s) {
+			return "", nil, fmt.Errorf("%w: %s", ErrEnrollmentScope, s)
+		}
+	}
+	if _, err := path.Match(serialPattern, ""); err != nil {
+		return "", nil, fmt.Errorf("%w: %s", ErrEnrollmentPattern, serialPattern)
+	}
+	secret, prefix, hash, err := newSecret(enrollmentPrefix)
+	if err != nil {
+		return "", nil, err
+	}
+	t := &database.EnrollmentToken{
+		Name: name, Prefix: prefix, TokenHash: hash, Scopes: scopes,
+		MaxUses: maxUses, SerialPattern: serialPattern, CreatedBy: createdBy, ExpiresAt: expiry(ttl),
+	}
+	id, err := m.store.CreateEnrollmentToken(t)
+	if err != nil {
+		return "", nil, err
+	}
+	t.ID = int(id)
+	return secret, t, nil
+}
+
+// ConsumeEnrollment 校验并消耗一次注册令牌
+func (m *APIKeyManager) ConsumeEnrollment(token string) (*database.EnrollmentToken, error) {
+	if !strings.HasPrefix(token, enrollmentPrefix) {
+		return nil, ErrInvalidEnrollment
+	}
+	t, err := m.store.ConsumeEnrollmentToken(hashSecret(token), time.Now())
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrInvalidEnrollment
+	}
+	return t, err
+}
+
+// Enroll 消耗一次注册令牌并为 Agent 签发有效期为 enrolledKeyTTL 的 API 密钥，密钥名为 "<令牌名>/<agent>"。
+// 密钥只继承令牌中的 Agent 作用域，早先签发的带其他作用域的令牌也不会换出高权限密钥
+func (m *APIKeyManager) Enroll(token, agent string) (string, *database.APIKey, error) {
+	t, err := m.ConsumeEnrollment(token)
+	if err != nil {
+		return "", nil, err
+	}
+	scopes := agentScopes(t.Scopes)
+	if len(scopes) == 0 {
+		return "", nil, ErrInvalidEnrollment
+	}
+	return m.Create(t.Name+"/"+agent, scopes, m.enrolledKeyTTL, "enroll:"+t.Name)
+}
+
+// AllowsSerial 判断注册令牌能否为该服务器序列号换取证书
+func AllowsSerial(t *database.EnrollmentToken, serial string) bool {
+	if t.SerialPattern == "" {
+		return true
+	}
+	ok, _ := path.Match(t.SerialPattern, serial)
+	return ok
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
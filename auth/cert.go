@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"crypto/x509"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientCertificate 返回经 CA 校验通过的客户端证书，未提供或未校验时返回 nil
+func ClientCertificate(c *gin.Context) *x509.Certificate {
+	st := c.Request.TLS
+	if st == nil || len(st.VerifiedChains) == 0 || len(st.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return st.VerifiedChains[0][0]
+}
+
+// CertSerials 返回客户端证书绑定的服务器序列号：CN 与全部 DNS SAN
+func CertSerials(cert *x509.Certificate) []string {
+	seen := map[string]bool{}
+	var res []string
+	for _, s := range append([]string{cert.Subject.CommonName}, cert.DNSNames...) {
+		if s != "" && !seen[s] {
+			seen[s] = true
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// certPrincipal 为客户端证书构造主体，只能上报与证书绑定的序列号
+func certPrincipal(cert *x509.Certificate) *Principal {
+	return &Principal{
+		Method: MethodCert,
+		Name:   cert.Subject.CommonName,
+		Roles:  []string{},
+		Scopes: []string{string(PermReportWrite)},
+		perms:  map[Permission]bool{PermReportWrite: true},
+	}
+}
+
+// CertAllowsSerial 判断当前请求能否代表 serial 上报：携带客户端证书时
+// 序列号必须与证书 CN/SAN 之一一致，防止 Agent 冒充其他机器；未携带证书时不限制
+func CertAllowsSerial(c *gin.Context, serial string) bool {
+	cert := ClientCertificate(c)
+	if cert == nil {
+		return true
+	}
+	for _, s := range CertSerials(cert) {
+		if s == serial {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireClientCert 要求请求携带经校验的客户端证书
+func RequireClientCert() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ClientCertificate(c) == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "该接口需要有效的客户端证书"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Web 控制台使用的 Cookie 与请求头
+const (
+	SessionCookie = "pxe_session" // 会话令牌，HttpOnly，脚本不可读
+	CSRFCookie    = "pxe_csrf"    // CSRF 令牌，脚本读取后放入 CSRFHeader
+	CSRFHeader    = "X-CSRF-Token"
+	// OIDCStateCookie 绑定发起 OIDC 登录的浏览器，回调时须与 state 参数一致
+	OIDCStateCookie = "pxe_oidc_state"
+)
+
+// contextSessionToken/contextCookieAuth 保存当前请求使用的会话令牌及其是否来自 Cookie
+const (
+	contextSessionToken = "authSessionToken"
+	contextCookieAuth   = "authCookie"
+)
+
+// SetSecureCookies 设置会话 Cookie 是否带 Secure 属性；HTTPS 直连的请求始终带 Secure
+func (m *SessionManager) SetSecureCookies(secure bool) {
+	m.secureCookies = secure
+}
+
+// CSRFToken 返回与会话绑定的 CSRF 令牌（同步器令牌，由会话 ID 派生，无需落库）
+func (m *SessionManager) CSRFToken(token string) (string, error) {
+	id, err := m.parse(token)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write([]byte("csrf." + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// SetCookies 写入会话 Cookie（HttpOnly）与 CSRF Cookie，两者均为 SameSite=Strict，
+// 返回 CSRF 令牌供登录响应一并返回
+func (m *SessionManager) SetCookies(c *gin.Context, token string, expires time.Time) (string, error) {
+	csrf, err := m.CSRFToken(token)
+	if err != nil {
+		return "", err
+	}
+	m.setCookie(c, SessionCookie, token, expires, true, http.SameSiteStrictMode)
+	m.setCookie(c, CSRFCookie, csrf, expires, false, http.SameSiteStrictMode)
+	return csrf, nil
+}
+
+// ClearCookies 删除会话与 CSRF Cookie
+func (m *SessionManager) ClearCookies(c *gin.Context) {
+	m.setCookie(c, SessionCookie, "", time.Unix(0, 0), true, http.SameSiteStrictMode)
+	m.setCookie(c, CSRFCookie, "", time.Unix(0, 0), false, http.SameSiteStrictMode)
+}
+
+// SetOIDCState 写入 OIDC 登录的 state Cookie（HttpOnly）。身份源回调是跨站跳转，
+// SameSite=Strict 的 Cookie 不会随之发送，因此使用 Lax
+func (m *SessionManager) SetOIDCState(c *gin.Context, state string) {
+	m.setCookie(c, OIDCStateCookie, state, time.Now().Add(oidcStateTTL), true, http.SameSiteLaxMode)
+}
+
+// TakeOIDCState 读取并清除 state Cookie，不存在时返回空串
+func (m *SessionManager) TakeOIDCState(c *gin.Context) string {
+	state, err := c.Cookie(OIDCStateCookie)
+	if err != nil {
+		return ""
+	}
+	m.setCookie(c, OIDCStateCookie, "", time.Unix(0, 0), true, http.SameSiteLaxMode)
+	return state
+}
+
+func (m *SessionManager) setCookie(c *gin.Context, name, value string, expires time.Time, httpOnly bool, sameSite http.SameSite) {
+	ck := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: httpOnly,
+		Secure:   m.secureCookies || c.Request.TLS != nil,
+		SameSite: sameSite,
+	}
+	if value == "" {
+		ck.MaxAge = -1
+	}
+	http.SetCookie(c.Writer, ck)
+}
+
+// SessionToken 返回当前请求认证所用的会话令牌（Bearer 或 Cookie），未使用会话时为空
+func SessionToken(c *gin.Context) string {
+	return c.GetString(contextSessionToken)
+}
+
+// CookieAuthenticated 判断当前请求是否凭会话 Cookie 认证
+func CookieAuthenticated(c *gin.Context) bool {
+	return c.GetBool(contextCookieAuth)
+}
+
+// CSRFMiddleware 对凭 Cookie 认证的写请求校验 X-CSRF-Token。
+// Bearer 令牌、API 密钥、客户端证书不会被浏览器自动携带，无需校验。
+func CSRFMiddleware(sessions *SessionManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if !CookieAuthenticated(c) {
+			c.Next()
+			return
+		}
+		want, err := sessions.CSRFToken(SessionToken(c))
+		got := c.GetHeader(CSRFHeader)
+		if err != nil || got == "" || !hmac.Equal([]byte(got), []byte(want)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "CSRF 校验失败"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"errors"
+	"reflect"
+
+	"pxe-manager/database"
+)
+
+// ErrUserSourceConflict 表示用户名已被其他来源的账号占用
+var ErrUserSourceConflict = errors.New("用户名已被其他来源的账号占用")
+
+// ErrUserDisabled 表示账号已被禁用
+var ErrUserDisabled = errors.New("账号已被禁用")
+
+// ErrNoRoles 表示外部身份未映射到任何角色
+var ErrNoRoles = errors.New("该账号未映射到任何角色")
+
+// SyncExternalUser 为外部身份源（OIDC/LDAP）登录的用户创建或更新本地账号，
+// 每次登录以身份源映射的角色覆盖本地角色。同名的其他来源账号不会被接管。
+func SyncExternalUser(users database.UserStore, source, username string, roles []string) (*database.User, error) {
+	u, err := users.GetUserByUsername(username)
+	if errors.Is(err, database.ErrNotFound) {
+		nu := &database.User{Username: username, Source: source, Roles: roles}
+		id, err := users.CreateUser(nu)
+		if errors.Is(err, database.ErrUserExists) {
+			// 并发首次登录，按已存在处理
+			return SyncExternalUser(users, source, username, roles)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return users.GetUserByID(int(id))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.Source != source {
+		return nil, ErrUserSourceConflict
+	}
+	if u.Disabled {
+		return nil, ErrUserDisabled
+	}
+	if !reflect.DeepEqual(u.Roles, roles) {
+		if err := users.SetUserRoles(u.ID, roles); err != nil {
+			return nil, err
+		}
+		u.Roles = roles
+	}
+	return u, nil
+}
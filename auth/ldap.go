@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"pxe-manager/config"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrLDAPUnavailable 表示无法连接目录服务或查询失败（区别于凭据错误）
+var ErrLDAPUnavailable = errors.New("LDAP 目录服务不可用")
+
+// ldapCacheEntry 缓存一次成功认证的结果；只保存密码的 HMAC，不保存明文
+type ldapCacheEntry struct {
+	mac     []byte
+	roles   []string
+	expires time.Time
+}
+
+// LDAPAuthenticator 通过 LDAP 简单绑定校验用户名密码，并将所属组映射为角色。
+// 先（以服务账号或匿名）查找用户 DN，再以用户 DN 和密码绑定；
+// 成功结果按 CacheTTL 缓存，缓存期内目录中的禁用或组变更不会立即生效。
+type LDAPAuthenticator struct {
+	cfg      config.LDAPConfig
+	timeout  time.Duration
+	cacheTTL time.Duration
+	cacheKey []byte
+
+	mu    sync.Mutex
+	cache map[string]ldapCacheEntry
+}
+
+func NewLDAPAuthenticator(cfg config.LDAPConfig, timeout, cacheTTL time.Duration) *LDAPAuthenticator {
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid=%s)"
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = "memberOf"
+	}
+	if cfg.GroupFilter == "" {
+		cfg.GroupFilter = "(member=%s)"
+	}
+	if cfg.GroupNameAttribute == "" {
+		cfg.GroupNameAttribute = "cn"
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return &LDAPAuthenticator{
+		cfg:      cfg,
+		timeout:  timeout,
+		cacheTTL: cacheTTL,
+		cacheKey: key,
+		cache:    map[string]ldapCacheEntry{},
+	}
+}
+
+func (a *LDAPAuthenticator) passwordMAC(username, password string) []byte {
+	h := hmac.New(sha256.New, a.cacheKey)
+	h.Write([]byte(username))
+	h.Write([]byte{0})
+	h.Write([]byte(password))
+	return h.Sum(nil)
+}
+
+// Authenticate 校验凭据并返回映射后的角色。
+// 凭据错误返回 ErrInvalidCredentials，未映射到角色返回 ErrNoRoles，目录不可用返回 ErrLDAPUnavailable。
+func (a *LDAPAuthenticator) Authenticate(username, password string) ([]string, error) {
+	// 空密码在 LDAP 中是“未认证绑定”，服务端会返回成功，必须拒绝
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	mac := a.passwordMAC(username, password)
+	if roles, ok := a.cached(username, mac); ok {
+		return roles, nil
+	}
+
+	groups, err := a.bindAndGroups(username, password)
+	if err != nil {
+		return nil, err
+	}
+	roles := MapRoles(groups, a.cfg.RoleMapping, a.cfg.DefaultRoles)
+	if len(roles) == 0 {
+		return nil, ErrNoRoles
+	}
+	if a.cacheTTL > 0 {
+		a.mu.Lock()
+		now := time.Now()
+		for k, e := range a.cache {
+			if now.After(e.expires) {
+				delete(a.cache, k)
+			}
+		}
+		a.cache[username] = ldapCacheEntry{mac: mac, roles: roles, expires: now.Add(a.cacheTTL)}
+		a.mu.Unlock()
+	}
+	return roles, nil
+}
+
+func (a *LDAPAuthenticator) cached(username string, mac []byte) ([]string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e, ok := a.cache[username]
+	if !ok || time.Now().After(e.expires) || !hmac.Equal(e.mac, mac) {
+		return nil, false
+	}
+	return append([]string(nil), e.roles...), true
+}
+
+// Forget 清除某个用户的缓存结果（空用户名清除全部）
+func (a *LDAPAuthenticator) Forget(username string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if username == "" {
+		a.cache = map[string]ldapCacheEntry{}
+		return
+	}
+	delete(a.cache, username)
+}
+
+func (a *LDAPAuthenticator) dial() (*ldap.Conn, error) {
+	tlsCfg := &tls.Config{InsecureSkipVerify: a.cfg.InsecureSkipVerify}
+	conn, err := ldap.DialURL(a.cfg.URL, ldap.DialWithTLSConfig(tlsCfg), ldap.DialWithDialer(&net.Dialer{Timeout: a.timeout}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(a.timeout)
+	if a.cfg.StartTLS {
+		if err := conn.StartTLS(tlsCfg); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// bindAndGroups 查找用户 DN、以用户身份绑定并返回所属组（组 DN 与组名）
+func (a *LDAPAuthenticator) bindAndGroups(username, password string) ([]string, error) {
+	conn, err := a.dial()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLDAPUnavailable, err)
+	}
+	defer conn.Close()
+
+	if a.cfg.BindDN != "" {
+		if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("%w: 服务账号绑定失败: %v", ErrLDAPUnavailable, err)
+		}
+	}
+	res, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.UserBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(a.timeout.Seconds()), false,
+		fmt.Sprintf(a.cfg.UserFilter, ldap.EscapeFilter(username)),
+		[]string{"dn", a.cfg.GroupAttribute}, nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("%w: 查找用户失败: %v", ErrLDAPUnavailable, err)
+	}
+	// 用户不存在或不唯一均视为凭据错误，不向调用方区分
+	if res == nil || len(res.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := res.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("%w: 用户绑定失败: %v", ErrLDAPUnavailable, err)
+	}
+
+	var groups []string
+	for _, dn := range entry.GetAttributeValues(a.cfg.GroupAttribute) {
+		groups = append(groups, groupNames(dn, a.cfg.GroupBaseDN)...)
+	}
+	if a.cfg.GroupBaseDN != "" {
+		// 以服务账号身份查找组；未配置服务账号时以用户身份查找
+		if a.cfg.BindDN != "" {
+			if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+				return nil, fmt.Errorf("%w: 服务账号绑定失败: %v", ErrLDAPUnavailable, err)
+			}
+		}
+		gres, err := conn.Search(ldap.NewSearchRequest(
+			a.cfg.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(a.timeout.Seconds()), false,
+			fmt.Sprintf(a.cfg.GroupFilter, ldap.EscapeFilter(entry.DN)),
+			[]string{a.cfg.GroupNameAttribute}, nil,
+		))
+		if err != nil {
+			return nil, fmt.Errorf("%w: 查找用户组失败: %v", ErrLDAPUnavailable, err)
+		}
+		for _, g := range gres.Entries {
+			groups = append(groups, g.DN)
+			groups = append(groups, g.GetAttributeValues(a.cfg.GroupNameAttribute)...)
+		}
+	}
+	return groups, nil
+}
+
+// groupNames 返回组 DN 本身；组位于 group_base_dn 之下时另返回其首个 RDN 的值
+// （如 cn=ops,ou=groups → "ops"），便于 role_mapping 使用简短组名。
+// 目录中其他位置的同名组（可能由普通用户创建）只能以完整 DN 匹配
+func groupNames(dn, baseDN string) []string {
+	names := []string{dn}
+	if baseDN == "" {
+		return names
+	}
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+		return names
+	}
+	base, err := ldap.ParseDN(baseDN)
+	if err != nil || !base.AncestorOfFold(parsed) {
+		return names
+	}
+	return append(names, parsed.RDNs[0].Attributes[0].Value)
+}
+
+// NormalizeLDAPUsername 统一用户名大小写与空白，LDAP 属性匹配通常不区分大小写
+func NormalizeLDAPUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"pxe-manager/auth/ldaptest"
+	"pxe-manager/config"
+)
+
+const testGroupBase = "ou=groups,dc=example,dc=com"
+
+func newTestLDAP(t *testing.T, cfg config.LDAPConfig, cacheTTL time.Duration) (*LDAPAuthenticator, *ldaptest.Server) {
+	t.Helper()
+	srv, err := ldaptest.NewServer(
+		ldaptest.Entry{
+			DN:       "uid=alice,ou=people,dc=example,dc=com",
+			Password: "alice-pw",
+			Attrs: map[string][]string{
+				"uid":      {"alice"},
+				"memberOf": {"cn=ops,ou=groups,dc=example,dc=com"},
+			},
+		},
+		ldaptest.Entry{
+			DN:       "uid=bob,ou=people,dc=example,dc=com",
+			Password: "bob-pw",
+			Attrs:    map[string][]string{"uid": {"bob"}},
+		},
+		ldaptest.Entry{
+			DN:       "uid=mallory,ou=people,dc=example,dc=com",
+			Password: "mallory-pw",
+			Attrs: map[string][]string{
+				"uid":      {"mallory"},
+				"memberOf": {"cn=ops,ou=self-service,dc=example,dc=com"},
+			},
+		},
+		ldaptest.Entry{
+			DN: "cn=auditors,ou=groups,dc=example,dc=com",
+			Attrs: map[string][]string{
+				"cn":     {"auditors"},
+				"member": {"uid=bob,ou=people,dc=example,dc=com"},
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	cfg.URL = srv.URL()
+	cfg.UserBaseDN = "ou=people,dc=example,dc=com"
+	if cfg.RoleMapping == nil {
+		cfg.RoleMapping = map[string][]string{
+			"ops": {RoleOperator},
+			"cn=auditors,ou=groups,dc=example,dc=com": {RoleAuditor},
+		}
+	}
+	return NewLDAPAuthenticator(cfg, 2*time.Second, cacheTTL), srv
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	a, _ := newTestLDAP(t, config.LDAPConfig{GroupBaseDN: testGroupBase}, 0)
+	roles, err := a.Authenticate("alice", "alice-pw")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if !reflect.DeepEqual(roles, []string{RoleOperator}) {
+		t.Fatalf("roles = %v", roles)
+	}
+	if _, err := a.Authenticate("alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong password: err = %v", err)
+	}
+	if _, err := a.Authenticate("nobody", "alice-pw"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("unknown user: err = %v", err)
+	}
+}
+
+func TestLDAPRejectsEmptyPassword(t *testing.T) {
+	a, srv := newTestLDAP(t, config.LDAPConfig{}, 0)
+	// 目录对空密码的绑定返回成功（未认证绑定），必须在发起绑定前拒绝
+	if _, err := a.Authenticate("alice", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+	}
+	if n := srv.Binds(); n != 0 {
+		t.Fatalf("binds = %d, want 0", n)
+	}
+}
+
+func TestLDAPEscapesFilter(t *testing.T) {
+	a, srv := newTestLDAP(t, config.LDAPConfig{}, 0)
+	// 仅保留 alice 可被 (uid=*) 匹配
+	srv.Add(ldaptest.Entry{DN: "uid=bob,ou=people,dc=example,dc=com"})
+	srv.Add(ldaptest.Entry{DN: "uid=mallory,ou=people,dc=example,dc=com"})
+	// 未转义时 (uid=*) 会匹配唯一的 alice，从而以 alice 的身份登录
+	if _, err := a.Authenticate("*", "alice-pw"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := a.Authenticate("alice)(uid=*", "alice-pw"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestLDAPGroupRoles(t *testing.T) {
+	a, _ := newTestLDAP(t, config.LDAPConfig{GroupBaseDN: testGroupBase}, 0)
+	roles, err := a.Authenticate("bob", "bob-pw")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if !reflect.DeepEqual(roles, []string{RoleAuditor}) {
+		t.Fatalf("roles = %v", roles)
+	}
+
+	a, _ = newTestLDAP(t, config.LDAPConfig{}, 0)
+	if _, err := a.Authenticate("bob", "bob-pw"); !errors.Is(err, ErrNoRoles) {
+		t.Fatalf("unmapped user: err = %v, want ErrNoRoles", err)
+	}
+	a, _ = newTestLDAP(t, config.LDAPConfig{DefaultRoles: []string{RoleViewer}}, 0)
+	if roles, err := a.Authenticate("bob", "bob-pw"); err != nil || !reflect.DeepEqual(roles, []string{RoleViewer}) {
+		t.Fatalf("default roles = %v, %v", roles, err)
+	}
+}
+
+// 简短组名只对 group_base_dn 下的组生效，目录其他位置的同名组不能借此获得角色
+func TestLDAPShortGroupNameRequiresBase(t *testing.T) {
+	a, _ := newTestLDAP(t, config.LDAPConfig{GroupBaseDN: testGroupBase}, 0)
+	if _, err := a.Authenticate("mallory", "mallory-pw"); !errors.Is(err, ErrNoRoles) {
+		t.Fatalf("group outside base: err = %v, want ErrNoRoles", err)
+	}
+	// 未配置 group_base_dn 时只按完整 DN 匹配
+	a, _ = newTestLDAP(t, config.LDAPConfig{}, 0)
+	if _, err := a.Authenticate("alice", "alice-pw"); !errors.Is(err, ErrNoRoles) {
+		t.Fatalf("short name without base: err = %v, want ErrNoRoles", err)
+	}
+	a, _ = newTestLDAP(t, config.LDAPConfig{RoleMapping: map[string][]string{
+		"cn=ops,ou=groups,dc=example,dc=com": {RoleOperator},
+	}}, 0)
+	if roles, err := a.Authenticate("alice", "alice-pw"); err != nil || !reflect.DeepEqual(roles, []string{RoleOperator}) {
+		t.Fatalf("full DN = %v, %v", roles, err)
+	}
+}
+
+func TestLDAPCache(t *testing.T) {
+	const ttl = 200 * time.Millisecond
+	a, srv := newTestLDAP(t, config.LDAPConfig{GroupBaseDN: testGroupBase}, ttl)
+	if _, err := a.Authenticate("alice", "alice-pw"); err != nil {
+		t.Fatal(err)
+	}
+	binds := srv.Binds()
+	if _, err := a.Authenticate("alice", "alice-pw"); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Binds(); n != binds {
+		t.Fatalf("cache miss: binds %d → %d", binds, n)
+	}
+	// 缓存只对相同密码生效
+	if _, err := a.Authenticate("alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong password: err = %v", err)
+	}
+	binds = srv.Binds()
+
+	time.Sleep(ttl + 50*time.Millisecond)
+	if _, err := a.Authenticate("alice", "alice-pw"); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Binds(); n == binds {
+		t.Fatal("expired entry served from cache")
+	}
+}
+
+func TestLDAPUnavailable(t *testing.T) {
+	a, srv := newTestLDAP(t, config.LDAPConfig{}, 0)
+	srv.Close()
+	if _, err := a.Authenticate("alice", "alice-pw"); !errors.Is(err, ErrLDAPUnavailable) {
+		t.Fatalf("err = %v, want ErrLDAPUnavailable", err)
+	}
+}
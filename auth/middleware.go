@@ -1,34 +1,103 @@
 package auth
 
 import (
+	"crypto/subtle"
+	"errors"
 	"net/http"
 	"strings"
 
-	"pxe-manager/utils"
-
 	"github.com/gin-gonic/gin"
 )
 
-// Middleware 实现白名单优先 + Bearer 认证
-func Middleware(sec *SecurityConfig) gin.HandlerFunc {
+// Middleware 实现 Bearer 认证；Bearer 可以是共享令牌、API 密钥或登录会话令牌。
+// 携带有效令牌时优先识别身份；未携带 Bearer 时接受 Web 控制台的会话 Cookie（写请求需另经 CSRFMiddleware 校验）；
+// 其次为经校验的客户端证书（仅可上报）；
+// 未携带或令牌无效的白名单 IP 以无权限主体继续，只能访问以 RequireOrWhitelisted 声明的路由。
+func Middleware(sec *SecurityConfig, sessions *SessionManager, keys *APIKeyManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		clientIP := c.ClientIP()
-		// 白名单 IP 直接放行
-		if utils.IsIPInWhitelist(clientIP, sec.WhitelistIPs) {
+		token, hasToken := BearerToken(c)
+		if hasToken {
+			if sec.AuthToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(sec.AuthToken)) == 1 {
+				SetPrincipal(c, newPrincipal(MethodToken, "token", nil, sec.TokenRoles))
+				c.Next()
+				return
+			}
+			if keys != nil && IsAPIKey(token) {
+				k, err := keys.Authenticate(token)
+				if err == nil {
+					SetPrincipal(c, KeyPrincipal(k))
+					c.Next()
+					return
+				}
+				if !errors.Is(err, ErrInvalidAPIKey) {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "认证失败"})
+					c.Abort()
+					return
+				}
+			} else if sessions != nil {
+				ok, failed := authenticateSession(c, sessions, token)
+				if failed {
+					return
+				}
+				if ok {
+					c.Next()
+					return
+				}
+			}
+		} else if token, err := c.Cookie(SessionCookie); err == nil && token != "" && sessions != nil {
+			hasToken = true
+			ok, failed := authenticateSession(c, sessions, token)
+			if failed {
+				return
+			}
+			if ok {
+				c.Set(contextCookieAuth, true)
+				c.Next()
+				return
+			}
+		}
+		if cert := ClientCertificate(c); cert != nil {
+			SetPrincipal(c, certPrincipal(cert))
 			c.Next()
 			return
 		}
-		token := c.GetHeader("Authorization")
-		if !strings.HasPrefix(token, "Bearer ") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供认证令牌"})
-			c.Abort()
+		// 白名单 IP 暂不授予权限，由路由的 RequireOrWhitelisted 决定是否豁免
+		if clientIP := c.ClientIP(); sec.Whitelist.Contains(clientIP) {
+			SetPrincipal(c, whitelistPrincipal(clientIP, ""))
+			c.Next()
 			return
 		}
-		if strings.TrimPrefix(token, "Bearer ") != sec.AuthToken {
+		if !hasToken {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供认证令牌"})
+		} else {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的认证令牌"})
-			c.Abort()
-			return
 		}
-		c.Next()
+		c.Abort()
+	}
+}
+
+// authenticateSession 校验会话令牌并写入主体；failed 表示已返回 500 并中止请求
+func authenticateSession(c *gin.Context, sessions *SessionManager, token string) (ok, failed bool) {
+	u, _, err := sessions.Authenticate(token)
+	if err == nil {
+		SetPrincipal(c, UserPrincipal(u))
+		c.Set(contextSessionToken, token)
+		return true, false
+	}
+	if !errors.Is(err, ErrInvalidSession) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "认证失败"})
+		c.Abort()
+		return false, true
+	}
+	return false, false
+}
+
+// BearerToken 从 Authorization 头中取出 Bearer 令牌
+func BearerToken(c *gin.Context) (string, bool) {
+	h := c.GetHeader("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return "", false
 	}
+	token := strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	return token, token != ""
 }
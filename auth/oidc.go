@@ -0,0 +1,418 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"pxe-manager/config"
+)
+
+var (
+	// ErrOIDCState 表示回调的 state 不存在或已过期（可能是重放或登录超时）
+	ErrOIDCState = errors.New("OIDC 登录状态无效或已过期")
+	// ErrOIDCToken 表示 ID Token 校验失败
+	ErrOIDCToken = errors.New("OIDC ID Token 校验失败")
+)
+
+const (
+	oidcStateTTL  = 10 * time.Minute
+	oidcClockSkew = time.Minute
+	// oidcMaxPending 为未回调登录的上限，超出时淘汰最早发起的登录
+	oidcMaxPending = 1024
+)
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcPending 为已发起但尚未回调的登录
+type oidcPending struct {
+	nonce    string
+	verifier string // PKCE code_verifier
+	created  time.Time
+}
+
+// OIDCProvider 实现 OIDC 授权码流程（PKCE + nonce），ID Token 使用 RS256 + JWKS 校验。
+// 发现文档与 JWKS 在首次登录时拉取并缓存，身份源暂时不可用不影响服务启动。
+type OIDCProvider struct {
+	cfg    config.OIDCConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+	pending   map[string]oidcPending // state → 登录上下文
+}
+
+func NewOIDCProvider(cfg config.OIDCConfig) *OIDCProvider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "preferred_username"
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	return &OIDCProvider{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		pending: map[string]oidcPending{},
+	}
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthURL 生成跳转到身份源的授权地址并记录 state/nonce/PKCE，返回地址与 state；
+// 调用方需将 state 绑定到发起登录的浏览器（见 SessionManager.SetOIDCState）
+func (p *OIDCProvider) AuthURL(ctx context.Context) (string, string, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	state, err := randomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString(48)
+	if err != nil {
+		return "", "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	p.mu.Lock()
+	now := time.Now()
+	p.prunePending(now)
+	p.pending[state] = oidcPending{nonce: nonce, verifier: verifier, created: now}
+	p.mu.Unlock()
+
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), state, nil
+}
+
+// prunePending 删除过期的登录，并在达到上限时淘汰最早的登录；调用方需持有锁
+func (p *OIDCProvider) prunePending(now time.Time) {
+	for k, v := range p.pending {
+		if now.Sub(v.created) > oidcStateTTL {
+			delete(p.pending, k)
+		}
+	}
+	for len(p.pending) >= oidcMaxPending {
+		var oldest string
+		var oldestAt time.Time
+		for k, v := range p.pending {
+			if oldest == "" || v.created.Before(oldestAt) {
+				oldest, oldestAt = k, v.created
+			}
+		}
+		delete(p.pending, oldest)
+	}
+}
+
+// Exchange 校验 state 并用授权码换取 ID Token，返回校验通过的声明
+func (p *OIDCProvider) Exchange(ctx context.Context, code, state string) (map[string]interface{}, error) {
+	p.mu.Lock()
+	pend, ok := p.pending[state]
+	delete(p.pending, state) // state 只能使用一次
+	p.mu.Unlock()
+	if !ok || time.Since(pend.created) > oidcStateTTL {
+		return nil, ErrOIDCState
+	}
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {pend.verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求 OIDC token 端点失败: %w", err)
+	}
+	defer resp.Body.Close()
+	var tok struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tok); err != nil {
+		return nil, fmt.Errorf("解析 OIDC token 响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tok.Error != "" {
+		return nil, fmt.Errorf("OIDC token 端点返回错误: %s %s", tok.Error, tok.ErrorDescription)
+	}
+	if tok.IDToken == "" {
+		return nil, fmt.Errorf("%w: 响应中缺少 id_token", ErrOIDCToken)
+	}
+	return p.verifyIDToken(ctx, tok.IDToken, pend.nonce)
+}
+
+// verifyIDToken 校验签名（仅 RS256）、iss、aud、exp 与 nonce
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, raw, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: 格式错误", ErrOIDCToken)
+	}
+	var hdr struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return nil, fmt.Errorf("%w: 头部无法解析", ErrOIDCToken)
+	}
+	if hdr.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: 不支持的签名算法 %q", ErrOIDCToken, hdr.Alg)
+	}
+	key, err := p.key(ctx, hdr.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: 签名无法解析", ErrOIDCToken)
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig); err != nil {
+		return nil, fmt.Errorf("%w: 签名无效", ErrOIDCToken)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: 声明无法解析", ErrOIDCToken)
+	}
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if iss, _ := claims["iss"].(string); iss != d.Issuer {
+		return nil, fmt.Errorf("%w: iss 不匹配", ErrOIDCToken)
+	}
+	if !audienceContains(claims["aud"], p.cfg.ClientID) {
+		return nil, fmt.Errorf("%w: aud 不匹配", ErrOIDCToken)
+	}
+	now := time.Now()
+	exp, ok := numericClaim(claims["exp"])
+	if !ok || now.After(time.Unix(exp, 0).Add(oidcClockSkew)) {
+		return nil, fmt.Errorf("%w: 已过期", ErrOIDCToken)
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, fmt.Errorf("%w: nonce 不匹配", ErrOIDCToken)
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func numericClaim(v interface{}) (int64, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	if i, err := n.Int64(); err == nil {
+		return i, true
+	}
+	f, err := n.Float64()
+	return int64(f), err == nil
+}
+
+// Identity 从声明中取出用户名并按 role_claim 映射角色
+func (p *OIDCProvider) Identity(claims map[string]interface{}) (string, []string, error) {
+	username, _ := claims[p.cfg.UsernameClaim].(string)
+	if username == "" || len(username) > 64 {
+		return "", nil, fmt.Errorf("%w: 缺少有效的 %s 声明", ErrOIDCToken, p.cfg.UsernameClaim)
+	}
+	var values []string
+	switch v := claims[p.cfg.RoleClaim].(type) {
+	case string:
+		values = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	roles := MapRoles(values, p.cfg.RoleMapping, p.cfg.DefaultRoles)
+	if len(roles) == 0 {
+		return "", nil, ErrNoRoles
+	}
+	return username, roles, nil
+}
+
+// MapRoles 将外部身份源的组/声明值映射为角色，未匹配时使用 defaults；未知角色忽略
+func MapRoles(values []string, mapping map[string][]string, defaults []string) []string {
+	var roles []string
+	for _, v := range values {
+		roles = append(roles, mapping[v]...)
+	}
+	if len(roles) == 0 {
+		roles = defaults
+	}
+	var valid []string
+	for _, r := range roles {
+		if IsValidRole(r) {
+			valid = append(valid, r)
+		}
+	}
+	res, _ := NormalizeRoles(valid)
+	return res
+}
+
+func (p *OIDCProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	d := p.discovery
+	p.mu.Unlock()
+	if d != nil {
+		return d, nil
+	}
+	var doc oidcDiscovery
+	if err := p.getJSON(ctx, p.cfg.Issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("获取 OIDC 发现文档失败: %w", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("OIDC 发现文档 issuer 不匹配: %s", doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("OIDC 发现文档缺少必要端点")
+	}
+	p.mu.Lock()
+	p.discovery = &doc
+	p.mu.Unlock()
+	return &doc, nil
+}
+
+// key 返回 kid 对应的公钥；未知 kid 时重新拉取 JWKS 以支持密钥轮换。
+// ID Token 只来自 token 端点的响应而非客户端输入，因此无需限制拉取频率。
+func (p *OIDCProvider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	k, ok := p.keys[kid]
+	p.mu.Unlock()
+	if ok {
+		return k, nil
+	}
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("获取 OIDC JWKS 失败: %w", err)
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		n, err1 := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err1 != nil || err2 != nil || len(e) > 4 {
+			continue
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+	if k, ok := keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("%w: 未知的签名密钥 %q", ErrOIDCToken, kid)
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"pxe-manager/auth/oidctest"
+	"pxe-manager/config"
+)
+
+const testRedirectURL = "https://pxe.example.com/api/auth/oidc/callback"
+
+func newTestOIDC(t *testing.T) (*OIDCProvider, *oidctest.Issuer) {
+	t.Helper()
+	iss := oidctest.NewIssuer("pxe-manager", "s3cret")
+	t.Cleanup(iss.Close)
+	iss.SetClaims(map[string]interface{}{"preferred_username": "alice", "groups": []string{"ops"}})
+	p := NewOIDCProvider(config.OIDCConfig{
+		Issuer:       iss.URL() + "/",
+		ClientID:     "pxe-manager",
+		ClientSecret: "s3cret",
+		RedirectURL:  testRedirectURL,
+		RoleClaim:    "groups",
+		RoleMapping:  map[string][]string{"ops": {RoleOperator}},
+	})
+	return p, iss
+}
+
+// authorize 走完 AuthURL → 身份源授权，返回授权码与 state
+func authorize(t *testing.T, p *OIDCProvider) (string, string) {
+	t.Helper()
+	u, state, err := p.AuthURL(context.Background())
+	if err != nil {
+		t.Fatalf("AuthURL: %v", err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(u)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d location %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if got := loc.Query().Get("state"); got != state {
+		t.Fatalf("state = %q, want %q", got, state)
+	}
+	return loc.Query().Get("code"), state
+}
+
+func login(t *testing.T, p *OIDCProvider) (map[string]interface{}, error) {
+	t.Helper()
+	code, state := authorize(t, p)
+	return p.Exchange(context.Background(), code, state)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	p, _ := newTestOIDC(t)
+	claims, err := login(t, p)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	username, roles, err := p.Identity(claims)
+	if err != nil {
+		t.Fatalf("Identity: %v", err)
+	}
+	if username != "alice" || !reflect.DeepEqual(roles, []string{RoleOperator}) {
+		t.Fatalf("Identity = %q %v", username, roles)
+	}
+}
+
+func TestOIDCRejectsInvalidClaims(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+	}{
+		{"bad nonce", map[string]interface{}{"nonce": "forged"}},
+		{"wrong aud", map[string]interface{}{"aud": "other-client"}},
+		{"wrong iss", map[string]interface{}{"iss": "https://evil.example.com"}},
+		{"expired", map[string]interface{}{"exp": time.Now().Add(-2 * oidcClockSkew).Unix()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, iss := newTestOIDC(t)
+			tt.claims["preferred_username"] = "alice"
+			iss.SetClaims(tt.claims)
+			if _, err := login(t, p); !errors.Is(err, ErrOIDCToken) {
+				t.Fatalf("err = %v, want ErrOIDCToken", err)
+			}
+		})
+	}
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	p, iss := newTestOIDC(t)
+	if _, err := login(t, p); err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	// 新 kid 不在缓存中，应重新拉取 JWKS
+	iss.RotateKey()
+	if _, err := login(t, p); err != nil {
+		t.Fatalf("login after RotateKey: %v", err)
+	}
+
+	// JWKS 中不存在的 kid 必须拒绝
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := oidctest.Sign(key, "unknown", map[string]interface{}{
+		"iss": iss.URL(), "aud": "pxe-manager", "exp": time.Now().Add(time.Minute).Unix(), "nonce": "n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.verifyIDToken(context.Background(), raw, "n"); !errors.Is(err, ErrOIDCToken) {
+		t.Fatalf("unknown kid: err = %v, want ErrOIDCToken", err)
+	}
+}
+
+func TestOIDCCodeAndStateSingleUse(t *testing.T) {
+	p, _ := newTestOIDC(t)
+	code, state := authorize(t, p)
+	if _, err := p.Exchange(context.Background(), code, state); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if _, err := p.Exchange(context.Background(), code, state); !errors.Is(err, ErrOIDCState) {
+		t.Fatalf("reused state: err = %v, want ErrOIDCState", err)
+	}
+	// 新的登录上下文配合已用过的授权码，应被身份源拒绝
+	_, state2 := authorize(t, p)
+	if _, err := p.Exchange(context.Background(), code, state2); err == nil {
+		t.Fatal("reused code accepted")
+	}
+}
+
+func TestOIDCPendingCap(t *testing.T) {
+	p, _ := newTestOIDC(t)
+	code, first := authorize(t, p)
+	for i := 0; i < oidcMaxPending; i++ {
+		if _, _, err := p.AuthURL(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(p.pending); n > oidcMaxPending {
+		t.Fatalf("pending = %d, want <= %d", n, oidcMaxPending)
+	}
+	if _, err := p.Exchange(context.Background(), code, first); !errors.Is(err, ErrOIDCState) {
+		t.Fatalf("evicted state: err = %v, want ErrOIDCState", err)
+	}
+}
+
+func TestOIDCIssuerUnavailable(t *testing.T) {
+	p, iss := newTestOIDC(t)
+	iss.Close()
+	if _, _, err := p.AuthURL(context.Background()); err == nil {
+		t.Fatal("AuthURL succeeded with issuer down")
+	}
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"errors"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength 为账号密码的最小长度
+const MinPasswordLength = 8
+
+// ErrWeakPassword 表示密码不满足最小长度
+var ErrWeakPassword = errors.New("密码长度至少 8 位")
+
+// HashPassword 使用 bcrypt 计算密码哈希
+func HashPassword(password string) (string, error) {
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		return "", ErrWeakPassword
+	}
+	// bcrypt 只使用前 72 字节，超出部分直接拒绝以免产生误解
+	if len(password) > 72 {
+		return "", errors.New("密码长度不能超过 72 字节")
+	}
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// CheckPassword 校验密码与 bcrypt 哈希是否匹配
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"pxe-manager/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 认证方式
+const (
+	MethodSession   = "session"   // 账号登录会话
+	MethodToken     = "token"     // 共享令牌 PXE_AUTH_TOKEN
+	MethodWhitelist = "whitelist" // IP 白名单
+	MethodAPIKey    = "apikey"    // 带作用域的 API 密钥
+	MethodCert      = "cert"      // 经 CA 校验的客户端证书（mTLS）
+)
+
+// contextPrincipal 为 gin 上下文中保存当前主体的键
+const contextPrincipal = "authPrincipal"
+
+// Principal 为通过认证的调用方及其角色
+type Principal struct {
+	Method string         `json:"method"`
+	Name   string         `json:"name"` // 用户名；共享令牌为 "token"，白名单为客户端 IP，API 密钥为密钥名，客户端证书为 CN
+	User   *database.User `json:"-"`    // 仅会话登录时存在
+	Roles  []string       `json:"roles"`
+	Scopes []string       `json:"scopes,omitempty"` // 仅 API 密钥，直接对应权限
+
+	perms map[Permission]bool
+}
+
+func newPrincipal(method, name string, user *database.User, roles []string) *Principal {
+	return &Principal{Method: method, Name: name, User: user, Roles: roles, perms: permissionsOf(roles)}
+}
+
+// UserPrincipal 为登录用户构造主体
+func UserPrincipal(u *database.User) *Principal {
+	return newPrincipal(MethodSession, u.Username, u, u.Roles)
+}
+
+// KeyPrincipal 为 API 密钥构造主体，权限即密钥的作用域
+func KeyPrincipal(k *database.APIKey) *Principal {
+	perms := map[Permission]bool{}
+	for _, s := range k.Scopes {
+		perms[Permission(s)] = true
+	}
+	return &Principal{Method: MethodAPIKey, Name: k.Name, Roles: []string{}, Scopes: k.Scopes, perms: perms}
+}
+
+// whitelistPrincipal 为白名单 IP 构造只具备 perm 的主体；perm 为空时没有任何权限
+func whitelistPrincipal(ip string, perm Permission) *Principal {
+	p := &Principal{Method: MethodWhitelist, Name: ip, Roles: []string{}, perms: map[Permission]bool{}}
+	if perm != "" {
+		p.Scopes = []string{string(perm)}
+		p.perms[perm] = true
+	}
+	return p
+}
+
+// Can 判断主体是否具备权限
+func (p *Principal) Can(perm Permission) bool {
+	return p.perms[perm]
+}
+
+// Permissions 返回主体拥有的全部权限
+func (p *Principal) Permissions() []Permission {
+	res := make([]Permission, 0, len(p.perms))
+	for perm := range p.perms {
+		res = append(res, perm)
+	}
+	return res
+}
+
+// SetPrincipal 将主体写入上下文
+func SetPrincipal(c *gin.Context, p *Principal) {
+	c.Set(contextPrincipal, p)
+}
+
+// CurrentPrincipal 返回当前请求的主体，未认证时返回 nil
+func CurrentPrincipal(c *gin.Context) *Principal {
+	if v, ok := c.Get(contextPrincipal); ok {
+		if p, ok := v.(*Principal); ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// CurrentUser 返回会话登录的用户，未登录时返回 nil
+func CurrentUser(c *gin.Context) *database.User {
+	if p := CurrentPrincipal(c); p != nil {
+		return p.User
+	}
+	return nil
+}
+
+// Username 返回会话登录的用户名，未登录时为空
+func Username(c *gin.Context) string {
+	if u := CurrentUser(c); u != nil {
+		return u.Username
+	}
+	return ""
+}
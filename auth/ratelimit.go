@@ -1,70 +1,248 @@
 package auth
 
 import (
+	"math"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"pxe-manager/utils"
-
 	"github.com/gin-gonic/gin"
 	"golang.org/x/time/rate"
 )
 
-type ipEntry struct {
+const (
+	limiterIdleTTL  = 10 * time.Minute // 超过该时长未访问的限流桶由后台清理
+	janitorInterval = time.Minute
+)
+
+// RouteLimit 为单个路由覆盖默认限流；Path 为 gin 路由模式（如 /api/servers/:serial）
+type RouteLimit struct {
+	Method            string // 空表示所有方法
+	Path              string
+	RequestsPerMinute int
+	Burst             int  // 0 表示等于 RequestsPerMinute
+	Shared            bool // true 时所有调用方共用一个桶，用于保护装机高峰期的后端
+}
+
+type limiterEntry struct {
 	limiter  *rate.Limiter
-	lastSeen time.Time
+	lastSeen atomic.Int64 // Unix 纳秒，读路径只持有读锁
+}
+
+// bucketSpec 为一类桶的速率与容量
+type bucketSpec struct {
+	perMinute int
+	burst     int
+}
+
+// RateLimiter 按主体（已认证）或客户端 IP 限流，支持按路由覆盖。
+// 桶在首次访问时创建，由后台 janitor 定期清理长期未访问的桶。
+type RateLimiter struct {
+	def       bucketSpec
+	ip        bucketSpec            // 认证之前按 IP 的限额
+	routes    map[string]RouteLimit // method+" "+path → 覆盖
+	whitelist func(ip string) bool  // 默认限流豁免的 IP
+
+	mu      sync.RWMutex
+	entries map[string]*limiterEntry
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// NewRateLimiter 创建限流器并启动后台清理，不再使用时调用 Stop
+func NewRateLimiter(sec *SecurityConfig) *RateLimiter {
+	rl := &RateLimiter{
+		def:       bucketSpec{perMinute: sec.RateLimit, burst: sec.RateBurst},
+		routes:    map[string]RouteLimit{},
+		whitelist: sec.Whitelist.Contains,
+		entries:   map[string]*limiterEntry{},
+		stop:      make(chan struct{}),
+	}
+	switch {
+	case sec.IPRateLimit == 0:
+		rl.ip = rl.def
+	case sec.IPRateLimit > 0:
+		rl.ip = bucketSpec{perMinute: sec.IPRateLimit}
+	}
+	for _, r := range sec.RouteLimits {
+		rl.routes[r.Method+" "+r.Path] = r
+	}
+	go rl.janitor()
+	return rl
 }
 
-type IPRateLimiter struct {
-	mu       sync.RWMutex
-	ips      map[string]*ipEntry
-	requests int
+// Stop 停止后台清理
+func (rl *RateLimiter) Stop() {
+	rl.once.Do(func() { close(rl.stop) })
 }
 
-func NewIPRateLimiter(requestsPerMinute int) *IPRateLimiter {
-	return &IPRateLimiter{ips: make(map[string]*ipEntry), requests: requestsPerMinute}
+func (rl *RateLimiter) janitor() {
+	t := time.NewTicker(janitorInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-rl.stop:
+			return
+		case now := <-t.C:
+			rl.sweep(now)
+		}
+	}
+}
+
+// sweep 清理空闲的桶；只在后台执行，请求路径不再遍历整个表
+func (rl *RateLimiter) sweep(now time.Time) {
+	cutoff := now.Add(-limiterIdleTTL).UnixNano()
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for k, e := range rl.entries {
+		if e.lastSeen.Load() < cutoff {
+			delete(rl.entries, k)
+		}
+	}
 }
 
-func (i *IPRateLimiter) getLimiter(ip string) *rate.Limiter {
-	i.mu.Lock()
-	defer i.mu.Unlock()
-	entry, ok := i.ips[ip]
+func (rl *RateLimiter) limiter(key string, spec bucketSpec, now time.Time) *rate.Limiter {
+	rl.mu.RLock()
+	e, ok := rl.entries[key]
+	rl.mu.RUnlock()
 	if !ok {
-		lim := rate.NewLimiter(rate.Every(time.Minute/time.Duration(i.requests)), i.requests)
-		entry = &ipEntry{limiter: lim, lastSeen: time.Now()}
-		i.ips[ip] = entry
-	} else {
-		entry.lastSeen = time.Now()
-	}
-	// 简单 TTL 清理（10分钟未访问移除）
-	for k, v := range i.ips {
-		if time.Since(v.lastSeen) > 10*time.Minute {
-			delete(i.ips, k)
+		rl.mu.Lock()
+		if e, ok = rl.entries[key]; !ok {
+			e = &limiterEntry{limiter: rate.NewLimiter(rate.Every(time.Minute/time.Duration(spec.perMinute)), spec.burst)}
+			rl.entries[key] = e
 		}
+		rl.mu.Unlock()
+	}
+	e.lastSeen.Store(now.UnixNano())
+	return e.limiter
+}
+
+// subjectKey 已认证时按主体限流，否则（含白名单主体）按客户端 IP
+func subjectKey(c *gin.Context) string {
+	if !isAnonymous(c) {
+		p := CurrentPrincipal(c)
+		return p.Method + ":" + p.Name
 	}
-	return entry.limiter
+	return "ip:" + c.ClientIP()
 }
 
-func RateLimitMiddleware(sec *SecurityConfig) gin.HandlerFunc {
-	rateLimiter := NewIPRateLimiter(sec.RateLimit)
+func isAnonymous(c *gin.Context) bool {
+	p := CurrentPrincipal(c)
+	return p == nil || p.Method == MethodWhitelist
+}
+
+// resolve 返回当前请求所用的桶；nil 表示不限流
+func (rl *RateLimiter) resolve(c *gin.Context) (string, *bucketSpec) {
+	path := c.FullPath()
+	r, ok := rl.routes[c.Request.Method+" "+path]
+	if !ok {
+		r, ok = rl.routes[" "+path]
+	}
+	if ok {
+		if r.RequestsPerMinute <= 0 {
+			return "", nil
+		}
+		spec := &bucketSpec{perMinute: r.RequestsPerMinute, burst: r.Burst}
+		if spec.burst <= 0 {
+			spec.burst = spec.perMinute
+		}
+		key := "route:" + r.Method + " " + r.Path
+		if !r.Shared {
+			key += "|" + subjectKey(c)
+		}
+		return key, spec
+	}
+	// 未携带凭据的白名单 Agent 沿用原行为不受默认限流；已认证的主体即使来自白名单 IP 也按主体限流
+	if rl.def.perMinute <= 0 || (isAnonymous(c) && rl.whitelist(c.ClientIP())) {
+		return "", nil
+	}
+	spec := rl.def
+	if spec.burst <= 0 {
+		spec.burst = spec.perMinute
+	}
+	return subjectKey(c), &spec
+}
+
+// IPMiddleware 按客户端 IP 限制认证失败的次数，注册在认证中间件之前：
+// 只有返回 401 的请求（凭据错误，每次都要查库校验令牌或 API 密钥）消耗 IP 桶，
+// 桶耗尽后该 IP 的请求在认证前即被拒绝。已认证的请求不计数，
+// 同一 NAT 或代理之后的多个主体因而不会共用一个预认证限额。白名单 IP 豁免。
+func (rl *RateLimiter) IPMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		clientIP := c.ClientIP()
-		// 白名单 IP 不限流
-		if utils.IsIPInWhitelist(clientIP, sec.WhitelistIPs) {
+		if rl.ip.perMinute <= 0 || rl.whitelist(c.ClientIP()) {
 			c.Next()
 			return
 		}
-		limiter := rateLimiter.getLimiter(clientIP)
-		if !limiter.Allow() {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":  "请求过于频繁，请稍后重试",
-				"limit":  sec.RateLimit,
-				"window": "每分钟",
-			})
-			c.Abort()
+		spec := rl.ip
+		if spec.burst <= 0 {
+			spec.burst = spec.perMinute
+		}
+		now := time.Now()
+		lim := rl.limiter("preauth:"+c.ClientIP(), spec, now)
+		if tokens := lim.TokensAt(now); tokens < 1 {
+			delay := time.Duration((1 - tokens) * float64(time.Minute) / float64(spec.perMinute))
+			setRateHeaders(c, lim, &spec, now)
+			reject(c, &spec, delay)
 			return
 		}
 		c.Next()
+		if c.Writer.Status() == http.StatusUnauthorized {
+			lim.AllowN(time.Now(), 1)
+		}
 	}
 }
+
+// Middleware 执行限流并设置 X-RateLimit-* 响应头，超限时返回 429 与 Retry-After。
+// 需注册在认证中间件之后才能按主体限流；未认证的路由按 IP 限流。
+func (rl *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, spec := rl.resolve(c)
+		if spec == nil {
+			c.Next()
+			return
+		}
+		rl.enforce(c, key, spec)
+	}
+}
+
+func (rl *RateLimiter) enforce(c *gin.Context, key string, spec *bucketSpec) {
+	now := time.Now()
+	lim := rl.limiter(key, *spec, now)
+	res := lim.ReserveN(now, 1)
+	delay := res.DelayFrom(now)
+	if delay > 0 {
+		res.CancelAt(now)
+	}
+	setRateHeaders(c, lim, spec, now)
+	if delay > 0 {
+		reject(c, spec, delay)
+		return
+	}
+	c.Next()
+}
+
+func setRateHeaders(c *gin.Context, lim *rate.Limiter, spec *bucketSpec, now time.Time) {
+	h := c.Writer.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(spec.perMinute))
+	remaining := math.Floor(lim.TokensAt(now))
+	if remaining < 0 {
+		remaining = 0
+	}
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(int(remaining)))
+	// 桶恢复满额所需的秒数
+	refill := (float64(spec.burst) - lim.TokensAt(now)) * 60 / float64(spec.perMinute)
+	h.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(math.Max(refill, 0)))))
+}
+
+// reject 返回 429，Retry-After 为获得下一个令牌需等待的秒数
+func reject(c *gin.Context, spec *bucketSpec, delay time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":  "请求过于频繁，请稍后重试",
+		"limit":  spec.perMinute,
+		"window": "每分钟",
+	})
+	c.Abort()
+}
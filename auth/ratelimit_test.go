@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pxe-manager/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newIPLimitedRouter 模拟认证中间件：携带 "Bearer ok" 的请求通过，其余返回 401
+func newIPLimitedRouter(t *testing.T, sec *SecurityConfig) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	rl := NewRateLimiter(sec)
+	t.Cleanup(rl.Stop)
+	r := gin.New()
+	r.Use(rl.IPMiddleware(), func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "Bearer ok" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+		}
+	})
+	r.GET("/x", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func get(r *gin.Engine, ip, token string) int {
+	req := httptest.NewRequest("GET", "/x", nil)
+	req.RemoteAddr = ip + ":1234"
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestIPLimitCountsOnlyFailedAuth(t *testing.T) {
+	wl, _ := utils.ParseIPAllowList(nil)
+	r := newIPLimitedRouter(t, &SecurityConfig{Whitelist: wl, RateLimit: 100, IPRateLimit: 3})
+
+	// 同一 NAT 地址后的已认证主体不消耗预认证限额
+	for i := 0; i < 20; i++ {
+		if code := get(r, "10.0.0.1", "ok"); code != http.StatusOK {
+			t.Fatalf("authenticated request #%d = %d", i, code)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if code := get(r, "10.0.0.1", "bad"); code != http.StatusUnauthorized {
+			t.Fatalf("failed auth #%d = %d", i, code)
+		}
+	}
+	// 认证失败耗尽限额后，该 IP 在认证前即被拒绝
+	if code := get(r, "10.0.0.1", "bad"); code != http.StatusTooManyRequests {
+		t.Fatalf("after failures = %d, want 429", code)
+	}
+	if code := get(r, "10.0.0.1", "ok"); code != http.StatusTooManyRequests {
+		t.Fatalf("valid token after failures = %d, want 429", code)
+	}
+	if code := get(r, "10.0.0.2", "ok"); code != http.StatusOK {
+		t.Fatalf("other IP = %d", code)
+	}
+}
+
+func TestIPLimitWhitelistAndDisabled(t *testing.T) {
+	wl, _ := utils.ParseIPAllowList([]string{"10.1.0.0/16"})
+	r := newIPLimitedRouter(t, &SecurityConfig{Whitelist: wl, RateLimit: 100, IPRateLimit: 1})
+	for i := 0; i < 5; i++ {
+		if code := get(r, "10.1.2.3", "bad"); code != http.StatusUnauthorized {
+			t.Fatalf("whitelisted #%d = %d", i, code)
+		}
+	}
+	r = newIPLimitedRouter(t, &SecurityConfig{Whitelist: wl, RateLimit: 100, IPRateLimit: -1})
+	for i := 0; i < 5; i++ {
+		if code := get(r, "10.0.0.1", "bad"); code != http.StatusUnauthorized {
+			t.Fatalf("disabled #%d = %d", i, code)
+		}
+	}
+}
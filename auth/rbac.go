@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Permission 为路由声明所需的权限
+type Permission string
+
+const (
+	PermReportWrite    Permission = "report:write"    // Agent 上报硬件信息
+	PermServersRead    Permission = "servers:read"    // 查看服务器与状态历史
+	PermServersWrite   Permission = "servers:write"   // 确认、标记安装、状态迁移
+	PermTemplatesRead  Permission = "templates:read"  // 查看配置模板
+	PermTemplatesWrite Permission = "templates:write" // 新建、修改配置模板
+	PermConfigsApply   Permission = "configs:apply"   // 将模板应用到服务器并生成 PXE 文件
+	PermAuditRead      Permission = "audit:read"      // 查看与校验审计日志
+	PermUsersManage    Permission = "users:manage"    // 管理账号与角色
+	PermKeysManage     Permission = "keys:manage"     // 管理 API 密钥与注册令牌
+)
+
+// 内置角色
+const (
+	RoleViewer        = "viewer"
+	RoleOperator      = "operator"
+	RoleTemplateAdmin = "template-admin"
+	RoleAuditor       = "auditor"
+	RoleAgent         = "agent"
+	RoleAdmin         = "admin"
+)
+
+// rolePermissions 为角色到权限的固定映射；admin 拥有全部权限
+var rolePermissions = map[string][]Permission{
+	RoleViewer:        {PermServersRead, PermTemplatesRead},
+	RoleOperator:      {PermServersRead, PermServersWrite, PermTemplatesRead, PermConfigsApply},
+	RoleTemplateAdmin: {PermServersRead, PermTemplatesRead, PermTemplatesWrite},
+	RoleAuditor:       {PermServersRead, PermTemplatesRead, PermAuditRead},
+	RoleAgent:         {PermReportWrite},
+	RoleAdmin: {
+		PermReportWrite, PermServersRead, PermServersWrite, PermTemplatesRead,
+		PermTemplatesWrite, PermConfigsApply, PermAuditRead, PermUsersManage, PermKeysManage,
+	},
+}
+
+// IsValidRole 判断是否为内置角色
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Roles 返回全部内置角色及其权限，用于接口展示
+func Roles() map[string][]Permission {
+	res := make(map[string][]Permission, len(rolePermissions))
+	for r, perms := range rolePermissions {
+		res[r] = append([]Permission{}, perms...)
+	}
+	return res
+}
+
+// permissionsOf 合并多个角色的权限，未知角色忽略
+func permissionsOf(roles []string) map[Permission]bool {
+	perms := map[Permission]bool{}
+	for _, r := range roles {
+		for _, p := range rolePermissions[r] {
+			perms[p] = true
+		}
+	}
+	return perms
+}
+
+// NormalizeRoles 去重排序并校验角色，返回第一个未知角色
+func NormalizeRoles(roles []string) ([]string, string) {
+	seen := map[string]bool{}
+	res := []string{}
+	for _, r := range roles {
+		if !IsValidRole(r) {
+			return nil, r
+		}
+		if !seen[r] {
+			seen[r] = true
+			res = append(res, r)
+		}
+	}
+	sort.Strings(res)
+	return res, ""
+}
+
+// IsValidPermission 判断是否为已定义的权限（admin 拥有全部权限）
+func IsValidPermission(p string) bool {
+	for _, perm := range rolePermissions[RoleAdmin] {
+		if string(perm) == p {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeScopes 去重排序并校验 API 密钥作用域，返回第一个未知作用域
+func NormalizeScopes(scopes []string) ([]string, string) {
+	seen := map[string]bool{}
+	res := []string{}
+	for _, s := range scopes {
+		if !IsValidPermission(s) {
+			return nil, s
+		}
+		if !seen[s] {
+			seen[s] = true
+			res = append(res, s)
+		}
+	}
+	sort.Strings(res)
+	return res, ""
+}
+
+// Require 要求当前主体具备指定权限，需在 Middleware 之后使用；白名单 IP 不豁免
+func Require(perm Permission) gin.HandlerFunc {
+	return enforce(perm, false)
+}
+
+// RequireOrWhitelisted 同 Require，但白名单 IP 未携带凭据时也可访问，
+// 此时主体只获得该路由声明的权限。仅用于 Agent 上报等装机网络内的接口。
+func RequireOrWhitelisted(perm Permission) gin.HandlerFunc {
+	return enforce(perm, true)
+}
+
+func enforce(perm Permission, whitelistExempt bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := CurrentPrincipal(c)
+		if p == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+			c.Abort()
+			return
+		}
+		if p.Method == MethodWhitelist {
+			if !whitelistExempt {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "该接口需要认证凭据"})
+				c.Abort()
+				return
+			}
+			SetPrincipal(c, whitelistPrincipal(p.Name, perm))
+			c.Next()
+			return
+		}
+		if !p.Can(perm) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "权限不足", "required": perm})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
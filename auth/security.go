@@ -1,10 +1,16 @@
 package auth
 
+import "pxe-manager/utils"
+
 // 安全配置结构（从 config.Config 中传入）
 type SecurityConfig struct {
 	AuthToken    string
-	WhitelistIPs []string
+	Whitelist    *utils.IPAllowList // 启动时解析的白名单，仅对声明豁免的路由生效
 	EnableAudit  bool
 	AuditLogPath string
-	RateLimit    int // 每IP每分钟请求数
+	RateLimit    int          // 每个主体（未认证时为 IP）每分钟请求数
+	RateBurst    int          // 突发容量，0 表示等于 RateLimit
+	IPRateLimit  int          // 每个客户端 IP 每分钟允许的认证失败次数，0 表示等于 RateLimit，负数表示不限
+	RouteLimits  []RouteLimit // 按路由覆盖默认限流
+	TokenRoles   []string     // 共享令牌授予的角色
 }
@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pxe-manager/database"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrInvalidCredentials 表示用户名或密码错误（不区分具体原因，避免枚举用户名）
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+	// ErrInvalidSession 表示会话令牌无效、过期或已注销
+	ErrInvalidSession = errors.New("会话无效或已过期")
+	// ErrWrongPassword 表示修改密码时当前密码错误
+	ErrWrongPassword = errors.New("当前密码错误")
+	// ErrExternalPassword 表示外部身份源账号没有本地密码，无法在此修改
+	ErrExternalPassword = errors.New("外部身份源账号不能修改本地密码")
+)
+
+// dummyHash 用于用户不存在时仍执行一次 bcrypt 比较，使响应时间一致
+var (
+	dummyOnce sync.Once
+	dummyHash []byte
+)
+
+func compareDummy(password string) {
+	dummyOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("pxe-manager-dummy"), bcrypt.DefaultCost)
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// SessionManager 负责登录校验与会话令牌的签发、校验和注销。
+// 令牌格式为 "<会话ID>.<过期时间Unix秒>.<HMAC-SHA256签名>"（base64url），
+// 签名与过期时间在查库前校验；会话 ID 只以 sha256 形式落库，用于注销与吊销。
+type SessionManager struct {
+	users database.UserStore
+	key   []byte
+	ttl   time.Duration
+
+	secureCookies bool
+}
+
+// NewSessionManager key 为空时随机生成，此时重启后已签发的令牌全部失效
+func NewSessionManager(users database.UserStore, key []byte, ttl time.Duration) *SessionManager {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+		log.Printf("未设置 PXE_SESSION_SECRET，使用随机会话密钥，重启后需重新登录")
+	}
+	if ttl <= 0 {
+		ttl = 12 * time.Hour
+	}
+	return &SessionManager{users: users, key: key, ttl: ttl}
+}
+
+// Login 校验用户名密码并创建会话，返回令牌与会话信息
+func (m *SessionManager) Login(username, password, clientIP string) (string, *database.Session, *database.User, error) {
+	u, err := m.users.GetUserByUsername(username)
+	if errors.Is(err, database.ErrNotFound) {
+		compareDummy(password)
+		return "", nil, nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return "", nil, nil, err
+	}
+	// 外部身份源账号没有本地密码，只能通过对应的登录方式登录
+	if u.Source != database.UserSourceLocal || !CheckPassword(u.PasswordHash, password) || u.Disabled {
+		return "", nil, nil, ErrInvalidCredentials
+	}
+	token, sess, err := m.Issue(u, clientIP)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return token, sess, u, nil
+}
+
+// Issue 为已通过认证的用户创建会话并签发令牌（本地密码、OIDC、LDAP 共用）
+func (m *SessionManager) Issue(u *database.User, clientIP string) (string, *database.Session, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	id := base64.RawURLEncoding.EncodeToString(raw)
+	expires := time.Now().Add(m.ttl).Truncate(time.Second)
+	sess := &database.Session{
+		ID:        hashSessionID(id),
+		UserID:    u.ID,
+		ClientIP:  clientIP,
+		ExpiresAt: expires,
+	}
+	if err := m.users.CreateSession(sess); err != nil {
+		return "", nil, err
+	}
+	payload := id + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + m.sign(payload), sess, nil
+}
+
+// Authenticate 校验令牌并返回对应的用户与会话
+func (m *SessionManager) Authenticate(token string) (*database.User, *database.Session, error) {
+	id, err := m.parse(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	sess, err := m.users.GetSession(hashSessionID(id))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, nil, ErrInvalidSession
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if sess.Revoked || time.Now().After(sess.ExpiresAt) {
+		return nil, nil, ErrInvalidSession
+	}
+	u, err := m.users.GetUserByID(sess.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, nil, ErrInvalidSession
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.Disabled {
+		return nil, nil, ErrInvalidSession
+	}
+	return u, sess, nil
+}
+
+// Logout 吊销令牌对应的会话
+func (m *SessionManager) Logout(token string) error {
+	id, err := m.parse(token)
+	if err != nil {
+		return err
+	}
+	if err := m.users.RevokeSession(hashSessionID(id)); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrInvalidSession
+		}
+		return err
+	}
+	return nil
+}
+
+// ChangePassword 校验当前密码后更新为新密码，并吊销该用户的全部会话（含当前会话），
+// 调用方需要为当前客户端重新签发会话
+func (m *SessionManager) ChangePassword(u *database.User, current, next string) error {
+	if u.Source != database.UserSourceLocal {
+		return ErrExternalPassword
+	}
+	if !CheckPassword(u.PasswordHash, current) {
+		return ErrWrongPassword
+	}
+	hash, err := HashPassword(next)
+	if err != nil {
+		return err
+	}
+	if err := m.users.SetUserPassword(u.ID, hash); err != nil {
+		return err
+	}
+	return m.users.RevokeUserSessions(u.ID)
+}
+
+// parse 校验签名与过期时间，返回会话 ID
+func (m *SessionManager) parse(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidSession
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(m.sign(payload))) {
+		return "", ErrInvalidSession
+	}
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() >= exp {
+		return "", ErrInvalidSession
+	}
+	return parts[0], nil
+}
+
+func (m *SessionManager) sign(payload string) string {
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func hashSessionID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// BootstrapAdmin 在没有任何用户时创建初始管理员账号
+func BootstrapAdmin(users database.UserStore, username, password string) error {
+	n, err := users.CountUsers()
+	if err != nil || n > 0 || password == "" {
+		return err
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if _, err := users.CreateUser(&database.User{Username: username, PasswordHash: hash, Roles: []string{RoleAdmin}}); err != nil {
+		return err
+	}
+	log.Printf("已创建初始管理员账号: %s", username)
+	return nil
+}
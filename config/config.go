@@ -8,18 +8,86 @@ import (
 
 // 数据库配置
 type DBConfig struct {
-	Driver     string `json:"driver"`      // sqlite/mysql
+	Driver     string `json:"driver"` // sqlite/mysql
 	SQLitePath string `json:"sqlite_path"`
 	MySQLDSN   string `json:"mysql_dsn"`
 }
 
 // 安全配置
 type SecurityConfig struct {
-	AuthToken    string   `json:"-"`             // 从环境变量读取优先
-	WhitelistIPs []string `json:"ip_whitelist"`  // CIDR 或 IP
-	RateLimit    int      `json:"rate_limit"`    // 每IP每分钟请求数
+	AuthToken    string   `json:"-"`            // 从环境变量读取优先
+	WhitelistIPs []string `json:"ip_whitelist"` // CIDR 或 IP（IPv4/IPv6），仅对 Agent 上报等声明豁免的路由生效
+	RateLimit    int      `json:"rate_limit"`   // 每个主体（未认证时为 IP）每分钟请求数
+	RateBurst    int      `json:"rate_burst"`   // 突发容量，0 表示等于 rate_limit
+	// 按路由覆盖默认限流，如装机高峰期对 /api/report 使用更严格的共享限额
+	RateLimitRoutes []RouteRateLimit `json:"rate_limit_routes"`
+	// 每个客户端 IP 每分钟允许的认证失败（401）次数，超出后该 IP 在认证前即被拒绝；
+	// 认证成功的请求不计数。0 表示等于 rate_limit，负数表示不限
+	IPRateLimit int `json:"ip_rate_limit"`
+	// 共享令牌授予的角色（账号的角色保存在数据库中）
+	TokenRoles   []string `json:"token_roles"`
 	EnableAudit  bool     `json:"enable_audit"`
+	AuditSink    string   `json:"audit_sink"` // file/database
 	AuditLogPath string   `json:"audit_log_path"`
+	// 审计日志切分与保留
+	AuditMaxSizeMB   int    `json:"audit_max_size_mb"`  // 单个文件上限，0 表示不按大小切分
+	AuditRotateEvery string `json:"audit_rotate_every"` // 按时间切分，如 "24h"，空表示不按时间
+	AuditMaxBackups  int    `json:"audit_max_backups"`  // 保留归档数量，0 表示不限
+	AuditMaxAgeDays  int    `json:"audit_max_age_days"` // 归档保留天数，0 表示不限
+	AuditCompress    bool   `json:"audit_compress"`     // 归档后 gzip 压缩
+	AuditHMACKey     string `json:"-"`                  // 哈希链 HMAC 密钥，仅从环境变量读取
+	// 账号登录会话
+	SessionTTL    string `json:"session_ttl"` // 会话有效期，如 "12h"
+	SessionSecret string `json:"-"`           // 会话令牌签名密钥，仅从环境变量读取
+	AdminPassword string `json:"-"`           // 首次启动时创建 admin 账号的密码，仅从环境变量读取
+	// Agent 以注册令牌换取的 API 密钥有效期，默认 2160h（90 天）
+	EnrolledKeyTTL string `json:"enrolled_key_ttl"`
+	// 外部身份源
+	OIDC OIDCConfig `json:"oidc"`
+	LDAP LDAPConfig `json:"ldap"`
+}
+
+// LDAP 简单绑定认证配置
+type LDAPConfig struct {
+	Enabled            bool                `json:"enabled"`
+	URL                string              `json:"url"`                  // ldap://host:389 或 ldaps://host:636
+	StartTLS           bool                `json:"start_tls"`            // 对 ldap:// 连接升级为 TLS
+	InsecureSkipVerify bool                `json:"insecure_skip_verify"` // 仅用于测试环境
+	Timeout            string              `json:"timeout"`              // 连接与请求超时，默认 5s
+	BindDN             string              `json:"bind_dn"`              // 查找用户的服务账号，空表示匿名查找
+	BindPassword       string              `json:"-"`                    // 仅从环境变量 PXE_LDAP_BIND_PASSWORD 读取
+	UserBaseDN         string              `json:"user_base_dn"`
+	UserFilter         string              `json:"user_filter"`          // %s 替换为转义后的用户名，默认 (uid=%s)
+	GroupAttribute     string              `json:"group_attribute"`      // 用户条目上的组属性，默认 memberOf
+	GroupBaseDN        string              `json:"group_base_dn"`        // 非空时额外按 group_filter 查找所属组
+	GroupFilter        string              `json:"group_filter"`         // %s 替换为转义后的用户 DN，默认 (member=%s)
+	GroupNameAttribute string              `json:"group_name_attribute"` // 组名属性，默认 cn
+	RoleMapping        map[string][]string `json:"role_mapping"`         // 组 DN 或 group_base_dn 下的组名 → pxe-manager 角色
+	DefaultRoles       []string            `json:"default_roles"`        // 未匹配到映射时授予的角色，为空则拒绝登录
+	CacheTTL           string              `json:"cache_ttl"`            // 认证结果缓存时长，如 "5m"，空表示不缓存
+}
+
+// 单个路由的限流覆盖；requests_per_minute 为 0 表示该路由不限流
+type RouteRateLimit struct {
+	Method            string `json:"method"` // 空表示所有方法
+	Path              string `json:"path"`   // gin 路由模式，如 /api/servers/:serial
+	RequestsPerMinute int    `json:"requests_per_minute"`
+	Burst             int    `json:"burst"`
+	Shared            bool   `json:"shared"` // 所有调用方共用一个限额
+}
+
+// OIDC 单点登录配置（授权码流程）
+type OIDCConfig struct {
+	Enabled       bool                `json:"enabled"`
+	Issuer        string              `json:"issuer"`
+	ClientID      string              `json:"client_id"`
+	ClientSecret  string              `json:"-"`              // 仅从环境变量 PXE_OIDC_CLIENT_SECRET 读取
+	RedirectURL   string              `json:"redirect_url"`   // 回调地址，如 https://pxe.example.com/api/auth/oidc/callback
+	Scopes        []string            `json:"scopes"`         // 默认 openid profile email
+	UsernameClaim string              `json:"username_claim"` // 默认 preferred_username
+	RoleClaim     string              `json:"role_claim"`     // 用于映射角色的声明，如 groups
+	RoleMapping   map[string][]string `json:"role_mapping"`   // 声明值 → pxe-manager 角色
+	DefaultRoles  []string            `json:"default_roles"`  // 未匹配到映射时授予的角色，为空则拒绝登录
 }
 
 // PXE/TFTP 配置
@@ -30,30 +98,106 @@ type PXEConfig struct {
 
 // 顶层配置
 type Config struct {
-	ServerAddress string         `json:"server_address"`
-	Database      DBConfig       `json:"database"`
-	Auth          SecurityConfig `json:"auth"`
-	TFTP          PXEConfig      `json:"tftp"`
+	ServerAddress string `json:"server_address"`
+	// 运行模式：production/development；空表示未指定，不返回任何 CORS 头。
+	// 只有显式设为 development 且未配置 cors.allowed_origins 时才启用允许任意源的开发 CORS
+	Mode string `json:"mode"`
+	// 可信反向代理（IP 或 CIDR），只有来自这些地址的 X-Forwarded-For 才会被采信
+	TrustedProxies []string       `json:"trusted_proxies"`
+	CORS           CORSConfig     `json:"cors"`
+	Database       DBConfig       `json:"database"`
+	Auth           SecurityConfig `json:"auth"`
+	TFTP           PXEConfig      `json:"tftp"`
+	TLS            TLSConfig      `json:"tls"`
+	// 渲染 Kickstart/Preseed 时的全局参数，模板中以 .Settings 访问
+	Provision ProvisionConfig `json:"provision"`
+}
+
+// 装机全局参数
+type ProvisionConfig struct {
+	MirrorURL string `json:"mirror_url"` // 安装源地址，为空时不写入安装源
+	Timezone  string `json:"timezone"`
+	Locale    string `json:"locale"`
+	Keyboard  string `json:"keyboard"`
+	// crypt(3) 格式的 root 密码哈希（如 openssl passwd -6 生成），为空时锁定 root 密码；
+	// 可由环境变量 PXE_ROOT_PASSWORD_HASH 覆盖
+	RootPasswordHash string `json:"root_password_hash"`
+}
+
+// 跨域策略；allowed_origins 为空时不返回 CORS 头（开发模式下使用宽松的开发策略）
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowed_origins"` // 完整的源，如 https://console.example.com；"*" 表示任意源
+	AllowedMethods   []string `json:"allowed_methods"` // 默认 DefaultCORSMethods
+	AllowedHeaders   []string `json:"allowed_headers"` // 默认 DefaultCORSHeaders
+	AllowCredentials bool     `json:"allow_credentials"`
+	MaxAge           int      `json:"max_age"` // 预检结果缓存秒数
+}
+
+// CORS 默认允许的方法与请求头；Cookie 会话的写请求需携带 X-CSRF-Token
+var (
+	DefaultCORSMethods = []string{"GET", "POST", "PUT", "DELETE"}
+	DefaultCORSHeaders = []string{"Authorization", "Content-Type", "X-CSRF-Token"}
+)
+
+// HTTPS 监听与客户端证书配置；cert_file 为空时使用明文 HTTP。
+// 证书、私钥与 CA 文件在收到 SIGHUP 时重新加载。
+type TLSConfig struct {
+	CertFile     string `json:"cert_file"`
+	KeyFile      string `json:"key_file"`
+	ClientCAFile string `json:"client_ca_file"` // 校验客户端证书的 CA 证书包，空表示不校验
+	// 客户端证书要求：request（默认，提供则校验）/require（必须提供有效证书）
+	ClientAuth string `json:"client_auth"`
+	// 为 true 时 Agent 上报必须携带有效客户端证书，证书 CN/SAN 须与上报的序列号一致
+	RequireAgentCert bool `json:"require_agent_cert"`
+	// 内置 CA，签发的客户端证书自动加入信任
+	CA CAConfig `json:"ca"`
+}
+
+// 内置 CA 配置；根证书在首次启动时生成于 dir
+type CAConfig struct {
+	Enabled bool   `json:"enabled"`
+	Dir     string `json:"dir"`      // 存放 ca.pem/ca.key，默认 ./data/ca
+	CertTTL string `json:"cert_ttl"` // 客户端证书有效期，默认 72h
+	CRLTTL  string `json:"crl_ttl"`  // CRL 有效期，默认 24h
 }
 
 func LoadConfig() *Config {
 	// 尝试读取配置文件（可选）。未找到则使用默认值。
 	cfg := &Config{
-		ServerAddress: ":8080",
+		ServerAddress:  ":8080",
+		TrustedProxies: []string{"127.0.0.1", "::1"},
+		CORS: CORSConfig{
+			AllowedMethods: append([]string{}, DefaultCORSMethods...),
+			AllowedHeaders: append([]string{}, DefaultCORSHeaders...),
+		},
 		Database: DBConfig{
 			Driver:     "sqlite",
 			SQLitePath: "./data/pxe.db",
 		},
 		Auth: SecurityConfig{
-			WhitelistIPs: []string{"192.168.88.0/24"},
-			RateLimit:    100,
-			EnableAudit:  true,
-			AuditLogPath: "./logs/audit.log",
+			WhitelistIPs:     []string{"192.168.88.0/24"},
+			RateLimit:        100,
+			TokenRoles:       []string{"admin"},
+			EnableAudit:      true,
+			AuditSink:        "file",
+			AuditLogPath:     "./logs/audit.log",
+			AuditMaxSizeMB:   100,
+			AuditRotateEvery: "24h",
+			AuditMaxBackups:  30,
+			AuditMaxAgeDays:  90,
+			AuditCompress:    true,
+			SessionTTL:       "12h",
+			EnrolledKeyTTL:   "2160h",
 		},
 		TFTP: PXEConfig{
 			Root:       "/var/lib/tftpboot",
 			EnableUEFI: true,
 		},
+		Provision: ProvisionConfig{
+			Timezone: "Asia/Shanghai",
+			Locale:   "en_US.UTF-8",
+			Keyboard: "us",
+		},
 	}
 
 	// 如果存在 config.json 则覆盖默认值
@@ -73,5 +217,27 @@ func LoadConfig() *Config {
 		cfg.Auth.AuthToken = token
 	}
 
+	// 审计哈希链 HMAC 密钥只允许通过环境变量提供
+	if key := os.Getenv("PXE_AUDIT_HMAC_KEY"); key != "" {
+		cfg.Auth.AuditHMACKey = key
+	}
+
+	// 会话签名密钥与初始管理员密码同样只允许通过环境变量提供
+	if secret := os.Getenv("PXE_SESSION_SECRET"); secret != "" {
+		cfg.Auth.SessionSecret = secret
+	}
+	if pw := os.Getenv("PXE_ADMIN_PASSWORD"); pw != "" {
+		cfg.Auth.AdminPassword = pw
+	}
+	if secret := os.Getenv("PXE_OIDC_CLIENT_SECRET"); secret != "" {
+		cfg.Auth.OIDC.ClientSecret = secret
+	}
+	if pw := os.Getenv("PXE_LDAP_BIND_PASSWORD"); pw != "" {
+		cfg.Auth.LDAP.BindPassword = pw
+	}
+	if hash := os.Getenv("PXE_ROOT_PASSWORD_HASH"); hash != "" {
+		cfg.Provision.RootPasswordHash = hash
+	}
+
 	return cfg
 }
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"strings"
+	"time"
+)
+
+var _ APIKeyStore = (*SQLStore)(nil)
+
+// unixOrZero/timeOrNil 在 *time.Time 与 BIGINT（0 表示空）之间转换
+func unixOrZero(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.Unix()
+}
+
+func timeOrNil(sec int64) *time.Time {
+	if sec == 0 {
+		return nil
+	}
+	t := time.Unix(sec, 0).UTC()
+	return &t
+}
+
+func joinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+func splitScopes(s string) []string {
+	if f := strings.Fields(s); f != nil {
+		return f
+	}
+	return []string{}
+}
+
+func (st *SQLStore) CreateAPIKey(k *APIKey) (int64, error) {
+	res, err := st.db.Exec(`INSERT INTO api_keys(name, prefix, key_hash, scopes, created_by, expires_at) VALUES (?,?,?,?,?,?)`,
+		k.Name, k.Prefix, k.KeyHash, joinScopes(k.Scopes), k.CreatedBy, unixOrZero(k.ExpiresAt))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+const apiKeySelect = `SELECT id, name, prefix, key_hash, scopes, created_by, expires_at, last_used_at, revoked, created_at FROM api_keys`
+
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*APIKey, error) {
+	var k APIKey
+	var scopes string
+	var expires, lastUsed int64
+	if err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.KeyHash, &scopes, &k.CreatedBy, &expires, &lastUsed, &k.Revoked, &k.CreatedAt); err != nil {
+		return nil, err
+	}
+	k.Scopes = splitScopes(scopes)
+	k.ExpiresAt, k.LastUsedAt = timeOrNil(expires), timeOrNil(lastUsed)
+	return &k, nil
+}
+
+func (st *SQLStore) GetAPIKeyByHash(hash string) (*APIKey, error) {
+	k, err := scanAPIKey(st.db.QueryRow(apiKeySelect+` WHERE key_hash=?`, hash))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return k, nil
+}
+
+func (st *SQLStore) ListAPIKeys() ([]APIKey, error) {
+	rows, err := st.db.Query(apiKeySelect + ` ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *k)
+	}
+	return res, rows.Err()
+}
+
+func (st *SQLStore) RevokeAPIKey(id int) error {
+	return st.execAffected(`UPDATE api_keys SET revoked=1 WHERE id=?`, id)
+}
+
+func (st *SQLStore) TouchAPIKey(id int, t time.Time) error {
+	_, err := st.db.Exec(`UPDATE api_keys SET last_used_at=? WHERE id=?`, t.Unix(), id)
+	return err
+}
+
+// execAffected 执行更新，未命中任何行时返回 ErrNotFound
+func (st *SQLStore) execAffected(q string, args ...interface{}) error {
+	res, err := st.db.Exec(q, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (st *SQLStore) CreateEnrollmentToken(t *EnrollmentToken) (int64, error) {
+	res, err := st.db.Exec(`INSERT INTO enrollment_tokens(name, prefix, token_hash, scopes, max_uses, serial_pattern, created_by, expires_at) VALUES (?,?,?,?,?,?,?,?)`,
+		t.Name, t.Prefix, t.TokenHash, joinScopes(t.Scopes), t.MaxUses, t.SerialPattern, t.CreatedBy, unixOrZero(t.ExpiresAt))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+const enrollmentSelect = `SELECT id, name, prefix, token_hash, scopes, max_uses, uses, serial_pattern, created_by, expires_at, revoked, created_at FROM enrollment_tokens`
+
+func scanEnrollmentToken(row interface{ Scan(...interface{}) error }) (*EnrollmentToken, error) {
+	var t EnrollmentToken
+	var scopes string
+	var expires int64
+	if err := row.Scan(&t.ID, &t.Name, &t.Prefix, &t.TokenHash, &scopes, &t.MaxUses, &t.Uses, &t.SerialPattern, &t.CreatedBy, &expires, &t.Revoked, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	t.Scopes = splitScopes(scopes)
+	t.ExpiresAt = timeOrNil(expires)
+	return &t, nil
+}
+
+func (st *SQLStore) ListEnrollmentTokens() ([]EnrollmentToken, error) {
+	rows, err := st.db.Query(enrollmentSelect + ` ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []EnrollmentToken{}
+	for rows.Next() {
+		t, err := scanEnrollmentToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *t)
+	}
+	return res, rows.Err()
+}
+
+func (st *SQLStore) RevokeEnrollmentToken(id int) error {
+	return st.execAffected(`UPDATE enrollment_tokens SET revoked=1 WHERE id=?`, id)
+}
+
+// ConsumeEnrollmentToken 以条件更新保证并发下不会超出使用次数
+func (st *SQLStore) ConsumeEnrollmentToken(hash string, now time.Time) (*EnrollmentToken, error) {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`UPDATE enrollment_tokens SET uses=uses+1
+		WHERE token_hash=? AND revoked=0 AND uses<max_uses AND (expires_at=0 OR expires_at>?)`, hash, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrNotFound
+	}
+	t, err := scanEnrollmentToken(tx.QueryRow(enrollmentSelect+` WHERE token_hash=?`, hash))
+	if err != nil {
+		return nil, err
+	}
+	return t, tx.Commit()
+}
@@ -0,0 +1,72 @@
+package database
+
+import "time"
+
+var _ CertificateStore = (*SQLStore)(nil)
+
+func (st *SQLStore) CreateCertificate(c *Certificate) error {
+	_, err := st.db.Exec(`INSERT INTO certificates(serial, common_name, issued_via, not_before, not_after) VALUES (?,?,?,?,?)`,
+		c.Serial, c.CommonName, c.IssuedVia, c.NotBefore.Unix(), c.NotAfter.Unix())
+	return err
+}
+
+const certificateSelect = `SELECT serial, common_name, issued_via, not_before, not_after, revoked, revoked_at, created_at FROM certificates`
+
+func scanCertificate(row interface{ Scan(...interface{}) error }) (*Certificate, error) {
+	var c Certificate
+	var notBefore, notAfter, revokedAt int64
+	if err := row.Scan(&c.Serial, &c.CommonName, &c.IssuedVia, &notBefore, &notAfter, &c.Revoked, &revokedAt, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+	c.NotBefore, c.NotAfter = time.Unix(notBefore, 0).UTC(), time.Unix(notAfter, 0).UTC()
+	c.RevokedAt = timeOrNil(revokedAt)
+	return &c, nil
+}
+
+func (st *SQLStore) GetCertificate(serial string) (*Certificate, error) {
+	c, err := scanCertificate(st.db.QueryRow(certificateSelect+` WHERE serial=?`, serial))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return c, nil
+}
+
+func (st *SQLStore) listCertificates(where string) ([]Certificate, error) {
+	rows, err := st.db.Query(certificateSelect + where + ` ORDER BY not_before, serial`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []Certificate{}
+	for rows.Next() {
+		c, err := scanCertificate(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *c)
+	}
+	return res, rows.Err()
+}
+
+func (st *SQLStore) ListCertificates() ([]Certificate, error) {
+	return st.listCertificates("")
+}
+
+func (st *SQLStore) ListRevokedCertificates() ([]Certificate, error) {
+	return st.listCertificates(` WHERE revoked=1`)
+}
+
+func (st *SQLStore) RevokeCertificate(serial string, at time.Time) error {
+	if _, err := st.GetCertificate(serial); err != nil {
+		return err
+	}
+	_, err := st.db.Exec(`UPDATE certificates SET revoked=1, revoked_at=? WHERE serial=? AND revoked=0`, at.Unix(), serial)
+	return err
+}
+
+func (st *SQLStore) HasActiveCertificate(commonName string, now time.Time) (bool, error) {
+	var n int
+	err := st.db.QueryRow(`SELECT COUNT(*) FROM certificates WHERE common_name=? AND revoked=0 AND not_after>?`,
+		commonName, now.Unix()).Scan(&n)
+	return n > 0, err
+}
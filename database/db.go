@@ -7,21 +7,28 @@ import (
 
 	"pxe-manager/config"
 
+	_ "github.com/go-sql-driver/mysql"
 	_ "modernc.org/sqlite"
 )
 
-func InitDB(cfg *config.Config) (*sql.DB, error) {
-	switch cfg.Database.Driver {
-	case "sqlite":
+// DB 在 *sql.DB 之上记录方言，供仓储层生成方言相关 SQL
+type DB struct {
+	*sql.DB
+	Dialect Dialect
+}
+
+func InitDB(cfg *config.Config) (*DB, error) {
+	switch Dialect(cfg.Database.Driver) {
+	case DialectSQLite:
 		return initSQLite(cfg.Database.SQLitePath)
-	case "mysql":
-		return sql.Open("mysql", cfg.Database.MySQLDSN)
+	case DialectMySQL:
+		return initMySQL(cfg.Database.MySQLDSN)
 	default:
 		return nil, fmt.Errorf("不支持的数据库驱动: %s", cfg.Database.Driver)
 	}
 }
 
-func initSQLite(dbPath string) (*sql.DB, error) {
+func initSQLite(dbPath string) (*DB, error) {
 	// modernc.org/sqlite 使用驱动名 "sqlite"，无需 CGO
 	// 显式设置关键 PRAGMA，确保 WAL、外键与忙等待
 	dsn := dbPath
@@ -39,5 +46,17 @@ func initSQLite(dbPath string) (*sql.DB, error) {
 		return nil, err
 	}
 	log.Printf("SQLite journal mode: %s", journalMode)
-	return db, nil
+	return &DB{DB: db, Dialect: DialectSQLite}, nil
+}
+
+func initMySQL(dsn string) (*DB, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("连接 MySQL 失败: %w", err)
+	}
+	return &DB{DB: db, Dialect: DialectMySQL}, nil
 }
\ No newline at end of file
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"strings"
+)
+
+// Dialect 标识底层数据库方言
+type Dialect string
+
+const (
+	DialectSQLite Dialect = "sqlite"
+	DialectMySQL  Dialect = "mysql"
+)
+
+// upsertSQL 生成按唯一键插入或更新的语句；updateCols 为冲突时需要覆盖的列
+func (d Dialect) upsertSQL(table, key string, cols, updateCols []string) string {
+	var b strings.Builder
+	b.WriteString("INSERT INTO ")
+	b.WriteString(table)
+	b.WriteString(" (")
+	b.WriteString(strings.Join(cols, ", "))
+	b.WriteString(") VALUES (")
+	b.WriteString(strings.TrimSuffix(strings.Repeat("?,", len(cols)), ","))
+	b.WriteString(")")
+	sets := make([]string, 0, len(updateCols))
+	switch d {
+	case DialectMySQL:
+		for _, c := range updateCols {
+			sets = append(sets, c+"=VALUES("+c+")")
+		}
+		b.WriteString(" ON DUPLICATE KEY UPDATE ")
+	default:
+		for _, c := range updateCols {
+			sets = append(sets, c+"=excluded."+c)
+		}
+		b.WriteString(" ON CONFLICT(" + key + ") DO UPDATE SET ")
+	}
+	b.WriteString(strings.Join(sets, ", "))
+	return b.String()
+}
+
+// splitStatements 将迁移脚本按行尾分号拆分为单条语句。
+// MySQL 驱动默认不允许一次执行多条语句；SQLite 迁移含触发器（BEGIN...END 内有分号），
+// 因此仅对 MySQL 拆分。
+func splitStatements(script string) []string {
+	var stmts []string
+	var cur strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		cur.WriteString(line)
+		cur.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		}
+	}
+	if s := strings.TrimSpace(cur.String()); s != "" {
+		stmts = append(stmts, s)
+	}
+	return stmts
+}
@@ -1,31 +1,259 @@
 package database
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
-	"io/ioutil"
-	"path/filepath"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pxe-manager/migrations"
 )
 
-// RunMigrations loads and executes SQL migrations in order.
-func RunMigrations(db *sql.DB) error {
-	files := []string{
-		"migrations/001_initial.sql",
+// Migration 表示一个版本化迁移，Up/Down 为对应方向的 SQL
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // Up 内容的 sha256
+}
+
+// AppliedMigration 为 schema_migrations 中的一条记录
+type AppliedMigration struct {
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	Checksum  string `json:"checksum"`
+	AppliedAt string `json:"appliedAt"`
+}
+
+const schemaMigrationsDDL = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    checksum VARCHAR(64) NOT NULL,
+    applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+)`
+
+// LoadMigrations 从 fsys 读取 NNN_name.up.sql / NNN_name.down.sql 并按版本排序
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		base := strings.TrimSuffix(e.Name(), ".sql")
+		var up bool
+		switch {
+		case strings.HasSuffix(base, ".up"):
+			up, base = true, strings.TrimSuffix(base, ".up")
+		case strings.HasSuffix(base, ".down"):
+			base = strings.TrimSuffix(base, ".down")
+		default:
+			return nil, fmt.Errorf("迁移文件缺少 .up/.down 后缀: %s", e.Name())
+		}
+		idx := strings.IndexByte(base, '_')
+		if idx <= 0 {
+			return nil, fmt.Errorf("迁移文件名不合法: %s", e.Name())
+		}
+		version, err := strconv.Atoi(base[:idx])
+		if err != nil {
+			return nil, fmt.Errorf("迁移文件版本号不合法: %s", e.Name())
+		}
+		b, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: base[idx+1:]}
+			byVersion[version] = m
+		} else if m.Name != base[idx+1:] {
+			return nil, fmt.Errorf("迁移版本 %d 存在多个名称: %s / %s", version, m.Name, base[idx+1:])
+		}
+		if up {
+			m.Up = string(b)
+			sum := sha256.Sum256(b)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(b)
+		}
+	}
+	res := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("迁移版本 %d 缺少 up 文件", m.Version)
+		}
+		res = append(res, *m)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res, nil
+}
+
+// dialectMigrations 加载当前方言目录下的内嵌迁移
+func dialectMigrations(d Dialect) ([]Migration, error) {
+	sub, err := fs.Sub(migrations.FS, string(d))
+	if err != nil {
+		return nil, err
+	}
+	return LoadMigrations(sub)
+}
+
+// RunMigrations 应用所有尚未执行的内嵌迁移，每个迁移在独立事务中执行。
+// 若已应用迁移的 checksum 与二进制内文件不一致则拒绝继续。
+// 注意 MySQL 的 DDL 会隐式提交，事务只能保证 schema_migrations 记录与最后一条语句一致。
+func RunMigrations(db *DB) error {
+	all, err := dialectMigrations(db.Dialect)
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	if err := verifyApplied(all, applied); err != nil {
+		return err
+	}
+	for _, m := range all {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("执行迁移 %03d_%s 失败: %w", m.Version, m.Name, err)
+		}
+		log.Printf("已应用迁移 %03d_%s", m.Version, m.Name)
+	}
+	return nil
+}
+
+// RollbackMigrations 按版本倒序回滚最近 steps 个已应用迁移
+func RollbackMigrations(db *DB, steps int) error {
+	all, err := dialectMigrations(db.Dialect)
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	if err := verifyApplied(all, applied); err != nil {
+		return err
+	}
+	for i := len(all) - 1; i >= 0 && steps > 0; i-- {
+		m := all[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return fmt.Errorf("迁移 %03d_%s 没有 down 文件，无法回滚", m.Version, m.Name)
+		}
+		if err := revertMigration(db, m); err != nil {
+			return fmt.Errorf("回滚迁移 %03d_%s 失败: %w", m.Version, m.Name, err)
+		}
+		log.Printf("已回滚迁移 %03d_%s", m.Version, m.Name)
+		steps--
+	}
+	return nil
+}
+
+// MigrationStatus 返回已应用的迁移（按版本升序）
+func MigrationStatus(db *DB) ([]AppliedMigration, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]AppliedMigration, 0, len(applied))
+	for _, a := range applied {
+		res = append(res, a)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res, nil
+}
+
+func appliedMigrations(db *DB) (map[int]AppliedMigration, error) {
+	if _, err := db.Exec(schemaMigrationsDDL); err != nil {
+		return nil, fmt.Errorf("创建 schema_migrations 失败: %w", err)
+	}
+	rows, err := db.Query(`SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
 	}
-	for _, f := range files {
-		if err := execSQLFile(db, f); err != nil {
-			return fmt.Errorf("执行迁移 %s 失败: %w", f, err)
+	defer rows.Close()
+	res := map[int]AppliedMigration{}
+	for rows.Next() {
+		var a AppliedMigration
+		if err := rows.Scan(&a.Version, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, err
+		}
+		res[a.Version] = a
+	}
+	return res, rows.Err()
+}
+
+func verifyApplied(all []Migration, applied map[int]AppliedMigration) error {
+	known := make(map[int]Migration, len(all))
+	for _, m := range all {
+		known[m.Version] = m
+	}
+	for v, a := range applied {
+		m, ok := known[v]
+		if !ok {
+			return fmt.Errorf("数据库已应用迁移 %03d_%s，但当前程序中不存在该迁移", v, a.Name)
+		}
+		if m.Checksum != a.Checksum {
+			return fmt.Errorf("迁移 %03d_%s 已被修改（checksum 不一致），拒绝启动", v, m.Name)
 		}
 	}
 	return nil
 }
 
-func execSQLFile(db *sql.DB, path string) error {
-	abs, _ := filepath.Abs(path)
-	b, err := ioutil.ReadFile(abs)
+func applyMigration(db *DB, m Migration) error {
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec(string(b))
-	return err
+	defer tx.Rollback()
+	if err := execScript(tx, db.Dialect, m.Up); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations(version, name, checksum) VALUES (?,?,?)`,
+		m.Version, m.Name, m.Checksum); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func revertMigration(db *DB, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := execScript(tx, db.Dialect, m.Down); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM schema_migrations WHERE version=?`, m.Version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func execScript(tx *sql.Tx, d Dialect, script string) error {
+	if d != DialectMySQL {
+		_, err := tx.Exec(script)
+		return err
+	}
+	for _, stmt := range splitStatements(script) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
 }
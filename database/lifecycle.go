@@ -0,0 +1,85 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 服务器生命周期状态
+const (
+	StatusPending        = "pending"
+	StatusConfirmed      = "confirmed"
+	StatusProvisioning   = "provisioning"
+	StatusInstalling     = "installing"
+	StatusInstalled      = "installed"
+	StatusDecommissioned = "decommissioned"
+	StatusFailed         = "failed"
+	StatusReprovision    = "reprovision"
+)
+
+// transitions 定义合法的状态迁移：
+// pending → confirmed → provisioning → installing → installed → decommissioned，
+// 未上报 installing 的客户端可由 provisioning 直接标记为 installed；
+// 过程中任意阶段可进入 failed；failed/installed/decommissioned 可转为 reprovision 重新装机。
+var transitions = map[string][]string{
+	StatusPending:        {StatusConfirmed, StatusFailed, StatusDecommissioned},
+	StatusConfirmed:      {StatusProvisioning, StatusFailed, StatusDecommissioned},
+	StatusProvisioning:   {StatusInstalling, StatusInstalled, StatusFailed},
+	StatusInstalling:     {StatusInstalled, StatusFailed},
+	StatusInstalled:      {StatusReprovision, StatusDecommissioned},
+	StatusFailed:         {StatusReprovision, StatusDecommissioned},
+	StatusReprovision:    {StatusProvisioning, StatusFailed, StatusDecommissioned},
+	StatusDecommissioned: {StatusReprovision},
+}
+
+// ErrIllegalTransition 表示状态迁移不被允许
+var ErrIllegalTransition = errors.New("非法的状态迁移")
+
+// TransitionError 描述一次被拒绝的迁移，errors.Is(err, ErrIllegalTransition) 为 true
+type TransitionError struct {
+	From string
+	To   string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("%v: %s → %s", ErrIllegalTransition, e.From, e.To)
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrIllegalTransition
+}
+
+// IsValidStatus 判断是否为已知状态
+func IsValidStatus(status string) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+// CanTransition 判断 from → to 是否合法
+func CanTransition(from, to string) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTransition 返回 nil 或 *TransitionError
+func checkTransition(from, to string) error {
+	if !CanTransition(from, to) {
+		return &TransitionError{From: from, To: to}
+	}
+	return nil
+}
+
+// StateChange 为 server_state_history 中的一条记录
+type StateChange struct {
+	ID         int    `json:"id" db:"id"`
+	Serial     string `json:"serial" db:"serial"`
+	FromStatus string `json:"fromStatus" db:"from_status"`
+	ToStatus   string `json:"toStatus" db:"to_status"`
+	Actor      string `json:"actor" db:"actor"`
+	Reason     string `json:"reason" db:"reason"`
+	CreatedAt  string `json:"createdAt" db:"created_at"`
+}
@@ -0,0 +1,721 @@
+package database
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore 为进程内存储实现，适用于单元测试与无持久化的临时环境
+type MemoryStore struct {
+	mu        sync.RWMutex
+	servers   map[string]*Server
+	history   []StateChange
+	templates map[int]*ConfigTemplate
+	revisions map[int][]TemplateRevision // 模板 ID → 按版本号升序的修订版本
+	variables map[int]*ServerVariable
+	snippets  map[int]*TemplateSnippet
+	processed map[[2]string]time.Time
+	users     map[int]*User
+	sessions  map[string]*Session
+	apiKeys   map[int]*APIKey
+	enrolls   map[int]*EnrollmentToken
+	certs     map[string]*Certificate
+	nextID    int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		servers:   map[string]*Server{},
+		templates: map[int]*ConfigTemplate{},
+		revisions: map[int][]TemplateRevision{},
+		variables: map[int]*ServerVariable{},
+		snippets:  map[int]*TemplateSnippet{},
+		processed: map[[2]string]time.Time{},
+		users:     map[int]*User{},
+		sessions:  map[string]*Session{},
+		apiKeys:   map[int]*APIKey{},
+		enrolls:   map[int]*EnrollmentToken{},
+		certs:     map[string]*Certificate{},
+	}
+}
+
+var (
+	_ ServerStore      = (*MemoryStore)(nil)
+	_ TemplateStore    = (*MemoryStore)(nil)
+	_ IdempotencyStore = (*MemoryStore)(nil)
+	_ UserStore        = (*MemoryStore)(nil)
+	_ APIKeyStore      = (*MemoryStore)(nil)
+	_ CertificateStore = (*MemoryStore)(nil)
+	_ VariableStore    = (*MemoryStore)(nil)
+	_ SnippetStore     = (*MemoryStore)(nil)
+)
+
+// memNow 与 SQLite CURRENT_TIMESTAMP 的格式保持一致
+func memNow() string {
+	return time.Now().UTC().Format("2006-01-02 15:04:05")
+}
+
+func (m *MemoryStore) SaveServer(s *Server, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := memNow()
+	cp := *s
+	if old, ok := m.servers[s.Serial]; ok {
+		cp.ID, cp.CreatedAt, cp.Status = old.ID, old.CreatedAt, old.Status
+		cp.TemplateID, cp.TemplateRevision = old.TemplateID, old.TemplateRevision
+	} else {
+		m.nextID++
+		cp.ID, cp.CreatedAt = m.nextID, now
+		m.addHistory(s.Serial, "", s.Status, actor, "首次上报")
+	}
+	cp.UpdatedAt = now
+	m.servers[s.Serial] = &cp
+	return nil
+}
+
+// addHistory 调用方需持有写锁
+func (m *MemoryStore) addHistory(serial, from, to, actor, reason string) {
+	m.history = append(m.history, StateChange{
+		ID: len(m.history) + 1, Serial: serial, FromStatus: from, ToStatus: to,
+		Actor: actor, Reason: reason, CreatedAt: memNow(),
+	})
+}
+
+func (m *MemoryStore) TransitionServer(serial, to, actor, reason string) (*Server, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.servers[serial]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if err := checkTransition(s.Status, to); err != nil {
+		return nil, err
+	}
+	m.addHistory(serial, s.Status, to, actor, reason)
+	s.Status = to
+	s.UpdatedAt = memNow()
+	cp := *s
+	return &cp, nil
+}
+
+func (m *MemoryStore) RevertTransition(serial, from, to, actor, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.servers[serial]
+	if !ok {
+		return ErrNotFound
+	}
+	if s.Status != from {
+		return &TransitionError{From: s.Status, To: to}
+	}
+	m.addHistory(serial, from, to, actor, reason)
+	s.Status = to
+	s.UpdatedAt = memNow()
+	return nil
+}
+
+func (m *MemoryStore) ListServerHistory(serial string) ([]StateChange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := []StateChange{}
+	for _, h := range m.history {
+		if h.Serial == serial {
+			res = append(res, h)
+		}
+	}
+	return res, nil
+}
+
+func (m *MemoryStore) ListServers(q ServerQuery) (*ServerPage, error) {
+	q.normalize()
+	m.mu.RLock()
+	matched := []Server{}
+	for _, s := range m.servers {
+		if q.Match(s) {
+			matched = append(matched, *s)
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(matched, func(i, j int) bool {
+		c := compareServers(&matched[i], &matched[j], q.Sort)
+		if c == 0 {
+			return matched[i].ID < matched[j].ID
+		}
+		if q.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	page := &ServerPage{Items: []Server{}, Total: len(matched), Page: q.Page, PageSize: q.PageSize}
+	if offset := (q.Page - 1) * q.PageSize; offset < len(matched) {
+		end := offset + q.PageSize
+		if end > len(matched) {
+			end = len(matched)
+		}
+		page.Items = matched[offset:end]
+	}
+	return page, nil
+}
+
+func (m *MemoryStore) GetServerBySerial(serial string) (*Server, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.servers[serial]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *s
+	return &cp, nil
+}
+
+func (m *MemoryStore) SetServerTemplate(serial string, templateID, revision int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.servers[serial]
+	if !ok {
+		return ErrNotFound
+	}
+	s.TemplateID, s.TemplateRevision = templateID, revision
+	return nil
+}
+
+func (m *MemoryStore) ListConfigs() ([]ConfigTemplate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var res []ConfigTemplate
+	for _, c := range m.templates {
+		res = append(res, *c)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
+
+func (m *MemoryStore) GetConfig(id int) (*ConfigTemplate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, ok := m.templates[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *c
+	return &cp, nil
+}
+
+func (m *MemoryStore) CreateConfig(c *ConfigTemplate, author, comment string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	cp := *c
+	cp.ID, cp.CreatedAt, cp.Revision = m.nextID, memNow(), 1
+	m.templates[cp.ID] = &cp
+	m.addRevision(&cp, author, comment)
+	return int64(cp.ID), nil
+}
+
+func (m *MemoryStore) UpdateConfig(id int, c *ConfigTemplate, author, comment string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.templates[id]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	cp := *c
+	cp.ID, cp.CreatedAt, cp.Revision = id, old.CreatedAt, old.Revision+1
+	m.templates[id] = &cp
+	m.addRevision(&cp, author, comment)
+	return cp.Revision, nil
+}
+
+// addRevision 调用方需持有写锁
+func (m *MemoryStore) addRevision(c *ConfigTemplate, author, comment string) {
+	m.nextID++
+	r := TemplateRevision{
+		ID: m.nextID, TemplateID: c.ID, Revision: c.Revision,
+		Author: author, Comment: comment, CreatedAt: memNow(), Template: *c,
+	}
+	r.Template.CreatedAt = r.CreatedAt
+	m.revisions[c.ID] = append(m.revisions[c.ID], r)
+}
+
+func (m *MemoryStore) ListConfigRevisions(id int) ([]TemplateRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]TemplateRevision{}, m.revisions[id]...), nil
+}
+
+func (m *MemoryStore) GetConfigRevision(id, revision int) (*TemplateRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, r := range m.revisions[id] {
+		if r.Revision == revision {
+			cp := r
+			return &cp, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) ListSnippets() ([]TemplateSnippet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := make([]TemplateSnippet, 0, len(m.snippets))
+	for _, s := range m.snippets {
+		res = append(res, *s)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+func (m *MemoryStore) GetSnippet(id int) (*TemplateSnippet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.snippets[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *s
+	return &cp, nil
+}
+
+func (m *MemoryStore) GetSnippetByName(name string) (*TemplateSnippet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, s := range m.snippets {
+		if s.Name == name {
+			cp := *s
+			return &cp, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) snippetNameTaken(name string, exceptID int) bool {
+	for _, s := range m.snippets {
+		if s.Name == name && s.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) CreateSnippet(s *TemplateSnippet) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.snippetNameTaken(s.Name, 0) {
+		return 0, ErrSnippetExists
+	}
+	m.nextID++
+	cp := *s
+	cp.ID = m.nextID
+	cp.CreatedAt = memNow()
+	cp.UpdatedAt = cp.CreatedAt
+	m.snippets[cp.ID] = &cp
+	return int64(cp.ID), nil
+}
+
+func (m *MemoryStore) UpdateSnippet(id int, s *TemplateSnippet) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.snippets[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if m.snippetNameTaken(s.Name, id) {
+		return ErrSnippetExists
+	}
+	cp := *s
+	cp.ID, cp.CreatedAt, cp.UpdatedAt = id, old.CreatedAt, memNow()
+	m.snippets[id] = &cp
+	return nil
+}
+
+func (m *MemoryStore) DeleteSnippet(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.snippets[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.snippets, id)
+	return nil
+}
+
+func (m *MemoryStore) ListServerVariables(scope, target string) ([]ServerVariable, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := []ServerVariable{}
+	for _, v := range m.variables {
+		if (scope == "" || v.Scope == scope) && (target == "" || v.Target == target) {
+			res = append(res, *v)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		if a.Scope != b.Scope {
+			return a.Scope < b.Scope
+		}
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.Name < b.Name
+	})
+	return res, nil
+}
+
+func (m *MemoryStore) SetServerVariable(v *ServerVariable) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := memNow()
+	for _, old := range m.variables {
+		if old.Scope == v.Scope && old.Target == v.Target && old.Name == v.Name {
+			old.Value, old.Priority, old.UpdatedBy, old.UpdatedAt = v.Value, v.Priority, v.UpdatedBy, now
+			return int64(old.ID), nil
+		}
+	}
+	m.nextID++
+	cp := *v
+	cp.ID, cp.CreatedAt, cp.UpdatedAt = m.nextID, now, now
+	m.variables[cp.ID] = &cp
+	return int64(cp.ID), nil
+}
+
+func (m *MemoryStore) DeleteServerVariable(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.variables[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.variables, id)
+	return nil
+}
+
+// MarkProcessed 同时清理 72 小时前的记录（对应 SQL 实现中的清理触发器）
+func (m *MemoryStore) MarkProcessed(serial, requestID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for k, t := range m.processed {
+		if now.Sub(t) > 72*time.Hour {
+			delete(m.processed, k)
+		}
+	}
+	key := [2]string{serial, requestID}
+	if _, ok := m.processed[key]; ok {
+		return false, nil
+	}
+	m.processed[key] = now
+	return true, nil
+}
+
+func (m *MemoryStore) CreateUser(u *User) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, old := range m.users {
+		if old.Username == u.Username {
+			return 0, ErrUserExists
+		}
+	}
+	m.nextID++
+	cp := *u
+	cp.ID = m.nextID
+	cp.Roles = sortedRoles(u.Roles)
+	if cp.Source == "" {
+		cp.Source = UserSourceLocal
+	}
+	cp.CreatedAt, cp.UpdatedAt = memNow(), memNow()
+	m.users[cp.ID] = &cp
+	return int64(cp.ID), nil
+}
+
+// sortedRoles 复制并排序角色，与 SQL 实现的返回顺序一致
+func sortedRoles(roles []string) []string {
+	res := append([]string{}, roles...)
+	sort.Strings(res)
+	return res
+}
+
+func copyUser(u *User) *User {
+	cp := *u
+	cp.Roles = append([]string{}, u.Roles...)
+	return &cp
+}
+
+func (m *MemoryStore) ListUsers() ([]User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := make([]User, 0, len(m.users))
+	for _, u := range m.users {
+		res = append(res, *copyUser(u))
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
+
+func (m *MemoryStore) SetUserRoles(userID int, roles []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	u.Roles = sortedRoles(roles)
+	return nil
+}
+
+func (m *MemoryStore) SetUserPassword(userID int, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	u.PasswordHash, u.UpdatedAt = hash, memNow()
+	return nil
+}
+
+func (m *MemoryStore) GetUserByID(id int) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyUser(u), nil
+}
+
+func (m *MemoryStore) GetUserByUsername(username string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, u := range m.users {
+		if u.Username == username {
+			return copyUser(u), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) CountUsers() (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.users), nil
+}
+
+func (m *MemoryStore) CreateSession(s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp := *s
+	cp.CreatedAt = memNow()
+	m.sessions[s.ID] = &cp
+	return nil
+}
+
+func (m *MemoryStore) GetSession(id string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *s
+	return &cp, nil
+}
+
+func (m *MemoryStore) RevokeSession(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	s.Revoked = true
+	return nil
+}
+
+func (m *MemoryStore) RevokeUserSessions(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.sessions {
+		if s.UserID == userID {
+			s.Revoked = true
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateAPIKey(k *APIKey) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	cp := *k
+	cp.ID, cp.CreatedAt = m.nextID, memNow()
+	cp.Scopes = append([]string{}, k.Scopes...)
+	m.apiKeys[cp.ID] = &cp
+	return int64(cp.ID), nil
+}
+
+func (m *MemoryStore) GetAPIKeyByHash(hash string) (*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, k := range m.apiKeys {
+		if k.KeyHash == hash {
+			cp := *k
+			return &cp, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) ListAPIKeys() ([]APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := make([]APIKey, 0, len(m.apiKeys))
+	for _, k := range m.apiKeys {
+		res = append(res, *k)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
+
+func (m *MemoryStore) RevokeAPIKey(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.apiKeys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	k.Revoked = true
+	return nil
+}
+
+func (m *MemoryStore) TouchAPIKey(id int, t time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if k, ok := m.apiKeys[id]; ok {
+		t = t.UTC().Truncate(time.Second)
+		k.LastUsedAt = &t
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateEnrollmentToken(t *EnrollmentToken) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	cp := *t
+	cp.ID, cp.Uses, cp.CreatedAt = m.nextID, 0, memNow()
+	cp.Scopes = append([]string{}, t.Scopes...)
+	m.enrolls[cp.ID] = &cp
+	return int64(cp.ID), nil
+}
+
+func (m *MemoryStore) ListEnrollmentTokens() ([]EnrollmentToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := make([]EnrollmentToken, 0, len(m.enrolls))
+	for _, t := range m.enrolls {
+		res = append(res, *t)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
+
+func (m *MemoryStore) RevokeEnrollmentToken(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.enrolls[id]
+	if !ok {
+		return ErrNotFound
+	}
+	t.Revoked = true
+	return nil
+}
+
+func (m *MemoryStore) ConsumeEnrollmentToken(hash string, now time.Time) (*EnrollmentToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range m.enrolls {
+		if t.TokenHash != hash {
+			continue
+		}
+		if t.Revoked || t.Uses >= t.MaxUses || (t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)) {
+			return nil, ErrNotFound
+		}
+		t.Uses++
+		cp := *t
+		return &cp, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) CreateCertificate(c *Certificate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp := *c
+	cp.NotBefore, cp.NotAfter = c.NotBefore.UTC().Truncate(time.Second), c.NotAfter.UTC().Truncate(time.Second)
+	cp.Revoked, cp.RevokedAt = false, nil
+	cp.CreatedAt = memNow()
+	m.certs[cp.Serial] = &cp
+	return nil
+}
+
+func (m *MemoryStore) GetCertificate(serial string) (*Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, ok := m.certs[serial]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *c
+	return &cp, nil
+}
+
+func (m *MemoryStore) listCertificates(revokedOnly bool) []Certificate {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := []Certificate{}
+	for _, c := range m.certs {
+		if !revokedOnly || c.Revoked {
+			res = append(res, *c)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].NotBefore.Equal(res[j].NotBefore) {
+			return res[i].NotBefore.Before(res[j].NotBefore)
+		}
+		return res[i].Serial < res[j].Serial
+	})
+	return res
+}
+
+func (m *MemoryStore) ListCertificates() ([]Certificate, error) {
+	return m.listCertificates(false), nil
+}
+
+func (m *MemoryStore) ListRevokedCertificates() ([]Certificate, error) {
+	return m.listCertificates(true), nil
+}
+
+func (m *MemoryStore) HasActiveCertificate(commonName string, now time.Time) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, c := range m.certs {
+		if c.CommonName == commonName && !c.Revoked && now.Before(c.NotAfter) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStore) RevokeCertificate(serial string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.certs[serial]
+	if !ok {
+		return ErrNotFound
+	}
+	if !c.Revoked {
+		t := at.UTC().Truncate(time.Second)
+		c.Revoked, c.RevokedAt = true, &t
+	}
+	return nil
+}
@@ -1,5 +1,7 @@
 package database
 
+import "time"
+
 // 数据模型与 API/DB 字段映射
 
 type Server struct {
@@ -27,6 +29,9 @@ type Server struct {
 	Status        string `json:"status" db:"status"`
 	CreatedAt     string `json:"createdAt" db:"created_at"`
 	UpdatedAt     string `json:"updatedAt" db:"updated_at"`
+	// TemplateID/TemplateRevision 为最近一次应用的模板及其修订版本，0 表示未应用
+	TemplateID       int `json:"templateId" db:"template_id"`
+	TemplateRevision int `json:"templateRevision" db:"template_revision"`
 }
 
 type ConfigTemplate struct {
@@ -40,4 +45,140 @@ type ConfigTemplate struct {
 	Packages      string `json:"packages" db:"packages"`
 	Status        string `json:"status" db:"status"`
 	CreatedAt     string `json:"createdAt" db:"created_at"`
+	// Variables 为模板变量定义，以 JSON 数组保存
+	Variables []TemplateVariable `json:"variables" db:"variables"`
+	// Revision 为当前修订版本号
+	Revision int `json:"revision" db:"revision"`
+}
+
+// TemplateRevision 为模板某次创建或修改后的不可变快照
+type TemplateRevision struct {
+	ID         int    `json:"id" db:"id"`
+	TemplateID int    `json:"templateId" db:"template_id"`
+	Revision   int    `json:"revision" db:"revision"`
+	Author     string `json:"author" db:"author"`
+	Comment    string `json:"comment" db:"comment"`
+	CreatedAt  string `json:"createdAt" db:"created_at"`
+	// Template 为该版本的模板内容，ID 与 Revision 与所属模板及版本一致
+	Template ConfigTemplate `json:"template"`
+}
+
+// 模板变量类型
+const (
+	VarTypeString  = "string"
+	VarTypeInteger = "integer"
+	VarTypeNumber  = "number"
+	VarTypeBoolean = "boolean"
+)
+
+// TemplateVariable 为模板变量定义；Default/Enum 中的值须符合 Type
+type TemplateVariable struct {
+	Name        string        `json:"name"`
+	Type        string        `json:"type"` // string/integer/number/boolean，空表示 string
+	Default     interface{}   `json:"default,omitempty"`
+	Required    bool          `json:"required,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"`
+	Description string        `json:"description,omitempty"`
+}
+
+// TemplateSnippet 为可被模板以 {{ include "name" }} 引用的片段
+type TemplateSnippet struct {
+	ID          int    `json:"id" db:"id"`
+	Name        string `json:"name" db:"name"`
+	Description string `json:"description" db:"description"`
+	Content     string `json:"content" db:"content"`
+	UpdatedBy   string `json:"updatedBy" db:"updated_by"`
+	CreatedAt   string `json:"createdAt" db:"created_at"`
+	UpdatedAt   string `json:"updatedAt" db:"updated_at"`
+}
+
+// 变量覆盖的作用范围
+const (
+	VarScopeServer = "server" // target 为服务器序列号
+	VarScopeGroup  = "group"  // target 为匹配序列号的通配模式
+)
+
+// ServerVariable 为按服务器或分组覆盖的变量值。
+// 优先级：服务器 > 分组（priority 大者优先，相同时模式更长者优先）> 模板默认值
+type ServerVariable struct {
+	ID        int         `json:"id" db:"id"`
+	Scope     string      `json:"scope" db:"scope"`
+	Target    string      `json:"target" db:"target"`
+	Name      string      `json:"name" db:"name"`
+	Value     interface{} `json:"value" db:"value"` // JSON 编码保存
+	Priority  int         `json:"priority" db:"priority"`
+	UpdatedBy string      `json:"updatedBy" db:"updated_by"`
+	CreatedAt string      `json:"createdAt" db:"created_at"`
+	UpdatedAt string      `json:"updatedAt" db:"updated_at"`
+}
+
+// 账号来源
+const (
+	UserSourceLocal = "local"
+	UserSourceOIDC  = "oidc"
+	UserSourceLDAP  = "ldap"
+)
+
+// User 为控制台登录账号
+type User struct {
+	ID           int      `json:"id" db:"id"`
+	Username     string   `json:"username" db:"username"`
+	PasswordHash string   `json:"-" db:"password_hash"`
+	Disabled     bool     `json:"disabled" db:"disabled"`
+	Source       string   `json:"source" db:"source"` // local/oidc/ldap
+	Roles        []string `json:"roles" db:"-"`       // 来自 user_roles
+	CreatedAt    string   `json:"createdAt" db:"created_at"`
+	UpdatedAt    string   `json:"updatedAt" db:"updated_at"`
+}
+
+// Session 为一次登录会话；ID 为会话 ID 的 sha256 十六进制
+type Session struct {
+	ID        string    `json:"-" db:"id"`
+	UserID    int       `json:"userId" db:"user_id"`
+	ClientIP  string    `json:"clientIP" db:"client_ip"`
+	ExpiresAt time.Time `json:"expiresAt" db:"expires_at"`
+	Revoked   bool      `json:"revoked" db:"revoked"`
+	CreatedAt string    `json:"createdAt" db:"created_at"`
+}
+
+// APIKey 为带作用域的 API 密钥；明文密钥只在创建时返回一次
+type APIKey struct {
+	ID         int        `json:"id" db:"id"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"prefix"` // 明文前缀，便于识别
+	KeyHash    string     `json:"-" db:"key_hash"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	CreatedBy  string     `json:"createdBy" db:"created_by"`
+	ExpiresAt  *time.Time `json:"expiresAt" db:"expires_at"` // nil 表示永不过期
+	LastUsedAt *time.Time `json:"lastUsedAt" db:"last_used_at"`
+	Revoked    bool       `json:"revoked" db:"revoked"`
+	CreatedAt  string     `json:"createdAt" db:"created_at"`
+}
+
+// EnrollmentToken 为限次使用的注册令牌，Agent 用其换取 API 密钥
+type EnrollmentToken struct {
+	ID            int        `json:"id" db:"id"`
+	Name          string     `json:"name" db:"name"`
+	Prefix        string     `json:"prefix" db:"prefix"`
+	TokenHash     string     `json:"-" db:"token_hash"`
+	Scopes        []string   `json:"scopes" db:"scopes"` // 换取的 API 密钥所获得的作用域
+	MaxUses       int        `json:"maxUses" db:"max_uses"`
+	Uses          int        `json:"uses" db:"uses"`
+	SerialPattern string     `json:"serialPattern" db:"serial_pattern"` // 可换取证书的序列号通配模式，空表示不限制
+	CreatedBy     string     `json:"createdBy" db:"created_by"`
+	ExpiresAt     *time.Time `json:"expiresAt" db:"expires_at"`
+	Revoked       bool       `json:"revoked" db:"revoked"`
+	CreatedAt     string     `json:"createdAt" db:"created_at"`
+}
+
+// Certificate 为内置 CA 签发的客户端证书记录（不保存私钥）
+type Certificate struct {
+	Serial     string     `json:"serial" db:"serial"`          // 证书序列号（十六进制）
+	CommonName string     `json:"commonName" db:"common_name"` // 绑定的服务器序列号
+	IssuedVia  string     `json:"issuedVia" db:"issued_via"`
+	NotBefore  time.Time  `json:"notBefore" db:"not_before"`
+	NotAfter   time.Time  `json:"notAfter" db:"not_after"`
+	Revoked    bool       `json:"revoked" db:"revoked"`
+	RevokedAt  *time.Time `json:"revokedAt" db:"revoked_at"`
+	CreatedAt  string     `json:"createdAt" db:"created_at"`
 }
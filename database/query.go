@@ -0,0 +1,257 @@
+package database
+
+import (
+	"net/netip"
+	"strings"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// ServerQuery 描述服务器列表的筛选、排序与分页条件，零值字段表示不限制
+type ServerQuery struct {
+	Status         string
+	HostnamePrefix string
+	SerialPrefix   string
+	MAC            string       // 精确匹配，忽略大小写
+	IPPrefix       netip.Prefix // 单个 IP 以 /32 或 /128 表示
+	CPUModel       string       // 包含匹配
+	MemMin         *int         // mem_total 下限（含）
+	MemMax         *int         // mem_total 上限（含）
+	SystemVersion  string
+	// 时间范围使用 "2006-01-02 15:04:05"（UTC）格式，与 CURRENT_TIMESTAMP 一致
+	CreatedFrom string
+	CreatedTo   string
+	UpdatedFrom string
+	UpdatedTo   string
+
+	Sort     string // 列名（db 或 json 名称），默认 id
+	Desc     bool
+	Page     int // 从 1 开始
+	PageSize int
+}
+
+// ServerPage 为分页结果
+type ServerPage struct {
+	Items    []Server `json:"items"`
+	Total    int      `json:"total"`
+	Page     int      `json:"page"`
+	PageSize int      `json:"pageSize"`
+}
+
+// sortableColumns 将 json/db 字段名映射到可排序的列
+var sortableColumns = map[string]string{}
+
+func init() {
+	pairs := [][2]string{
+		{"id", "id"}, {"serial", "serial"}, {"hostname", "hostname"},
+		{"ipAddress", "ip_address"}, {"macAddress", "mac_address"}, {"gateway", "gateway"},
+		{"installTime", "install_time"}, {"sdaSize", "sda_size"},
+		{"systemVersion", "system_version"}, {"kernelVersion", "kernel_version"},
+		{"cpuModel", "cpu_model"}, {"cpuProcessor", "cpu_processor"},
+		{"memTotal", "mem_total"}, {"memoryNum", "memory_num"},
+		{"status", "status"}, {"createdAt", "created_at"}, {"updatedAt", "updated_at"},
+	}
+	for _, p := range pairs {
+		sortableColumns[p[0]] = p[1]
+		sortableColumns[p[1]] = p[1]
+	}
+}
+
+// SortColumn 返回规范化后的排序列；未知列返回 false
+func SortColumn(name string) (string, bool) {
+	if name == "" {
+		return "id", true
+	}
+	col, ok := sortableColumns[name]
+	return col, ok
+}
+
+// normalize 填充分页默认值
+func (q *ServerQuery) normalize() {
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 {
+		q.PageSize = DefaultPageSize
+	}
+	if q.PageSize > MaxPageSize {
+		q.PageSize = MaxPageSize
+	}
+	if col, ok := SortColumn(q.Sort); ok {
+		q.Sort = col
+	} else {
+		q.Sort = "id"
+	}
+}
+
+// likeEscape 转义 LIKE 通配符，配合 ESCAPE '!' 使用（SQLite 与 MySQL 均支持）
+func likeEscape(s string) string {
+	r := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+	return r.Replace(s)
+}
+
+// where 生成 SQL 条件（不含 IP 网段，网段在 Go 侧过滤）
+func (q *ServerQuery) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+	if q.Status != "" {
+		add("status=?", q.Status)
+	}
+	if q.HostnamePrefix != "" {
+		add("hostname LIKE ? ESCAPE '!'", likeEscape(q.HostnamePrefix)+"%")
+	}
+	if q.SerialPrefix != "" {
+		add("serial LIKE ? ESCAPE '!'", likeEscape(q.SerialPrefix)+"%")
+	}
+	if q.MAC != "" {
+		add("LOWER(mac_address)=?", strings.ToLower(q.MAC))
+	}
+	if q.CPUModel != "" {
+		add("cpu_model LIKE ? ESCAPE '!'", "%"+likeEscape(q.CPUModel)+"%")
+	}
+	if q.MemMin != nil {
+		add("mem_total>=?", *q.MemMin)
+	}
+	if q.MemMax != nil {
+		add("mem_total<=?", *q.MemMax)
+	}
+	if q.SystemVersion != "" {
+		add("system_version=?", q.SystemVersion)
+	}
+	if q.CreatedFrom != "" {
+		add("created_at>=?", q.CreatedFrom)
+	}
+	if q.CreatedTo != "" {
+		add("created_at<=?", q.CreatedTo)
+	}
+	if q.UpdatedFrom != "" {
+		add("updated_at>=?", q.UpdatedFrom)
+	}
+	if q.UpdatedTo != "" {
+		add("updated_at<=?", q.UpdatedTo)
+	}
+	if p := q.ipTextPrefix(); p != "" {
+		// 先用文本前缀在 SQL 中缩小范围，再由 matchIP 精确判断；兼容 IPv4 映射地址
+		conds = append(conds, "(ip_address LIKE ? ESCAPE '!' OR ip_address LIKE ? ESCAPE '!')")
+		args = append(args, likeEscape(p)+"%", "::ffff:"+likeEscape(p)+"%")
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// ipTextPrefix 返回 IPv4 网段中固定八位组对应的文本前缀（如 10.1.0.0/16 为 "10.1."），
+// 无法缩小范围时返回空。IPv6 的文本形式不唯一（可省略前导零、压缩 ::），不做缩小
+func (q *ServerQuery) ipTextPrefix() string {
+	if !q.IPPrefix.IsValid() || !q.IPPrefix.Addr().Is4() {
+		return ""
+	}
+	n := q.IPPrefix.Bits() / 8
+	if n == 0 {
+		return ""
+	}
+	octets := strings.SplitN(q.IPPrefix.Masked().Addr().String(), ".", 4)
+	if n == 4 {
+		return strings.Join(octets, ".")
+	}
+	return strings.Join(octets[:n], ".") + "."
+}
+
+// matchIP 判断服务器 IP 是否落在 IPPrefix 内；未设置网段时恒为 true
+func (q *ServerQuery) matchIP(s *Server) bool {
+	if !q.IPPrefix.IsValid() {
+		return true
+	}
+	addr, err := netip.ParseAddr(s.IPAddress)
+	return err == nil && q.IPPrefix.Contains(addr.Unmap())
+}
+
+// Match 在 Go 侧判断服务器是否满足全部条件（内存实现使用）
+func (q *ServerQuery) Match(s *Server) bool {
+	switch {
+	case q.Status != "" && s.Status != q.Status,
+		q.HostnamePrefix != "" && !strings.HasPrefix(s.Hostname, q.HostnamePrefix),
+		q.SerialPrefix != "" && !strings.HasPrefix(s.Serial, q.SerialPrefix),
+		q.MAC != "" && !strings.EqualFold(s.MACAddress, q.MAC),
+		q.CPUModel != "" && !strings.Contains(s.CPUModel, q.CPUModel),
+		q.MemMin != nil && s.MemTotal < *q.MemMin,
+		q.MemMax != nil && s.MemTotal > *q.MemMax,
+		q.SystemVersion != "" && s.SystemVersion != q.SystemVersion,
+		q.CreatedFrom != "" && s.CreatedAt < q.CreatedFrom,
+		q.CreatedTo != "" && s.CreatedAt > q.CreatedTo,
+		q.UpdatedFrom != "" && s.UpdatedAt < q.UpdatedFrom,
+		q.UpdatedTo != "" && s.UpdatedAt > q.UpdatedTo:
+		return false
+	}
+	return q.matchIP(s)
+}
+
+// compareServers 按列比较两台服务器，返回 -1/0/1
+func compareServers(a, b *Server, col string) int {
+	var ai, bi int
+	var as, bs string
+	numeric := true
+	switch col {
+	case "cpu_processor":
+		ai, bi = a.CPUProcessor, b.CPUProcessor
+	case "mem_total":
+		ai, bi = a.MemTotal, b.MemTotal
+	case "memory_num":
+		ai, bi = a.MemoryNum, b.MemoryNum
+	case "id":
+		ai, bi = a.ID, b.ID
+	default:
+		numeric = false
+		as, bs = serverStringField(a, col), serverStringField(b, col)
+	}
+	if numeric {
+		switch {
+		case ai < bi:
+			return -1
+		case ai > bi:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(as, bs)
+}
+
+func serverStringField(s *Server, col string) string {
+	switch col {
+	case "serial":
+		return s.Serial
+	case "hostname":
+		return s.Hostname
+	case "ip_address":
+		return s.IPAddress
+	case "mac_address":
+		return s.MACAddress
+	case "gateway":
+		return s.Gateway
+	case "install_time":
+		return s.InstallTime
+	case "sda_size":
+		return s.SdaSize
+	case "system_version":
+		return s.SystemVersion
+	case "kernel_version":
+		return s.KernelVersion
+	case "cpu_model":
+		return s.CPUModel
+	case "status":
+		return s.Status
+	case "created_at":
+		return s.CreatedAt
+	case "updated_at":
+		return s.UpdatedAt
+	}
+	return ""
+}
@@ -2,74 +2,202 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 )
 
-// SaveServer 使用 UPSERT 以 serial 唯一进行插入或更新
-func SaveServer(db *sql.DB, s *Server) error {
-	_, err := db.Exec(`
-	INSERT INTO servers (
-		serial, hostname, ip_address, mac_address, gateway, install_time,
-		sda_size, part, system_version, kernel_version, cpu_model, cpu_processor,
-		mem_total, memory_num, lan_nic, lan_nic_speed, wan_nic, wan_nic_speed,
-		bond_nic, bond_nic_speed, status
-	) VALUES (
-		?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?
-	) ON CONFLICT(serial) DO UPDATE SET
-		hostname=excluded.hostname,
-		ip_address=excluded.ip_address,
-		mac_address=excluded.mac_address,
-		gateway=excluded.gateway,
-		install_time=excluded.install_time,
-		sda_size=excluded.sda_size,
-		part=excluded.part,
-		system_version=excluded.system_version,
-		kernel_version=excluded.kernel_version,
-		cpu_model=excluded.cpu_model,
-		cpu_processor=excluded.cpu_processor,
-		mem_total=excluded.mem_total,
-		memory_num=excluded.memory_num,
-		lan_nic=excluded.lan_nic,
-		lan_nic_speed=excluded.lan_nic_speed,
-		wan_nic=excluded.wan_nic,
-		wan_nic_speed=excluded.wan_nic_speed,
-		bond_nic=excluded.bond_nic,
-		bond_nic_speed=excluded.bond_nic_speed,
-		status=excluded.status;
-	`,
+// SQLStore 基于 database/sql 的存储实现（SQLite/MySQL）
+type SQLStore struct {
+	db *DB
+}
+
+func NewSQLStore(db *DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+var (
+	_ ServerStore      = (*SQLStore)(nil)
+	_ TemplateStore    = (*SQLStore)(nil)
+	_ IdempotencyStore = (*SQLStore)(nil)
+)
+
+// notFound 将 sql.ErrNoRows 统一转换为 ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// serverColumns 为 SaveServer 写入的列（顺序与参数一致）
+var serverColumns = []string{
+	"serial", "hostname", "ip_address", "mac_address", "gateway", "install_time",
+	"sda_size", "part", "system_version", "kernel_version", "cpu_model", "cpu_processor",
+	"mem_total", "memory_num", "lan_nic", "lan_nic_speed", "wan_nic", "wan_nic_speed",
+	"bond_nic", "bond_nic_speed", "status",
+}
+
+// SaveServer 使用 UPSERT 以 serial 唯一进行插入或更新（按方言生成语句）。
+// 冲突时不覆盖 status，避免 Agent 重复上报把已装机的服务器打回 pending。
+func (st *SQLStore) SaveServer(s *Server, actor string) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var exists int
+	err = tx.QueryRow(`SELECT COUNT(1) FROM servers WHERE serial=?`, s.Serial).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(st.db.Dialect.upsertSQL("servers", "serial", serverColumns, serverColumns[1:len(serverColumns)-1]),
 		s.Serial, s.Hostname, s.IPAddress, s.MACAddress, s.Gateway, s.InstallTime,
 		s.SdaSize, s.Part, s.SystemVersion, s.KernelVersion, s.CPUModel, s.CPUProcessor,
 		s.MemTotal, s.MemoryNum, s.LanNic, s.LanNicSpeed, s.WanNic, s.WanNicSpeed,
 		s.BondNic, s.BondNicSpeed, s.Status,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		if err := insertStateChange(tx, s.Serial, "", s.Status, actor, "首次上报"); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-// MarkServerConfirmed 将状态置为 confirmed
-func MarkServerConfirmed(db *sql.DB, serial string) error {
-	_, err := db.Exec(`UPDATE servers SET status='confirmed' WHERE serial=?`, serial)
-	return err
+// TransitionServer 以 "WHERE status=旧状态" 的条件更新实现乐观并发控制
+func (st *SQLStore) TransitionServer(serial, to, actor, reason string) (*Server, error) {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var from string
+	if err := tx.QueryRow(`SELECT status FROM servers WHERE serial=?`, serial).Scan(&from); err != nil {
+		return nil, notFound(err)
+	}
+	if err := checkTransition(from, to); err != nil {
+		return nil, err
+	}
+	res, err := tx.Exec(`UPDATE servers SET status=? WHERE serial=? AND status=?`, to, serial, from)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n != 1 {
+		// 并发修改导致状态已变化
+		return nil, &TransitionError{From: from, To: to}
+	}
+	if err := insertStateChange(tx, serial, from, to, actor, reason); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return st.GetServerBySerial(serial)
+}
+
+// RevertTransition 撤销刚完成的迁移，仍以 "WHERE status=from" 防止覆盖并发修改
+func (st *SQLStore) RevertTransition(serial, from, to, actor, reason string) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`UPDATE servers SET status=? WHERE serial=? AND status=?`, to, serial, from)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n != 1 {
+		return &TransitionError{From: from, To: to}
+	}
+	if err := insertStateChange(tx, serial, from, to, actor, reason); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// MarkServerInstalled 将状态置为 installed
-func MarkServerInstalled(db *sql.DB, serial string) error {
-	_, err := db.Exec(`UPDATE servers SET status='installed' WHERE serial=?`, serial)
+func insertStateChange(tx *sql.Tx, serial, from, to, actor, reason string) error {
+	_, err := tx.Exec(`INSERT INTO server_state_history(serial, from_status, to_status, actor, reason) VALUES (?,?,?,?,?)`,
+		serial, from, to, actor, reason)
 	return err
 }
 
-// ListServers 根据状态筛选
-func ListServers(db *sql.DB, status string) ([]Server, error) {
-	q := `SELECT id, serial, hostname, ip_address, mac_address, gateway, install_time,
+// ListServerHistory 按时间顺序返回状态迁移历史
+func (st *SQLStore) ListServerHistory(serial string) ([]StateChange, error) {
+	rows, err := st.db.Query(`SELECT id, serial, from_status, to_status, actor, reason, created_at
+	      FROM server_state_history WHERE serial=? ORDER BY id`, serial)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []StateChange{}
+	for rows.Next() {
+		var h StateChange
+		if err := rows.Scan(&h.ID, &h.Serial, &h.FromStatus, &h.ToStatus, &h.Actor, &h.Reason, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, h)
+	}
+	return res, rows.Err()
+}
+
+const serverSelect = `SELECT id, serial, hostname, ip_address, mac_address, gateway, install_time,
 	      sda_size, part, system_version, kernel_version, cpu_model, cpu_processor,
 	      mem_total, memory_num, lan_nic, lan_nic_speed, wan_nic, wan_nic_speed,
-	      bond_nic, bond_nic_speed, status, created_at, updated_at FROM servers`
-	var rows *sql.Rows
-	var err error
-	if status != "" {
-		q += ` WHERE status=?`
-		rows, err = db.Query(q, status)
-	} else {
-		rows, err = db.Query(q)
+	      bond_nic, bond_nic_speed, status, created_at, updated_at, template_id, template_revision FROM servers`
+
+// ListServers 按条件筛选、排序并分页。
+// IP 网段条件无法在两种方言下统一用 SQL 表达，设置时改为在 Go 侧过滤后再分页。
+func (st *SQLStore) ListServers(q ServerQuery) (*ServerPage, error) {
+	q.normalize()
+	where, args := q.where()
+	order := " ORDER BY " + q.Sort
+	if q.Desc {
+		order += " DESC"
+	}
+	if q.Sort != "id" {
+		order += ", id"
+	}
+	page := &ServerPage{Items: []Server{}, Page: q.Page, PageSize: q.PageSize}
+	offset := (q.Page - 1) * q.PageSize
+
+	if q.IPPrefix.IsValid() {
+		all, err := st.queryServers(serverSelect+where+order, args...)
+		if err != nil {
+			return nil, err
+		}
+		for i := range all {
+			if !q.matchIP(&all[i]) {
+				continue
+			}
+			if page.Total >= offset && len(page.Items) < q.PageSize {
+				page.Items = append(page.Items, all[i])
+			}
+			page.Total++
+		}
+		return page, nil
 	}
+
+	if err := st.db.QueryRow(`SELECT COUNT(1) FROM servers`+where, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+	items, err := st.queryServers(serverSelect+where+order+" LIMIT ? OFFSET ?", append(args, q.PageSize, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	page.Items = items
+	return page, nil
+}
+
+func (st *SQLStore) queryServers(q string, args ...interface{}) ([]Server, error) {
+	rows, err := st.db.Query(q, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -81,7 +209,7 @@ func ListServers(db *sql.DB, status string) ([]Server, error) {
 			&s.ID, &s.Serial, &s.Hostname, &s.IPAddress, &s.MACAddress, &s.Gateway, &s.InstallTime,
 			&s.SdaSize, &s.Part, &s.SystemVersion, &s.KernelVersion, &s.CPUModel, &s.CPUProcessor,
 			&s.MemTotal, &s.MemoryNum, &s.LanNic, &s.LanNicSpeed, &s.WanNic, &s.WanNicSpeed,
-			&s.BondNic, &s.BondNicSpeed, &s.Status, &s.CreatedAt, &s.UpdatedAt,
+			&s.BondNic, &s.BondNicSpeed, &s.Status, &s.CreatedAt, &s.UpdatedAt, &s.TemplateID, &s.TemplateRevision,
 		); err != nil {
 			return nil, err
 		}
@@ -91,55 +219,151 @@ func ListServers(db *sql.DB, status string) ([]Server, error) {
 }
 
 // GetServerBySerial 获取详情
-func GetServerBySerial(db *sql.DB, serial string) (*Server, error) {
-	row := db.QueryRow(`SELECT id, serial, hostname, ip_address, mac_address, gateway, install_time,
-	      sda_size, part, system_version, kernel_version, cpu_model, cpu_processor,
-	      mem_total, memory_num, lan_nic, lan_nic_speed, wan_nic, wan_nic_speed,
-	      bond_nic, bond_nic_speed, status, created_at, updated_at FROM servers WHERE serial=?`, serial)
+func (st *SQLStore) GetServerBySerial(serial string) (*Server, error) {
+	row := st.db.QueryRow(serverSelect+` WHERE serial=?`, serial)
 	var s Server
 	if err := row.Scan(
 		&s.ID, &s.Serial, &s.Hostname, &s.IPAddress, &s.MACAddress, &s.Gateway, &s.InstallTime,
 		&s.SdaSize, &s.Part, &s.SystemVersion, &s.KernelVersion, &s.CPUModel, &s.CPUProcessor,
 		&s.MemTotal, &s.MemoryNum, &s.LanNic, &s.LanNicSpeed, &s.WanNic, &s.WanNicSpeed,
-		&s.BondNic, &s.BondNicSpeed, &s.Status, &s.CreatedAt, &s.UpdatedAt,
+		&s.BondNic, &s.BondNicSpeed, &s.Status, &s.CreatedAt, &s.UpdatedAt, &s.TemplateID, &s.TemplateRevision,
 	); err != nil {
-		return nil, err
+		return nil, notFound(err)
 	}
 	return &s, nil
 }
 
+// SetServerTemplate 影响 0 行时再查询服务器是否存在：MySQL 在值未变化时也返回 0 行
+func (st *SQLStore) SetServerTemplate(serial string, templateID, revision int) error {
+	res, err := st.db.Exec(`UPDATE servers SET template_id=?, template_revision=? WHERE serial=?`, templateID, revision, serial)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	var one int
+	return notFound(st.db.QueryRow(`SELECT 1 FROM servers WHERE serial=?`, serial).Scan(&one))
+}
+
 // Config 模板 CRUD（简单实现）
-func ListConfigs(db *sql.DB) ([]ConfigTemplate, error) {
-	rows, err := db.Query(`SELECT id, name, description, system_type, system_version, config_content, kernel_params, packages, status, created_at FROM config_templates`)
-	if err != nil { return nil, err }
+func (st *SQLStore) ListConfigs() ([]ConfigTemplate, error) {
+	rows, err := st.db.Query(configSelect)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 	var res []ConfigTemplate
 	for rows.Next() {
-		var c ConfigTemplate
-		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.SystemType, &c.SystemVersion, &c.ConfigContent, &c.KernelParams, &c.Packages, &c.Status, &c.CreatedAt); err != nil { return nil, err }
-		res = append(res, c)
+		c, err := scanConfig(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *c)
 	}
 	return res, rows.Err()
 }
 
-func GetConfig(db *sql.DB, id int) (*ConfigTemplate, error) {
-	row := db.QueryRow(`SELECT id, name, description, system_type, system_version, config_content, kernel_params, packages, status, created_at FROM config_templates WHERE id=?`, id)
+const configSelect = `SELECT id, name, description, system_type, system_version, config_content, kernel_params, packages, status, created_at, variables, revision FROM config_templates`
+
+func scanConfig(row interface{ Scan(...interface{}) error }) (*ConfigTemplate, error) {
 	var c ConfigTemplate
-	if err := row.Scan(&c.ID, &c.Name, &c.Description, &c.SystemType, &c.SystemVersion, &c.ConfigContent, &c.KernelParams, &c.Packages, &c.Status, &c.CreatedAt); err != nil { return nil, err }
+	var vars string
+	if err := row.Scan(&c.ID, &c.Name, &c.Description, &c.SystemType, &c.SystemVersion, &c.ConfigContent, &c.KernelParams, &c.Packages, &c.Status, &c.CreatedAt, &vars, &c.Revision); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(vars), &c.Variables); err != nil {
+		return nil, fmt.Errorf("模板 %d 的变量定义无法解析: %w", c.ID, err)
+	}
 	return &c, nil
 }
 
-func CreateConfig(db *sql.DB, c *ConfigTemplate) (int64, error) {
-	res, err := db.Exec(`INSERT INTO config_templates(name, description, system_type, system_version, config_content, kernel_params, packages, status) VALUES (?,?,?,?,?,?,?,?)`,
-		c.Name, c.Description, c.SystemType, c.SystemVersion, c.ConfigContent, c.KernelParams, c.Packages, c.Status,
+// marshalVariables 将变量定义编码为 JSON，nil 保存为空数组
+func marshalVariables(vars []TemplateVariable) (string, error) {
+	if vars == nil {
+		vars = []TemplateVariable{}
+	}
+	b, err := json.Marshal(vars)
+	return string(b), err
+}
+
+func (st *SQLStore) GetConfig(id int) (*ConfigTemplate, error) {
+	c, err := scanConfig(st.db.QueryRow(configSelect+` WHERE id=?`, id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return c, nil
+}
+
+func (st *SQLStore) CreateConfig(c *ConfigTemplate, author, comment string) (int64, error) {
+	vars, err := marshalVariables(c.Variables)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := st.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`INSERT INTO config_templates(name, description, system_type, system_version, config_content, kernel_params, packages, status, variables, revision) VALUES (?,?,?,?,?,?,?,?,?,1)`,
+		c.Name, c.Description, c.SystemType, c.SystemVersion, c.ConfigContent, c.KernelParams, c.Packages, c.Status, vars,
 	)
-	if err != nil { return 0, err }
-	return res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := insertRevision(tx, int(id), 1, c, vars, author, comment); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
 }
 
-func UpdateConfig(db *sql.DB, id int, c *ConfigTemplate) error {
-	_, err := db.Exec(`UPDATE config_templates SET name=?, description=?, system_type=?, system_version=?, config_content=?, kernel_params=?, packages=?, status=? WHERE id=?`,
-		c.Name, c.Description, c.SystemType, c.SystemVersion, c.ConfigContent, c.KernelParams, c.Packages, c.Status, id,
+func (st *SQLStore) UpdateConfig(id int, c *ConfigTemplate, author, comment string) (int, error) {
+	vars, err := marshalVariables(c.Variables)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := st.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var cur int
+	if err := tx.QueryRow(`SELECT revision FROM config_templates WHERE id=?`, id).Scan(&cur); err != nil {
+		return 0, notFound(err)
+	}
+	rev := cur + 1
+	// 以旧版本号为条件更新，并发修改时不会产生重复的版本
+	res, err := tx.Exec(`UPDATE config_templates SET name=?, description=?, system_type=?, system_version=?, config_content=?, kernel_params=?, packages=?, status=?, variables=?, revision=? WHERE id=? AND revision=?`,
+		c.Name, c.Description, c.SystemType, c.SystemVersion, c.ConfigContent, c.KernelParams, c.Packages, c.Status, vars, rev, id, cur,
 	)
-	return err
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return 0, err
+	} else if n != 1 {
+		return 0, fmt.Errorf("模板 %d 已被并发修改", id)
+	}
+	if err := insertRevision(tx, id, rev, c, vars, author, comment); err != nil {
+		return 0, err
+	}
+	return rev, tx.Commit()
+}
+
+// MarkProcessed 依赖 (serial, request_id) 主键去重
+func (st *SQLStore) MarkProcessed(serial, requestID string) (bool, error) {
+	_, err := st.db.Exec(`INSERT INTO processed_requests(serial, request_id) VALUES(?,?)`, serial, requestID)
+	if err == nil {
+		return true, nil
+	}
+	// 插入失败时确认是否为主键冲突，其余错误原样返回
+	var one int
+	if qerr := st.db.QueryRow(`SELECT 1 FROM processed_requests WHERE serial=? AND request_id=?`, serial, requestID).Scan(&one); qerr == nil {
+		return false, nil
+	}
+	return false, err
 }
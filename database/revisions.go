@@ -0,0 +1,62 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+const revisionSelect = `SELECT id, template_id, revision, author, comment, created_at,
+	      name, description, system_type, system_version, config_content, kernel_params, packages, status, variables
+	      FROM config_template_revisions`
+
+func scanRevision(row interface{ Scan(...interface{}) error }) (*TemplateRevision, error) {
+	var r TemplateRevision
+	var vars string
+	t := &r.Template
+	if err := row.Scan(&r.ID, &r.TemplateID, &r.Revision, &r.Author, &r.Comment, &r.CreatedAt,
+		&t.Name, &t.Description, &t.SystemType, &t.SystemVersion, &t.ConfigContent, &t.KernelParams, &t.Packages, &t.Status, &vars,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(vars), &t.Variables); err != nil {
+		return nil, fmt.Errorf("模板 %d 版本 %d 的变量定义无法解析: %w", r.TemplateID, r.Revision, err)
+	}
+	t.ID, t.Revision, t.CreatedAt = r.TemplateID, r.Revision, r.CreatedAt
+	return &r, nil
+}
+
+// insertRevision 在模板写入的同一事务中保存快照；vars 为已编码的变量定义
+func insertRevision(tx *sql.Tx, templateID, revision int, c *ConfigTemplate, vars, author, comment string) error {
+	_, err := tx.Exec(`INSERT INTO config_template_revisions(template_id, revision, name, description, system_type, system_version,
+	      config_content, kernel_params, packages, status, variables, author, comment) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		templateID, revision, c.Name, c.Description, c.SystemType, c.SystemVersion,
+		c.ConfigContent, c.KernelParams, c.Packages, c.Status, vars, author, comment,
+	)
+	return err
+}
+
+func (st *SQLStore) ListConfigRevisions(id int) ([]TemplateRevision, error) {
+	rows, err := st.db.Query(revisionSelect+` WHERE template_id=? ORDER BY revision`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []TemplateRevision{}
+	for rows.Next() {
+		r, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *r)
+	}
+	return res, rows.Err()
+}
+
+func (st *SQLStore) GetConfigRevision(id, revision int) (*TemplateRevision, error) {
+	r, err := scanRevision(st.db.QueryRow(revisionSelect+` WHERE template_id=? AND revision=?`, id, revision))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return r, nil
+}
@@ -0,0 +1,81 @@
+package database
+
+var _ SnippetStore = (*SQLStore)(nil)
+
+const snippetSelect = `SELECT id, name, description, content, updated_by, created_at, updated_at FROM template_snippets`
+
+func scanSnippet(row interface{ Scan(...interface{}) error }) (*TemplateSnippet, error) {
+	var s TemplateSnippet
+	if err := row.Scan(&s.ID, &s.Name, &s.Description, &s.Content, &s.UpdatedBy, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (st *SQLStore) ListSnippets() ([]TemplateSnippet, error) {
+	rows, err := st.db.Query(snippetSelect + ` ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []TemplateSnippet{}
+	for rows.Next() {
+		s, err := scanSnippet(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *s)
+	}
+	return res, rows.Err()
+}
+
+func (st *SQLStore) GetSnippet(id int) (*TemplateSnippet, error) {
+	s, err := scanSnippet(st.db.QueryRow(snippetSelect+` WHERE id=?`, id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return s, nil
+}
+
+func (st *SQLStore) GetSnippetByName(name string) (*TemplateSnippet, error) {
+	s, err := scanSnippet(st.db.QueryRow(snippetSelect+` WHERE name=?`, name))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return s, nil
+}
+
+// snippetNameTaken 判断片段名是否已被其他片段占用
+func (st *SQLStore) snippetNameTaken(name string, exceptID int) (bool, error) {
+	var n int
+	err := st.db.QueryRow(`SELECT COUNT(1) FROM template_snippets WHERE name=? AND id<>?`, name, exceptID).Scan(&n)
+	return n > 0, err
+}
+
+func (st *SQLStore) CreateSnippet(s *TemplateSnippet) (int64, error) {
+	if taken, err := st.snippetNameTaken(s.Name, 0); err != nil {
+		return 0, err
+	} else if taken {
+		return 0, ErrSnippetExists
+	}
+	res, err := st.db.Exec(`INSERT INTO template_snippets(name, description, content, updated_by) VALUES (?,?,?,?)`,
+		s.Name, s.Description, s.Content, s.UpdatedBy)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (st *SQLStore) UpdateSnippet(id int, s *TemplateSnippet) error {
+	if taken, err := st.snippetNameTaken(s.Name, id); err != nil {
+		return err
+	} else if taken {
+		return ErrSnippetExists
+	}
+	return st.execAffected(`UPDATE template_snippets SET name=?, description=?, content=?, updated_by=?, updated_at=CURRENT_TIMESTAMP WHERE id=?`,
+		s.Name, s.Description, s.Content, s.UpdatedBy, id)
+}
+
+func (st *SQLStore) DeleteSnippet(id int) error {
+	return st.execAffected(`DELETE FROM template_snippets WHERE id=?`, id)
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound 表示记录不存在（各存储实现统一返回该错误）
+	ErrNotFound = errors.New("记录不存在")
+	// ErrUserExists 表示用户名已被占用
+	ErrUserExists = errors.New("用户名已存在")
+	// ErrSnippetExists 表示片段名已被占用
+	ErrSnippetExists = errors.New("片段名已存在")
+)
+
+// ServerStore 服务器信息存储
+type ServerStore interface {
+	// SaveServer 新建或更新服务器上报信息；已存在服务器的状态保持不变，
+	// 新服务器以 s.Status 作为初始状态并记录历史
+	SaveServer(s *Server, actor string) error
+	// TransitionServer 按状态机迁移并记录历史；非法迁移返回 ErrIllegalTransition
+	TransitionServer(serial, to, actor, reason string) (*Server, error)
+	// RevertTransition 在当前状态仍为 from 时将其恢复为 to 并记录历史，不经状态机校验；
+	// 仅用于撤销本次请求刚完成的迁移，状态已被并发修改时返回 ErrIllegalTransition
+	RevertTransition(serial, from, to, actor, reason string) error
+	ListServerHistory(serial string) ([]StateChange, error)
+	ListServers(q ServerQuery) (*ServerPage, error)
+	GetServerBySerial(serial string) (*Server, error)
+	// SetServerTemplate 记录服务器应用的模板及其修订版本
+	SetServerTemplate(serial string, templateID, revision int) error
+}
+
+// TemplateStore 配置模板存储
+type TemplateStore interface {
+	ListConfigs() ([]ConfigTemplate, error)
+	GetConfig(id int) (*ConfigTemplate, error)
+	// CreateConfig 新建模板并保存为修订版本 1
+	CreateConfig(c *ConfigTemplate, author, comment string) (int64, error)
+	// UpdateConfig 更新模板并保存为新的修订版本，返回新版本号；模板不存在返回 ErrNotFound
+	UpdateConfig(id int, c *ConfigTemplate, author, comment string) (int, error)
+	// ListConfigRevisions 按版本号升序返回模板的全部修订版本
+	ListConfigRevisions(id int) ([]TemplateRevision, error)
+	GetConfigRevision(id, revision int) (*TemplateRevision, error)
+}
+
+// SnippetStore 模板片段存储
+type SnippetStore interface {
+	ListSnippets() ([]TemplateSnippet, error)
+	GetSnippet(id int) (*TemplateSnippet, error)
+	GetSnippetByName(name string) (*TemplateSnippet, error)
+	// CreateSnippet/UpdateSnippet 片段名重复返回 ErrSnippetExists
+	CreateSnippet(s *TemplateSnippet) (int64, error)
+	UpdateSnippet(id int, s *TemplateSnippet) error
+	DeleteSnippet(id int) error
+}
+
+// VariableStore 服务器/分组变量覆盖存储
+type VariableStore interface {
+	// ListServerVariables 按 scope/target 过滤，参数为空表示不过滤
+	ListServerVariables(scope, target string) ([]ServerVariable, error)
+	// SetServerVariable 按 (scope, target, name) 新建或覆盖，返回记录 ID
+	SetServerVariable(v *ServerVariable) (int64, error)
+	DeleteServerVariable(id int) error
+}
+
+// IdempotencyStore 记录已处理的上报请求
+type IdempotencyStore interface {
+	// MarkProcessed 记录 (serial, requestID)；首次出现返回 true，重复返回 false
+	MarkProcessed(serial, requestID string) (bool, error)
+}
+
+// UserStore 用户账号与登录会话存储
+type UserStore interface {
+	// CreateUser 新建用户（含 u.Roles），用户名重复返回 ErrUserExists
+	CreateUser(u *User) (int64, error)
+	// GetUserByID/GetUserByUsername/ListUsers 返回的用户均已填充 Roles
+	GetUserByID(id int) (*User, error)
+	GetUserByUsername(username string) (*User, error)
+	ListUsers() ([]User, error)
+	CountUsers() (int, error)
+	// SetUserRoles 以 roles 整体替换用户的角色
+	SetUserRoles(userID int, roles []string) error
+	// SetUserPassword 更新用户密码哈希
+	SetUserPassword(userID int, hash string) error
+
+	CreateSession(s *Session) error
+	// GetSession 按会话 ID 哈希查询，已过期或吊销的会话也会返回，由调用方判断
+	GetSession(id string) (*Session, error)
+	RevokeSession(id string) error
+	// RevokeUserSessions 吊销用户的全部会话（注销所有设备、修改密码时使用）
+	RevokeUserSessions(userID int) error
+}
+
+// APIKeyStore API 密钥与注册令牌存储
+type APIKeyStore interface {
+	CreateAPIKey(k *APIKey) (int64, error)
+	// GetAPIKeyByHash 按密钥哈希查询，已过期或吊销的密钥也会返回，由调用方判断
+	GetAPIKeyByHash(hash string) (*APIKey, error)
+	ListAPIKeys() ([]APIKey, error)
+	RevokeAPIKey(id int) error
+	TouchAPIKey(id int, t time.Time) error
+
+	CreateEnrollmentToken(t *EnrollmentToken) (int64, error)
+	ListEnrollmentTokens() ([]EnrollmentToken, error)
+	RevokeEnrollmentToken(id int) error
+	// ConsumeEnrollmentToken 原子地消耗一次使用次数；令牌不存在、已吊销、
+	// 已过期或次数用尽时返回 ErrNotFound
+	ConsumeEnrollmentToken(hash string, now time.Time) (*EnrollmentToken, error)
+}
+
+// CertificateStore 为内置 CA 签发的证书记录存储
+type CertificateStore interface {
+	CreateCertificate(c *Certificate) error
+	GetCertificate(serial string) (*Certificate, error)
+	ListCertificates() ([]Certificate, error)
+	// RevokeCertificate 吊销证书，已吊销时保持原吊销时间；不存在时返回 ErrNotFound
+	RevokeCertificate(serial string, at time.Time) error
+	ListRevokedCertificates() ([]Certificate, error)
+	// HasActiveCertificate 判断该服务器序列号是否有未吊销且未过期的证书
+	HasActiveCertificate(commonName string, now time.Time) (bool, error)
+}
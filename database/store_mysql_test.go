@@ -0,0 +1,46 @@
+//go:build mysql
+
+package database
+
+import (
+	"os"
+	"testing"
+
+	"pxe-manager/config"
+)
+
+// openMySQL 连接 PXE_TEST_MYSQL_DSN 指定的数据库，回滚全部迁移后重新执行，使每个子测试从空库开始。
+// 该库中的数据会被清空，请使用专用的测试库，例如：
+//
+//	PXE_TEST_MYSQL_DSN='root:password@tcp(127.0.0.1:3306)/pxe_test?parseTime=true' go test -tags mysql ./database/
+func openMySQL(t *testing.T) *DB {
+	t.Helper()
+	dsn := os.Getenv("PXE_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("未设置 PXE_TEST_MYSQL_DSN，跳过 MySQL 测试")
+	}
+	cfg := &config.Config{}
+	cfg.Database.Driver = string(DialectMySQL)
+	cfg.Database.MySQLDSN = dsn
+	db, err := InitDB(cfg)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	applied, err := MigrationStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RollbackMigrations(db, len(applied)); err != nil {
+		t.Fatalf("RollbackMigrations: %v", err)
+	}
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	return db
+}
+
+func TestMySQLStore(t *testing.T) {
+	runStoreTests(t, func(t *testing.T) testStore { return NewSQLStore(openMySQL(t)) })
+	runSQLStoreTests(t, openMySQL)
+}
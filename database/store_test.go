@@ -0,0 +1,505 @@
+package database
+
+import (
+	"errors"
+	"net/netip"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"pxe-manager/config"
+)
+
+// testStore 为 SQLStore 与 MemoryStore 共同实现的接口，供共用的仓储测试使用
+type testStore interface {
+	ServerStore
+	TemplateStore
+	IdempotencyStore
+	UserStore
+	APIKeyStore
+	SnippetStore
+	VariableStore
+	CertificateStore
+}
+
+// openSQLite 在临时目录创建数据库并执行全部迁移
+func openSQLite(t *testing.T) *DB {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Database.Driver = string(DialectSQLite)
+	cfg.Database.SQLitePath = filepath.Join(t.TempDir(), "pxe.db")
+	db, err := InitDB(cfg)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	return db
+}
+
+func TestSQLiteStore(t *testing.T) {
+	runStoreTests(t, func(t *testing.T) testStore { return NewSQLStore(openSQLite(t)) })
+	runSQLStoreTests(t, openSQLite)
+}
+
+func TestMemoryStore(t *testing.T) {
+	runStoreTests(t, func(*testing.T) testStore { return NewMemoryStore() })
+}
+
+// runStoreTests 对每个子测试调用 open 获得空的存储
+func runStoreTests(t *testing.T, open func(t *testing.T) testStore) {
+	t.Run("ServerLifecycle", func(t *testing.T) { testServerLifecycle(t, open(t)) })
+	t.Run("ListServers", func(t *testing.T) { testListServers(t, open(t)) })
+	t.Run("TemplateRevisions", func(t *testing.T) { testTemplateRevisions(t, open(t)) })
+	t.Run("Idempotency", func(t *testing.T) { testIdempotency(t, open(t)) })
+	t.Run("Users", func(t *testing.T) { testUsers(t, open(t)) })
+	t.Run("APIKeys", func(t *testing.T) { testAPIKeys(t, open(t)) })
+	t.Run("Snippets", func(t *testing.T) { testSnippets(t, open(t)) })
+	t.Run("Variables", func(t *testing.T) { testVariables(t, open(t)) })
+	t.Run("Certificates", func(t *testing.T) { testCertificates(t, open(t)) })
+}
+
+// runSQLStoreTests 覆盖迁移回滚，仅适用于 SQL 数据库
+func runSQLStoreTests(t *testing.T, open func(t *testing.T) *DB) {
+	t.Run("MigrationsRoundTrip", func(t *testing.T) { testMigrationsRoundTrip(t, open(t)) })
+}
+
+func saveServer(t *testing.T, st ServerStore, s Server) {
+	t.Helper()
+	if s.Status == "" {
+		s.Status = StatusPending
+	}
+	if err := st.SaveServer(&s, "agent"); err != nil {
+		t.Fatalf("SaveServer(%s): %v", s.Serial, err)
+	}
+}
+
+func testServerLifecycle(t *testing.T, st testStore) {
+	saveServer(t, st, Server{Serial: "S1", Hostname: "node1", MACAddress: "aa:bb:cc:dd:ee:01", MemTotal: 64})
+	if _, err := st.GetServerBySerial("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetServerBySerial(missing): err = %v", err)
+	}
+	if _, err := st.TransitionServer("missing", StatusConfirmed, "admin", ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("TransitionServer(missing): err = %v", err)
+	}
+	if _, err := st.TransitionServer("S1", StatusConfirmed, "admin", "确认"); err != nil {
+		t.Fatalf("TransitionServer: %v", err)
+	}
+	if err := st.SetServerTemplate("S1", 7, 2); err != nil {
+		t.Fatalf("SetServerTemplate: %v", err)
+	}
+	// 值未变化时 MySQL 影响 0 行，不能误报为不存在
+	if err := st.SetServerTemplate("S1", 7, 2); err != nil {
+		t.Fatalf("SetServerTemplate(unchanged): %v", err)
+	}
+	if err := st.SetServerTemplate("missing", 7, 2); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("SetServerTemplate(missing): err = %v", err)
+	}
+	// 重复上报更新硬件信息，但不改变状态与已应用的模板
+	saveServer(t, st, Server{Serial: "S1", Hostname: "node1-renamed", MACAddress: "aa:bb:cc:dd:ee:01", MemTotal: 128})
+	s, err := st.GetServerBySerial("S1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Status != StatusConfirmed || s.Hostname != "node1-renamed" || s.MemTotal != 128 {
+		t.Fatalf("after re-report: status=%s hostname=%s mem=%d", s.Status, s.Hostname, s.MemTotal)
+	}
+	if s.TemplateID != 7 || s.TemplateRevision != 2 {
+		t.Fatalf("template = %d/%d, want 7/2", s.TemplateID, s.TemplateRevision)
+	}
+
+	var te *TransitionError
+	if _, err := st.TransitionServer("S1", StatusInstalled, "admin", ""); !errors.As(err, &te) || !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("confirmed → installed: err = %v", err)
+	}
+	if te.From != StatusConfirmed || te.To != StatusInstalled {
+		t.Fatalf("TransitionError = %+v", te)
+	}
+
+	// 应用失败时撤销 confirmed → provisioning；当前状态不符时拒绝撤销
+	if _, err := st.TransitionServer("S1", StatusProvisioning, "admin", "应用"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.RevertTransition("S1", StatusInstalling, StatusConfirmed, "admin", ""); !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("RevertTransition with stale from: err = %v", err)
+	}
+	if err := st.RevertTransition("S1", StatusProvisioning, StatusConfirmed, "admin", "恢复"); err != nil {
+		t.Fatalf("RevertTransition: %v", err)
+	}
+	if _, err := st.TransitionServer("S1", StatusProvisioning, "admin", "应用"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.TransitionServer("S1", StatusInstalled, "admin", "标记安装完成"); err != nil {
+		t.Fatalf("provisioning → installed: %v", err)
+	}
+
+	hist, err := st.ListServerHistory("S1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, h := range hist {
+		got = append(got, h.FromStatus+"→"+h.ToStatus)
+	}
+	want := []string{
+		"→pending", "pending→confirmed", "confirmed→provisioning", "provisioning→confirmed",
+		"confirmed→provisioning", "provisioning→installed",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("history = %v, want %v", got, want)
+	}
+	if hist[0].Actor != "agent" || hist[1].Actor != "admin" || hist[1].Reason != "确认" {
+		t.Fatalf("history[0:2] = %+v", hist[:2])
+	}
+}
+
+func testListServers(t *testing.T, st testStore) {
+	for i, s := range []Server{
+		{Serial: "A-1", Hostname: "web-1", IPAddress: "10.0.0.1", MemTotal: 32},
+		{Serial: "A-2", Hostname: "web-2", IPAddress: "10.0.0.2", MemTotal: 64},
+		{Serial: "B-1", Hostname: "db-1", IPAddress: "10.0.1.1", MemTotal: 128},
+	} {
+		s.MACAddress = "aa:bb:cc:dd:ee:0" + string(rune('1'+i))
+		saveServer(t, st, s)
+	}
+	if _, err := st.TransitionServer("B-1", StatusConfirmed, "admin", ""); err != nil {
+		t.Fatal(err)
+	}
+	serials := func(q ServerQuery) []string {
+		t.Helper()
+		page, err := st.ListServers(q)
+		if err != nil {
+			t.Fatalf("ListServers(%+v): %v", q, err)
+		}
+		res := []string{}
+		for _, s := range page.Items {
+			res = append(res, s.Serial)
+		}
+		return res
+	}
+	memMin := 64
+	tests := []struct {
+		name string
+		q    ServerQuery
+		want []string
+	}{
+		{"all", ServerQuery{}, []string{"A-1", "A-2", "B-1"}},
+		{"status", ServerQuery{Status: StatusConfirmed}, []string{"B-1"}},
+		{"hostname prefix", ServerQuery{HostnamePrefix: "web-"}, []string{"A-1", "A-2"}},
+		{"mac", ServerQuery{MAC: "AA:BB:CC:DD:EE:02"}, []string{"A-2"}},
+		{"mem min", ServerQuery{MemMin: &memMin}, []string{"A-2", "B-1"}},
+		{"sort desc", ServerQuery{Sort: "memTotal", Desc: true}, []string{"B-1", "A-2", "A-1"}},
+		{"page 2", ServerQuery{PageSize: 2, Page: 2}, []string{"B-1"}},
+		{"cidr /24", ServerQuery{IPPrefix: netip.MustParsePrefix("10.0.0.0/24")}, []string{"A-1", "A-2"}},
+		{"cidr /23", ServerQuery{IPPrefix: netip.MustParsePrefix("10.0.0.0/23")}, []string{"A-1", "A-2", "B-1"}},
+		{"cidr /20", ServerQuery{IPPrefix: netip.MustParsePrefix("10.0.16.0/20")}, []string{}},
+		{"cidr /4", ServerQuery{IPPrefix: netip.MustParsePrefix("0.0.0.0/4")}, []string{"A-1", "A-2", "B-1"}},
+		{"single ip", ServerQuery{IPPrefix: netip.MustParsePrefix("10.0.0.1/32")}, []string{"A-1"}},
+	}
+	for _, tt := range tests {
+		if got := serials(tt.q); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	page, err := st.ListServers(ServerQuery{PageSize: 2})
+	if err != nil || page.Total != 3 {
+		t.Fatalf("total = %v, %v", page, err)
+	}
+
+	// SQL 按文本前缀预筛选时不能漏掉 IPv4 映射地址，也不能把 10.0.1.10 当作 10.0.1.1
+	saveServer(t, st, Server{Serial: "C-1", MACAddress: "aa:bb:cc:dd:ee:04", IPAddress: "::ffff:10.0.1.9"})
+	saveServer(t, st, Server{Serial: "C-2", MACAddress: "aa:bb:cc:dd:ee:05", IPAddress: "10.0.1.10"})
+	if got := serials(ServerQuery{IPPrefix: netip.MustParsePrefix("10.0.1.0/28")}); !reflect.DeepEqual(got, []string{"B-1", "C-1", "C-2"}) {
+		t.Errorf("mapped: got %v", got)
+	}
+	if got := serials(ServerQuery{IPPrefix: netip.MustParsePrefix("10.0.1.1/32")}); !reflect.DeepEqual(got, []string{"B-1"}) {
+		t.Errorf("single ip: got %v", got)
+	}
+}
+
+func testTemplateRevisions(t *testing.T, st testStore) {
+	tpl := &ConfigTemplate{
+		Name: "centos7", SystemType: "centos", SystemVersion: "7", ConfigContent: "install\n",
+		Variables: []TemplateVariable{{Name: "disk", Type: "string", Required: true}},
+	}
+	id64, err := st.CreateConfig(tpl, "alice", "初始版本")
+	if err != nil {
+		t.Fatalf("CreateConfig: %v", err)
+	}
+	id := int(id64)
+	got, err := st.GetConfig(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Revision != 1 || got.Name != "centos7" || len(got.Variables) != 1 || got.Variables[0].Name != "disk" {
+		t.Fatalf("GetConfig = %+v", got)
+	}
+
+	upd := *got
+	upd.ConfigContent = "install\nreboot\n"
+	rev, err := st.UpdateConfig(id, &upd, "bob", "加入 reboot")
+	if err != nil || rev != 2 {
+		t.Fatalf("UpdateConfig = %d, %v", rev, err)
+	}
+	if _, err := st.UpdateConfig(id+100, &upd, "bob", ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("UpdateConfig(missing): err = %v", err)
+	}
+
+	revs, err := st.ListConfigRevisions(id)
+	if err != nil || len(revs) != 2 {
+		t.Fatalf("ListConfigRevisions = %d, %v", len(revs), err)
+	}
+	if revs[0].Revision != 1 || revs[0].Author != "alice" || revs[0].Template.ConfigContent != "install\n" {
+		t.Fatalf("revision 1 = %+v", revs[0])
+	}
+	if revs[1].Revision != 2 || revs[1].Comment != "加入 reboot" {
+		t.Fatalf("revision 2 = %+v", revs[1])
+	}
+	r1, err := st.GetConfigRevision(id, 1)
+	if err != nil || r1.Template.ConfigContent != "install\n" {
+		t.Fatalf("GetConfigRevision(1) = %+v, %v", r1, err)
+	}
+	if _, err := st.GetConfigRevision(id, 3); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetConfigRevision(3): err = %v", err)
+	}
+	cur, err := st.GetConfig(id)
+	if err != nil || cur.Revision != 2 || cur.ConfigContent != "install\nreboot\n" {
+		t.Fatalf("current = %+v, %v", cur, err)
+	}
+	list, err := st.ListConfigs()
+	if err != nil || len(list) != 1 {
+		t.Fatalf("ListConfigs = %d, %v", len(list), err)
+	}
+}
+
+func testIdempotency(t *testing.T, st testStore) {
+	for _, tt := range []struct {
+		serial, req string
+		first       bool
+	}{
+		{"S1", "r1", true},
+		{"S1", "r1", false},
+		{"S1", "r2", true},
+		{"S2", "r1", true},
+	} {
+		first, err := st.MarkProcessed(tt.serial, tt.req)
+		if err != nil || first != tt.first {
+			t.Fatalf("MarkProcessed(%s, %s) = %v, %v; want %v", tt.serial, tt.req, first, err, tt.first)
+		}
+	}
+}
+
+func testUsers(t *testing.T, st testStore) {
+	id64, err := st.CreateUser(&User{Username: "alice", PasswordHash: "h1", Source: UserSourceLocal, Roles: []string{"admin"}})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := st.CreateUser(&User{Username: "alice", PasswordHash: "h2", Source: UserSourceLocal}); !errors.Is(err, ErrUserExists) {
+		t.Fatalf("duplicate CreateUser: err = %v", err)
+	}
+	id := int(id64)
+	if err := st.SetUserRoles(id, []string{"operator", "viewer"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetUserPassword(id, "h3"); err != nil {
+		t.Fatal(err)
+	}
+	u, err := st.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != id || u.PasswordHash != "h3" || !reflect.DeepEqual(u.Roles, []string{"operator", "viewer"}) {
+		t.Fatalf("user = %+v", u)
+	}
+	if _, err := st.GetUserByID(id + 100); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetUserByID(missing): err = %v", err)
+	}
+	if n, err := st.CountUsers(); err != nil || n != 1 {
+		t.Fatalf("CountUsers = %d, %v", n, err)
+	}
+
+	exp := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	for _, sid := range []string{"s1", "s2"} {
+		if err := st.CreateSession(&Session{ID: sid, UserID: id, ClientIP: "127.0.0.1", ExpiresAt: exp}); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+	}
+	s, err := st.GetSession("s1")
+	if err != nil || s.UserID != id || !s.ExpiresAt.Equal(exp) || s.Revoked {
+		t.Fatalf("GetSession = %+v, %v", s, err)
+	}
+	if err := st.RevokeSession("s1"); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := st.GetSession("s1"); s == nil || !s.Revoked {
+		t.Fatalf("s1 not revoked: %+v", s)
+	}
+	if err := st.RevokeUserSessions(id); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := st.GetSession("s2"); s == nil || !s.Revoked {
+		t.Fatalf("s2 not revoked: %+v", s)
+	}
+}
+
+func testAPIKeys(t *testing.T, st testStore) {
+	exp := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	id64, err := st.CreateAPIKey(&APIKey{Name: "agent-1", Prefix: "pxe_ab", KeyHash: "hash1", Scopes: []string{"report:write"}, CreatedBy: "admin", ExpiresAt: &exp})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	k, err := st.GetAPIKeyByHash("hash1")
+	if err != nil || k.ID != int(id64) || !reflect.DeepEqual(k.Scopes, []string{"report:write"}) || k.ExpiresAt == nil || !k.ExpiresAt.Equal(exp) {
+		t.Fatalf("GetAPIKeyByHash = %+v, %v", k, err)
+	}
+	if _, err := st.GetAPIKeyByHash("nope"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetAPIKeyByHash(missing): err = %v", err)
+	}
+	used := time.Now().UTC().Truncate(time.Second)
+	if err := st.TouchAPIKey(k.ID, used); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.RevokeAPIKey(k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.RevokeAPIKey(k.ID + 100); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("RevokeAPIKey(missing): err = %v", err)
+	}
+	keys, err := st.ListAPIKeys()
+	if err != nil || len(keys) != 1 || !keys[0].Revoked || keys[0].LastUsedAt == nil || !keys[0].LastUsedAt.Equal(used) {
+		t.Fatalf("ListAPIKeys = %+v, %v", keys, err)
+	}
+
+	now := time.Now()
+	tid, err := st.CreateEnrollmentToken(&EnrollmentToken{Name: "rack-1", Prefix: "pxe_en", TokenHash: "tok", Scopes: []string{"report:write"}, MaxUses: 2, SerialPattern: "A12-*", CreatedBy: "admin"})
+	if err != nil {
+		t.Fatalf("CreateEnrollmentToken: %v", err)
+	}
+	for i := 1; i <= 2; i++ {
+		tok, err := st.ConsumeEnrollmentToken("tok", now)
+		if err != nil || tok.Uses != i || tok.SerialPattern != "A12-*" {
+			t.Fatalf("consume #%d = %+v, %v", i, tok, err)
+		}
+	}
+	if _, err := st.ConsumeEnrollmentToken("tok", now); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("exhausted token: err = %v", err)
+	}
+
+	past := now.Add(-time.Minute)
+	if _, err := st.CreateEnrollmentToken(&EnrollmentToken{Name: "old", Prefix: "pxe_en", TokenHash: "expired", MaxUses: 1, CreatedBy: "admin", ExpiresAt: &past}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.ConsumeEnrollmentToken("expired", now); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expired token: err = %v", err)
+	}
+	if err := st.RevokeEnrollmentToken(int(tid)); err != nil {
+		t.Fatal(err)
+	}
+	toks, err := st.ListEnrollmentTokens()
+	if err != nil || len(toks) != 2 {
+		t.Fatalf("ListEnrollmentTokens = %+v, %v", toks, err)
+	}
+}
+
+func testSnippets(t *testing.T, st testStore) {
+	id, err := st.CreateSnippet(&TemplateSnippet{Name: "partitions", Content: "part / --size=1", UpdatedBy: "alice"})
+	if err != nil {
+		t.Fatalf("CreateSnippet: %v", err)
+	}
+	if _, err := st.CreateSnippet(&TemplateSnippet{Name: "partitions"}); !errors.Is(err, ErrSnippetExists) {
+		t.Fatalf("duplicate CreateSnippet: err = %v", err)
+	}
+	if err := st.UpdateSnippet(int(id), &TemplateSnippet{Name: "disks", Content: "part /boot", UpdatedBy: "bob"}); err != nil {
+		t.Fatalf("UpdateSnippet: %v", err)
+	}
+	s, err := st.GetSnippetByName("disks")
+	if err != nil || s.Content != "part /boot" || s.UpdatedBy != "bob" {
+		t.Fatalf("GetSnippetByName = %+v, %v", s, err)
+	}
+	if err := st.DeleteSnippet(int(id)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.GetSnippet(int(id)); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("deleted snippet: err = %v", err)
+	}
+}
+
+func testVariables(t *testing.T, st testStore) {
+	v := &ServerVariable{Scope: VarScopeServer, Target: "S1", Name: "disk", Value: "sda", UpdatedBy: "alice"}
+	id, err := st.SetServerVariable(v)
+	if err != nil {
+		t.Fatalf("SetServerVariable: %v", err)
+	}
+	// 同一 (scope, target, name) 覆盖原值
+	v2 := &ServerVariable{Scope: VarScopeServer, Target: "S1", Name: "disk", Value: "nvme0n1", UpdatedBy: "bob"}
+	if id2, err := st.SetServerVariable(v2); err != nil || id2 != id {
+		t.Fatalf("overwrite = %d, %v; want id %d", id2, err, id)
+	}
+	list, err := st.ListServerVariables(VarScopeServer, "S1")
+	if err != nil || len(list) != 1 || list[0].Value != "nvme0n1" {
+		t.Fatalf("ListServerVariables = %+v, %v", list, err)
+	}
+	if err := st.DeleteServerVariable(int(id)); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := st.ListServerVariables("", ""); len(list) != 0 {
+		t.Fatalf("after delete: %+v", list)
+	}
+}
+
+func testCertificates(t *testing.T, st testStore) {
+	nb := time.Now().UTC().Truncate(time.Second)
+	c := &Certificate{Serial: "0a1b", CommonName: "S1", IssuedVia: "enroll", NotBefore: nb, NotAfter: nb.Add(24 * time.Hour)}
+	if err := st.CreateCertificate(c); err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	if ok, err := st.HasActiveCertificate("S1", nb); err != nil || !ok {
+		t.Fatalf("HasActiveCertificate = %v, %v", ok, err)
+	}
+	if ok, _ := st.HasActiveCertificate("S1", c.NotAfter); ok {
+		t.Fatal("expired certificate counted as active")
+	}
+	at := nb.Add(time.Minute)
+	if err := st.RevokeCertificate("0a1b", at); err != nil {
+		t.Fatal(err)
+	}
+	// 重复吊销保持原吊销时间
+	if err := st.RevokeCertificate("0a1b", at.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.RevokeCertificate("ffff", at); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("RevokeCertificate(missing): err = %v", err)
+	}
+	if ok, _ := st.HasActiveCertificate("S1", nb); ok {
+		t.Fatal("revoked certificate counted as active")
+	}
+	revoked, err := st.ListRevokedCertificates()
+	if err != nil || len(revoked) != 1 || revoked[0].RevokedAt == nil || !revoked[0].RevokedAt.Equal(at) {
+		t.Fatalf("ListRevokedCertificates = %+v, %v", revoked, err)
+	}
+	got, err := st.GetCertificate("0a1b")
+	if err != nil || !got.NotAfter.Equal(c.NotAfter) || got.CommonName != "S1" {
+		t.Fatalf("GetCertificate = %+v, %v", got, err)
+	}
+}
+
+// testMigrationsRoundTrip 回滚全部迁移后重新执行，确保 down 脚本与 up 脚本互相匹配
+func testMigrationsRoundTrip(t *testing.T, db *DB) {
+	applied, err := MigrationStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RollbackMigrations(db, len(applied)); err != nil {
+		t.Fatalf("RollbackMigrations: %v", err)
+	}
+	if left, err := MigrationStatus(db); err != nil || len(left) != 0 {
+		t.Fatalf("after rollback: %d applied, %v", len(left), err)
+	}
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations after rollback: %v", err)
+	}
+	saveServer(t, NewSQLStore(db), Server{Serial: "S1", MACAddress: "aa:bb:cc:dd:ee:01"})
+}
@@ -0,0 +1,194 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+var _ UserStore = (*SQLStore)(nil)
+
+const userSelect = `SELECT id, username, password_hash, disabled, source, created_at, updated_at FROM users`
+
+func (st *SQLStore) CreateUser(u *User) (int64, error) {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var exists int
+	if err := tx.QueryRow(`SELECT COUNT(1) FROM users WHERE username=?`, u.Username).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if exists > 0 {
+		return 0, ErrUserExists
+	}
+	source := u.Source
+	if source == "" {
+		source = UserSourceLocal
+	}
+	res, err := tx.Exec(`INSERT INTO users(username, password_hash, disabled, source) VALUES (?,?,?,?)`,
+		u.Username, u.PasswordHash, u.Disabled, source)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := insertUserRoles(tx, int(id), u.Roles); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func insertUserRoles(tx *sql.Tx, userID int, roles []string) error {
+	for _, r := range roles {
+		if _, err := tx.Exec(`INSERT INTO user_roles(user_id, role) VALUES (?,?)`, userID, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (st *SQLStore) GetUserByID(id int) (*User, error) {
+	return st.getUser(userSelect+` WHERE id=?`, id)
+}
+
+func (st *SQLStore) GetUserByUsername(username string) (*User, error) {
+	return st.getUser(userSelect+` WHERE username=?`, username)
+}
+
+func (st *SQLStore) getUser(q string, arg interface{}) (*User, error) {
+	var u User
+	if err := scanUser(st.db.QueryRow(q, arg), &u); err != nil {
+		return nil, notFound(err)
+	}
+	roles, err := st.userRoles(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	u.Roles = roles
+	return &u, nil
+}
+
+func scanUser(row interface{ Scan(...interface{}) error }, u *User) error {
+	return row.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Disabled, &u.Source, &u.CreatedAt, &u.UpdatedAt)
+}
+
+func (st *SQLStore) userRoles(userID int) ([]string, error) {
+	rows, err := st.db.Query(`SELECT role FROM user_roles WHERE user_id=? ORDER BY role`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	roles := []string{}
+	for rows.Next() {
+		var r string
+		if err := rows.Scan(&r); err != nil {
+			return nil, err
+		}
+		roles = append(roles, r)
+	}
+	return roles, rows.Err()
+}
+
+// ListUsers 按 id 排序返回全部用户及其角色
+func (st *SQLStore) ListUsers() ([]User, error) {
+	rows, err := st.db.Query(userSelect + ` ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	res := []User{}
+	for rows.Next() {
+		var u User
+		if err := scanUser(rows, &u); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		res = append(res, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	roleRows, err := st.db.Query(`SELECT user_id, role FROM user_roles ORDER BY role`)
+	if err != nil {
+		return nil, err
+	}
+	defer roleRows.Close()
+	byID := map[int][]string{}
+	for roleRows.Next() {
+		var id int
+		var r string
+		if err := roleRows.Scan(&id, &r); err != nil {
+			return nil, err
+		}
+		byID[id] = append(byID[id], r)
+	}
+	for i := range res {
+		res[i].Roles = byID[res[i].ID]
+		if res[i].Roles == nil {
+			res[i].Roles = []string{}
+		}
+	}
+	return res, roleRows.Err()
+}
+
+func (st *SQLStore) SetUserRoles(userID int, roles []string) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var exists int
+	if err := tx.QueryRow(`SELECT COUNT(1) FROM users WHERE id=?`, userID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return ErrNotFound
+	}
+	if _, err := tx.Exec(`DELETE FROM user_roles WHERE user_id=?`, userID); err != nil {
+		return err
+	}
+	if err := insertUserRoles(tx, userID, roles); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (st *SQLStore) SetUserPassword(userID int, hash string) error {
+	return st.execAffected(`UPDATE users SET password_hash=?, updated_at=CURRENT_TIMESTAMP WHERE id=?`, hash, userID)
+}
+
+func (st *SQLStore) CountUsers() (int, error) {
+	var n int
+	err := st.db.QueryRow(`SELECT COUNT(1) FROM users`).Scan(&n)
+	return n, err
+}
+
+func (st *SQLStore) CreateSession(s *Session) error {
+	_, err := st.db.Exec(`INSERT INTO sessions(id, user_id, client_ip, expires_at) VALUES (?,?,?,?)`,
+		s.ID, s.UserID, s.ClientIP, s.ExpiresAt.Unix())
+	return err
+}
+
+func (st *SQLStore) GetSession(id string) (*Session, error) {
+	var s Session
+	var expires int64
+	err := st.db.QueryRow(`SELECT id, user_id, client_ip, expires_at, revoked, created_at FROM sessions WHERE id=?`, id).
+		Scan(&s.ID, &s.UserID, &s.ClientIP, &expires, &s.Revoked, &s.CreatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	s.ExpiresAt = time.Unix(expires, 0)
+	return &s, nil
+}
+
+func (st *SQLStore) RevokeSession(id string) error {
+	return st.execAffected(`UPDATE sessions SET revoked=1 WHERE id=?`, id)
+}
+
+func (st *SQLStore) RevokeUserSessions(userID int) error {
+	_, err := st.db.Exec(`UPDATE sessions SET revoked=1 WHERE user_id=? AND revoked=0`, userID)
+	return err
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+var _ VariableStore = (*SQLStore)(nil)
+
+const variableSelect = `SELECT id, scope, target, name, value, priority, updated_by, created_at, updated_at FROM server_variables`
+
+func scanVariable(row interface{ Scan(...interface{}) error }) (*ServerVariable, error) {
+	var v ServerVariable
+	var value string
+	if err := row.Scan(&v.ID, &v.Scope, &v.Target, &v.Name, &value, &v.Priority, &v.UpdatedBy, &v.CreatedAt, &v.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(value), &v.Value); err != nil {
+		return nil, fmt.Errorf("变量 %d 的值无法解析: %w", v.ID, err)
+	}
+	return &v, nil
+}
+
+func (st *SQLStore) ListServerVariables(scope, target string) ([]ServerVariable, error) {
+	var where []string
+	var args []interface{}
+	if scope != "" {
+		where, args = append(where, "scope=?"), append(args, scope)
+	}
+	if target != "" {
+		where, args = append(where, "target=?"), append(args, target)
+	}
+	q := variableSelect
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	rows, err := st.db.Query(q+` ORDER BY scope, target, name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []ServerVariable{}
+	for rows.Next() {
+		v, err := scanVariable(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *v)
+	}
+	return res, rows.Err()
+}
+
+var variableColumns = []string{"scope", "target", "name", "value", "priority", "updated_by"}
+
+func (st *SQLStore) SetServerVariable(v *ServerVariable) (int64, error) {
+	value, err := json.Marshal(v.Value)
+	if err != nil {
+		return 0, err
+	}
+	q := st.db.Dialect.upsertSQL("server_variables", "scope, target, name", variableColumns, []string{"value", "priority", "updated_by"})
+	if st.db.Dialect == DialectSQLite {
+		// SQLite 的 ON CONFLICT 更新不会自动刷新 updated_at
+		q += ", updated_at=CURRENT_TIMESTAMP"
+	}
+	if _, err := st.db.Exec(q, v.Scope, v.Target, v.Name, string(value), v.Priority, v.UpdatedBy); err != nil {
+		return 0, err
+	}
+	var id int64
+	err = st.db.QueryRow(`SELECT id FROM server_variables WHERE scope=? AND target=? AND name=?`, v.Scope, v.Target, v.Name).Scan(&id)
+	return id, err
+}
+
+func (st *SQLStore) DeleteServerVariable(id int) error {
+	return st.execAffected(`DELETE FROM server_variables WHERE id=?`, id)
+}
@@ -1,12 +1,24 @@
 package main
 
 import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 
 	"pxe-manager/api"
+	"pxe-manager/audit"
+	"pxe-manager/auth"
 	"pxe-manager/config"
 	"pxe-manager/database"
+	"pxe-manager/pki"
+	"pxe-manager/utils"
 )
 
 func main() {
@@ -19,14 +31,197 @@ func main() {
 	}
 	defer db.Close()
 
+	// 子命令：pxe-manager migrate up|down [N]|status / audit verify / user add <用户名> [角色...]
+	if len(os.Args) > 1 {
+		if err := runCommand(cfg, db, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// 运行迁移
 	if err := database.RunMigrations(db); err != nil {
 		log.Fatalf("数据库迁移失败: %v", err)
 	}
 
 	// 设置路由
-	router := api.SetupRouter(db, cfg)
+	// 审计日志（file/database 后端由配置决定）
+	var auditLogger *audit.AuditLogger
+	if cfg.Auth.EnableAudit {
+		al, err := api.NewAuditLogger(cfg, db.DB)
+		if err != nil {
+			log.Printf("初始化审计日志失败: %v", err)
+		} else {
+			auditLogger = al
+			defer al.Close()
+		}
+	}
+
+	store := database.NewSQLStore(db)
+	if err := auth.BootstrapAdmin(store, "admin", cfg.Auth.AdminPassword); err != nil {
+		log.Printf("创建初始管理员失败: %v", err)
+	}
+	ca, err := api.NewCA(cfg, store)
+	if err != nil {
+		log.Fatalf("初始化内置 CA 失败: %v", err)
+	}
+	router := api.SetupRouter(api.Stores{
+		Servers:     store,
+		Templates:   store,
+		Idempotency: store,
+		Users:       store,
+		APIKeys:     store,
+		Certs:       store,
+		Variables:   store,
+		Snippets:    store,
+	}, auditLogger, cfg, ca)
+
+	srv := &http.Server{Addr: cfg.ServerAddress, Handler: router}
+	if cfg.TLS.CertFile == "" {
+		log.Printf("PXE管理系统启动在 %s", cfg.ServerAddress)
+		log.Fatal(srv.ListenAndServe())
+	}
+	tlsConfig, err := setupTLS(cfg.TLS, ca)
+	if err != nil {
+		log.Fatalf("初始化 TLS 失败: %v", err)
+	}
+	srv.TLSConfig = tlsConfig
+	log.Printf("PXE管理系统启动在 %s (HTTPS)", cfg.ServerAddress)
+	log.Fatal(srv.ListenAndServeTLS("", ""))
+}
+
+// setupTLS 加载证书并在收到 SIGHUP 时重新加载，加载失败时继续使用旧证书。
+// 启用内置 CA 时信任其签发的客户端证书，并在握手时拒绝已吊销的证书。
+func setupTLS(c config.TLSConfig, ca *pki.CA) (*tls.Config, error) {
+	var clientAuth tls.ClientAuthType
+	switch c.ClientAuth {
+	case "", "request":
+		clientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("不支持的 client_auth: %s", c.ClientAuth)
+	}
+	if c.RequireAgentCert && c.ClientCAFile == "" && ca == nil {
+		return nil, fmt.Errorf("require_agent_cert 需要配置 client_ca_file 或启用内置 CA")
+	}
+	reloader, err := utils.NewCertReloader(c.CertFile, c.KeyFile, c.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	if ca != nil {
+		reloader.AddClientCA(ca.Certificate())
+		reloader.SetRevocationCheck(ca.IsRevoked)
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reloader.Reload(); err != nil {
+				log.Printf("重新加载 TLS 证书失败，继续使用旧证书: %v", err)
+				continue
+			}
+			log.Printf("已重新加载 TLS 证书")
+		}
+	}()
+	return reloader.TLSConfig(clientAuth), nil
+}
 
-	log.Printf("PXE管理系统启动在 %s", cfg.ServerAddress)
-	log.Fatal(http.ListenAndServe(cfg.ServerAddress, router))
-}
\ No newline at end of file
+func runCommand(cfg *config.Config, db *database.DB, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(db, args[1:])
+	case "audit":
+		return runAudit(cfg, db, args[1:])
+	case "user":
+		return runUser(db, args[1:])
+	default:
+		return fmt.Errorf("未知子命令: %s", args[0])
+	}
+}
+
+func runMigrate(db *database.DB, args []string) error {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	switch action {
+	case "up":
+		return database.RunMigrations(db)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("回滚步数不合法: %s", args[1])
+			}
+			steps = n
+		}
+		return database.RollbackMigrations(db, steps)
+	case "status":
+		applied, err := database.MigrationStatus(db)
+		if err != nil {
+			return err
+		}
+		for _, a := range applied {
+			fmt.Printf("%03d_%s\t%s\t%s\n", a.Version, a.Name, a.AppliedAt, a.Checksum)
+		}
+		return nil
+	default:
+		return fmt.Errorf("用法: migrate up|down [N]|status")
+	}
+}
+
+func runAudit(cfg *config.Config, db *database.DB, args []string) error {
+	if len(args) == 0 || args[0] != "verify" {
+		return fmt.Errorf("用法: audit verify")
+	}
+	// 数据库审计存储依赖 audit_logs 表，与服务启动一样先执行迁移
+	if err := database.RunMigrations(db); err != nil {
+		return err
+	}
+	logger, err := api.NewAuditLogger(cfg, db.DB)
+	if err != nil {
+		return err
+	}
+	defer logger.Close()
+	res, err := logger.Verify()
+	if err != nil {
+		return err
+	}
+	if !res.OK {
+		b := res.Broken
+		return fmt.Errorf("审计日志哈希链断裂: %s 第 %d 行 (seq=%d): %s", b.Segment, b.Line, b.Seq, b.Reason)
+	}
+	fmt.Printf("审计日志哈希链完整: %d 条 (seq %d-%d)，旧格式日志 %d 条\n", res.Entries, res.FirstSeq, res.LastSeq, res.Legacy)
+	return nil
+}
+
+// runUser 新建账号，密码从标准输入读取一行，避免出现在命令行历史中
+func runUser(db *database.DB, args []string) error {
+	if len(args) < 2 || args[0] != "add" {
+		return fmt.Errorf("用法: user add <用户名> [角色...]（密码从标准输入读取）")
+	}
+	roles, bad := auth.NormalizeRoles(args[2:])
+	if bad != "" {
+		return fmt.Errorf("未知角色: %s", bad)
+	}
+	if err := database.RunMigrations(db); err != nil {
+		return err
+	}
+	fmt.Fprint(os.Stderr, "密码: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return fmt.Errorf("读取密码失败: %v", err)
+	}
+	hash, err := auth.HashPassword(strings.TrimRight(line, "\r\n"))
+	if err != nil {
+		return err
+	}
+	store := database.NewSQLStore(db)
+	if _, err := store.CreateUser(&database.User{Username: args[1], PasswordHash: hash, Roles: roles}); err != nil {
+		return err
+	}
+	fmt.Printf("已创建用户: %s %v\n", args[1], roles)
+	return nil
+}
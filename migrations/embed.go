@@ -0,0 +1,11 @@
+// Package migrations 以 embed 方式将 SQL 迁移文件打包进二进制。
+//
+// 每种数据库方言一个子目录（sqlite/、mysql/），两边版本号保持一一对应。
+// 文件命名规则：<版本号>_<名称>.up.sql / <版本号>_<名称>.down.sql，
+// 版本号单调递增；已发布的 up 文件不得再修改（启动时会校验 checksum）。
+package migrations
+
+import "embed"
+
+//go:embed sqlite/*.sql mysql/*.sql
+var FS embed.FS
@@ -0,0 +1,4 @@
+DROP EVENT IF EXISTS cleanup_processed_requests;
+DROP TABLE IF EXISTS processed_requests;
+DROP TABLE IF EXISTS config_templates;
+DROP TABLE IF EXISTS servers;
@@ -0,0 +1,61 @@
+-- servers 表
+-- install_time 由 Agent 原样上报，使用 VARCHAR 以保持与 SQLite 一致的宽松语义
+CREATE TABLE IF NOT EXISTS servers (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    serial VARCHAR(50) NOT NULL,
+    hostname VARCHAR(100),
+    ip_address VARCHAR(15),
+    mac_address VARCHAR(17),
+    gateway VARCHAR(15),
+    install_time VARCHAR(64),
+    sda_size VARCHAR(20),
+    part TEXT,
+    system_version VARCHAR(100),
+    kernel_version VARCHAR(100),
+    cpu_model VARCHAR(100),
+    cpu_processor INT,
+    mem_total INT,
+    memory_num INT,
+    lan_nic VARCHAR(50),
+    lan_nic_speed VARCHAR(50),
+    wan_nic VARCHAR(50),
+    wan_nic_speed VARCHAR(50),
+    bond_nic VARCHAR(50),
+    bond_nic_speed VARCHAR(50),
+    status VARCHAR(20) DEFAULT 'pending',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    -- 代替 SQLite 的 update_servers_timestamp 触发器
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_servers_serial (serial),
+    KEY idx_servers_mac (mac_address),
+    KEY idx_servers_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- config_templates 表
+CREATE TABLE IF NOT EXISTS config_templates (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    system_type VARCHAR(50),
+    system_version VARCHAR(50),
+    config_content MEDIUMTEXT,
+    kernel_params TEXT,
+    packages TEXT,
+    status VARCHAR(20) DEFAULT 'active',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 幂等请求表
+CREATE TABLE IF NOT EXISTS processed_requests (
+    serial VARCHAR(50) NOT NULL,
+    request_id VARCHAR(64) NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (serial, request_id),
+    KEY idx_processed_requests_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 清理 72 小时前的幂等记录
+-- MySQL 触发器不能修改自身所在表，改用事件调度（需开启 event_scheduler）
+CREATE EVENT IF NOT EXISTS cleanup_processed_requests
+ON SCHEDULE EVERY 1 HOUR
+DO DELETE FROM processed_requests WHERE created_at < NOW() - INTERVAL 72 HOUR;
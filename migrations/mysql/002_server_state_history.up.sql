@@ -0,0 +1,11 @@
+-- 服务器状态迁移历史
+CREATE TABLE IF NOT EXISTS server_state_history (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    serial VARCHAR(50) NOT NULL,
+    from_status VARCHAR(20) NOT NULL DEFAULT '',
+    to_status VARCHAR(20) NOT NULL,
+    actor VARCHAR(100) NOT NULL DEFAULT '',
+    reason TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_server_state_history_serial (serial, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
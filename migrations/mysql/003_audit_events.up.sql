@@ -0,0 +1,20 @@
+-- 审计日志（数据库存储后端），raw 保存原始 JSON 用于哈希链校验
+CREATE TABLE IF NOT EXISTS audit_events (
+    seq BIGINT UNSIGNED PRIMARY KEY,
+    ts DATETIME NOT NULL,
+    client_ip VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    method VARCHAR(10) NOT NULL DEFAULT '',
+    path VARCHAR(255) NOT NULL DEFAULT '',
+    action VARCHAR(64) NOT NULL DEFAULT '',
+    target VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT '',
+    error TEXT NOT NULL,
+    prev_hash VARCHAR(64) NOT NULL DEFAULT '',
+    hash VARCHAR(64) NOT NULL DEFAULT '',
+    raw MEDIUMTEXT NOT NULL,
+    KEY idx_audit_events_ts (ts),
+    KEY idx_audit_events_action (action),
+    KEY idx_audit_events_target (target),
+    KEY idx_audit_events_client_ip (client_ip)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,3 @@
+ALTER TABLE audit_events DROP KEY idx_audit_events_actor, DROP COLUMN actor;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
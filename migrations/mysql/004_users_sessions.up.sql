@@ -0,0 +1,24 @@
+-- 用户账号，password_hash 为 bcrypt 哈希
+CREATE TABLE IF NOT EXISTS users (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    username VARCHAR(64) NOT NULL,
+    password_hash VARCHAR(100) NOT NULL,
+    disabled TINYINT(1) NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_users_username (username)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 登录会话，id 为会话 ID 的 sha256，令牌本身不落库
+CREATE TABLE IF NOT EXISTS sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL,
+    client_ip VARCHAR(45) NOT NULL DEFAULT '',
+    expires_at BIGINT NOT NULL, -- Unix 秒，避免两种方言的时间格式差异
+    revoked TINYINT(1) NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_sessions_user (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 审计日志记录操作者
+ALTER TABLE audit_events ADD COLUMN actor VARCHAR(64) NOT NULL DEFAULT '', ADD KEY idx_audit_events_actor (actor);
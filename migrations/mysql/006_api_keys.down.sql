@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS enrollment_tokens;
+DROP TABLE IF EXISTS api_keys;
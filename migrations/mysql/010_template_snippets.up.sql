@@ -0,0 +1,11 @@
+-- 模板片段：在模板中以 {{ include "name" }} 引用，片段之间也可相互引用（不允许循环）
+CREATE TABLE IF NOT EXISTS template_snippets (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(64) NOT NULL,
+    description TEXT,
+    content MEDIUMTEXT NOT NULL,
+    updated_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_template_snippets_name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1 @@
+ALTER TABLE enrollment_tokens DROP COLUMN serial_pattern;
@@ -0,0 +1,2 @@
+-- 注册令牌可绑定的服务器序列号通配模式（path.Match 语法），空表示不限制
+ALTER TABLE enrollment_tokens ADD COLUMN serial_pattern VARCHAR(100) NOT NULL DEFAULT '';
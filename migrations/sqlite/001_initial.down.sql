@@ -0,0 +1,11 @@
+DROP TRIGGER IF EXISTS cleanup_processed_requests;
+DROP INDEX IF EXISTS idx_processed_requests_created_at;
+DROP TABLE IF EXISTS processed_requests;
+
+DROP TABLE IF EXISTS config_templates;
+
+DROP TRIGGER IF EXISTS update_servers_timestamp;
+DROP INDEX IF EXISTS idx_servers_status;
+DROP INDEX IF EXISTS idx_servers_mac;
+DROP INDEX IF EXISTS idx_servers_serial;
+DROP TABLE IF EXISTS servers;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_server_state_history_serial;
+DROP TABLE IF EXISTS server_state_history;
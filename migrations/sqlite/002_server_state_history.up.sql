@@ -0,0 +1,12 @@
+-- 服务器状态迁移历史
+CREATE TABLE IF NOT EXISTS server_state_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    serial VARCHAR(50) NOT NULL,
+    from_status VARCHAR(20) NOT NULL DEFAULT '',
+    to_status VARCHAR(20) NOT NULL,
+    actor VARCHAR(100) NOT NULL DEFAULT '',
+    reason TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_server_state_history_serial ON server_state_history(serial, id);
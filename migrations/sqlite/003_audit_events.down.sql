@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_audit_events_client_ip;
+DROP INDEX IF EXISTS idx_audit_events_target;
+DROP INDEX IF EXISTS idx_audit_events_action;
+DROP INDEX IF EXISTS idx_audit_events_ts;
+DROP TABLE IF EXISTS audit_events;
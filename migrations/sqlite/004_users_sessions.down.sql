@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_audit_events_actor;
+ALTER TABLE audit_events DROP COLUMN actor;
+DROP INDEX IF EXISTS idx_sessions_user;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,25 @@
+-- 用户账号，password_hash 为 bcrypt 哈希
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username VARCHAR(64) NOT NULL UNIQUE,
+    password_hash VARCHAR(100) NOT NULL,
+    disabled INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 登录会话，id 为会话 ID 的 sha256，令牌本身不落库
+CREATE TABLE IF NOT EXISTS sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    client_ip VARCHAR(45) NOT NULL DEFAULT '',
+    expires_at BIGINT NOT NULL, -- Unix 秒，避免两种方言的时间格式差异
+    revoked INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
+
+-- 审计日志记录操作者
+ALTER TABLE audit_events ADD COLUMN actor VARCHAR(64) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor);
@@ -0,0 +1,10 @@
+-- 用户角色分配（viewer/operator/template-admin/auditor/agent/admin）
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id INTEGER NOT NULL,
+    role VARCHAR(32) NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role)
+);
+
+-- 初始管理员账号在引入角色前创建，授予 admin 角色以免升级后无人可管理
+INSERT INTO user_roles(user_id, role) SELECT id, 'admin' FROM users WHERE username='admin';
@@ -0,0 +1,2 @@
+-- 账号来源：local 为本地密码账号，oidc/ldap 为外部身份源自动创建的账号（无本地密码）
+ALTER TABLE users ADD COLUMN source VARCHAR(16) NOT NULL DEFAULT 'local';
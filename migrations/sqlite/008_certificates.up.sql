@@ -0,0 +1,12 @@
+-- 内置 CA 签发的 Agent 客户端证书；serial 为证书序列号的十六进制表示
+CREATE TABLE IF NOT EXISTS certificates (
+    serial VARCHAR(64) PRIMARY KEY,
+    common_name VARCHAR(64) NOT NULL, -- 绑定的服务器序列号
+    issued_via VARCHAR(200) NOT NULL DEFAULT '', -- enroll:<注册令牌名> 或 renew:<旧证书序列号>
+    not_before BIGINT NOT NULL,
+    not_after BIGINT NOT NULL,
+    revoked INTEGER NOT NULL DEFAULT 0,
+    revoked_at BIGINT NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_certificates_common_name ON certificates(common_name);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS server_variables;
+ALTER TABLE config_templates DROP COLUMN variables;
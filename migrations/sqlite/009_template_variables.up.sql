@@ -0,0 +1,17 @@
+-- 模板变量定义（JSON 数组：name/type/default/required/enum/description）
+ALTER TABLE config_templates ADD COLUMN variables TEXT NOT NULL DEFAULT '[]';
+
+-- 按服务器或服务器分组覆盖模板变量；value 为 JSON 编码的值
+-- scope=server 时 target 为服务器序列号；scope=group 时 target 为匹配序列号或主机名的通配模式（如 web-*）
+CREATE TABLE IF NOT EXISTS server_variables (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    scope VARCHAR(16) NOT NULL,
+    target VARCHAR(191) NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    value TEXT NOT NULL,
+    priority INTEGER NOT NULL DEFAULT 0, -- 多个分组同时匹配时数值大者优先
+    updated_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (scope, target, name)
+);
@@ -0,0 +1,10 @@
+-- 模板片段：在模板中以 {{ include "name" }} 引用，片段之间也可相互引用（不允许循环）
+CREATE TABLE IF NOT EXISTS template_snippets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(64) NOT NULL UNIQUE,
+    description TEXT,
+    content TEXT NOT NULL,
+    updated_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
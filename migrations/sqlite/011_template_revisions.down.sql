@@ -0,0 +1,4 @@
+ALTER TABLE servers DROP COLUMN template_revision;
+ALTER TABLE servers DROP COLUMN template_id;
+ALTER TABLE config_templates DROP COLUMN revision;
+DROP TABLE IF EXISTS config_template_revisions;
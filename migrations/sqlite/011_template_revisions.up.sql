@@ -0,0 +1,34 @@
+-- 模板的每次创建与修改都保存为不可变的修订版本，revision 从 1 开始按模板递增
+CREATE TABLE IF NOT EXISTS config_template_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    template_id INTEGER NOT NULL,
+    revision INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    system_type VARCHAR(50),
+    system_version VARCHAR(50),
+    config_content TEXT,
+    kernel_params TEXT,
+    packages TEXT,
+    status VARCHAR(20),
+    variables TEXT NOT NULL DEFAULT '[]',
+    author VARCHAR(100) NOT NULL DEFAULT '',
+    comment VARCHAR(500) NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (template_id, revision)
+);
+
+-- 模板的当前修订版本号
+ALTER TABLE config_templates ADD COLUMN revision INTEGER NOT NULL DEFAULT 0;
+
+-- 已有模板的当前内容作为修订版本 1
+INSERT INTO config_template_revisions(template_id, revision, name, description, system_type, system_version,
+    config_content, kernel_params, packages, status, variables, author, comment, created_at)
+SELECT id, 1, name, description, system_type, system_version,
+    config_content, kernel_params, packages, status, variables, '', '启用版本记录前的内容', created_at
+FROM config_templates;
+UPDATE config_templates SET revision=1;
+
+-- 服务器最近一次应用的模板及其修订版本，0 表示未应用
+ALTER TABLE servers ADD COLUMN template_id INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE servers ADD COLUMN template_revision INTEGER NOT NULL DEFAULT 0;
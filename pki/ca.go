@@ -0,0 +1,297 @@
+// Package pki 实现内置的小型证书颁发机构，为 Agent 签发短期客户端证书，
+// 使隔离的装机网络无需外部 PKI 即可启用 mTLS。
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"pxe-manager/database"
+)
+
+var (
+	// ErrInvalidCSR 表示证书签名请求无法解析或签名无效
+	ErrInvalidCSR = errors.New("无效的证书签名请求")
+	// ErrInvalidSerial 表示绑定的服务器序列号不合法
+	ErrInvalidSerial = errors.New("无效的服务器序列号")
+	// ErrAlreadyEnrolled 表示该服务器已持有有效证书，须先吊销或凭现有证书续期
+	ErrAlreadyEnrolled = errors.New("该服务器已有有效证书，请凭现有证书续期或先吊销")
+)
+
+const (
+	rootValidity = 10 * 365 * 24 * time.Hour
+	// 签发时向前回拨，容忍 Agent 与服务端之间的时钟偏差
+	backdate = 5 * time.Minute
+)
+
+// 服务器序列号会写入证书 CN，限制字符集避免歧义
+var serialPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// CA 持有根证书与私钥；吊销列表常驻内存以便在 TLS 握手中快速检查
+type CA struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     crypto.Signer
+	store   database.CertificateStore
+	ttl     time.Duration // 客户端证书有效期
+	crlTTL  time.Duration // CRL 的 NextUpdate 间隔
+
+	enrollMu sync.Mutex // 串行化首次签发的检查与写入
+
+	mu      sync.RWMutex
+	revoked map[string]time.Time // 证书序列号 → 吊销时间
+	crl     []byte               // DER 编码，nil 表示需要重新生成
+	crlNext time.Time
+}
+
+// LoadOrCreate 从 dir 加载根证书（ca.pem/ca.key），不存在时生成新的根证书
+func LoadOrCreate(dir string, store database.CertificateStore, ttl, crlTTL time.Duration) (*CA, error) {
+	certPath, keyPath := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca.key")
+	if _, err := os.Stat(certPath); os.IsNotExist(err) {
+		if err := generateRoot(dir, certPath, keyPath); err != nil {
+			return nil, err
+		}
+	}
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取 CA 证书失败: %w", err)
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取 CA 私钥失败: %w", err)
+	}
+	cb, _ := pem.Decode(certPEM)
+	kb, _ := pem.Decode(keyPEM)
+	if cb == nil || kb == nil {
+		return nil, errors.New("CA 证书或私钥格式错误")
+	}
+	cert, err := x509.ParseCertificate(cb.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析 CA 证书失败: %w", err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(kb.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析 CA 私钥失败: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("CA 私钥类型不支持签名")
+	}
+
+	ca := &CA{cert: cert, certPEM: certPEM, key: signer, store: store, ttl: ttl, crlTTL: crlTTL, revoked: map[string]time.Time{}}
+	revoked, err := store.ListRevokedCertificates()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range revoked {
+		ca.revoked[c.Serial] = *c.RevokedAt
+	}
+	return ca, nil
+}
+
+// generateRoot 生成 ECDSA P-256 根证书；私钥以 0600 权限写入，且不覆盖已有文件
+func generateRoot(dir, certPath, keyPath string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "pxe-manager agent CA"},
+		NotBefore:             now.Add(-backdate),
+		NotAfter:              now.Add(rootValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	kf, err := os.OpenFile(keyPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("写入 CA 私钥失败: %w", err)
+	}
+	if err := pem.Encode(kf, &pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}); err != nil {
+		kf.Close()
+		return err
+	}
+	if err := kf.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// Certificate 返回根证书
+func (ca *CA) Certificate() *x509.Certificate { return ca.cert }
+
+// CertificatePEM 返回 PEM 编码的根证书，供 Agent 校验服务端或配置信任
+func (ca *CA) CertificatePEM() []byte { return ca.certPEM }
+
+// Issue 按 CSR 签发绑定 serial 的客户端证书：CN 固定为服务器序列号，
+// 忽略 CSR 中的主题与扩展，仅使用其公钥
+func (ca *CA) Issue(csrPEM []byte, serial, issuedVia string) (*database.Certificate, []byte, error) {
+	if !serialPattern.MatchString(serial) {
+		return nil, nil, ErrInvalidSerial
+	}
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, nil, ErrInvalidCSR
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil || csr.CheckSignature() != nil {
+		return nil, nil, ErrInvalidCSR
+	}
+	sn, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: sn,
+		Subject:      pkix.Name{CommonName: serial},
+		NotBefore:    now.Add(-backdate),
+		NotAfter:     now.Add(ca.ttl),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, csr.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	rec := &database.Certificate{
+		Serial:     serialHex(sn),
+		CommonName: serial,
+		IssuedVia:  issuedVia,
+		NotBefore:  tmpl.NotBefore,
+		NotAfter:   tmpl.NotAfter,
+	}
+	if err := ca.store.CreateCertificate(rec); err != nil {
+		return nil, nil, err
+	}
+	return rec, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// Enroll 为尚无有效证书的服务器首次签发证书；已有未吊销且未过期的证书时返回 ErrAlreadyEnrolled，
+// 防止持有批量注册令牌的一台机器冒领其他服务器的身份
+func (ca *CA) Enroll(csrPEM []byte, serial, issuedVia string) (*database.Certificate, []byte, error) {
+	if !serialPattern.MatchString(serial) {
+		return nil, nil, ErrInvalidSerial
+	}
+	ca.enrollMu.Lock()
+	defer ca.enrollMu.Unlock()
+	active, err := ca.store.HasActiveCertificate(serial, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	if active {
+		return nil, nil, ErrAlreadyEnrolled
+	}
+	return ca.Issue(csrPEM, serial, issuedVia)
+}
+
+func serialHex(n *big.Int) string {
+	return fmt.Sprintf("%x", n)
+}
+
+// Revoke 吊销证书并使缓存的 CRL 失效；serial 为十六进制，允许 openssl 输出的大写与前导零
+func (ca *CA) Revoke(serial string) (*database.Certificate, error) {
+	n, ok := new(big.Int).SetString(serial, 16)
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	serial = serialHex(n)
+	if err := ca.store.RevokeCertificate(serial, time.Now()); err != nil {
+		return nil, err
+	}
+	c, err := ca.store.GetCertificate(serial)
+	if err != nil {
+		return nil, err
+	}
+	ca.mu.Lock()
+	ca.revoked[c.Serial] = *c.RevokedAt
+	ca.crl = nil
+	ca.mu.Unlock()
+	return c, nil
+}
+
+// Issued 判断证书是否由本 CA 签发（调用方需已完成链校验）
+func (ca *CA) Issued(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, ca.cert.RawSubject)
+}
+
+// IsRevoked 判断证书是否已被本 CA 吊销；其他 CA 签发的证书不在此检查
+func (ca *CA) IsRevoked(cert *x509.Certificate) bool {
+	if !ca.Issued(cert) {
+		return false
+	}
+	ca.mu.RLock()
+	defer ca.mu.RUnlock()
+	_, ok := ca.revoked[serialHex(cert.SerialNumber)]
+	return ok
+}
+
+// CRL 返回 DER 编码的证书吊销列表；吊销后或接近 NextUpdate 时重新签发
+func (ca *CA) CRL() ([]byte, error) {
+	now := time.Now()
+	ca.mu.RLock()
+	crl, next := ca.crl, ca.crlNext
+	ca.mu.RUnlock()
+	if crl != nil && now.Before(next.Add(-ca.crlTTL/2)) {
+		return crl, nil
+	}
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	entries := make([]pkix.RevokedCertificate, 0, len(ca.revoked))
+	for s, at := range ca.revoked {
+		n, ok := new(big.Int).SetString(s, 16)
+		if !ok {
+			continue
+		}
+		entries = append(entries, pkix.RevokedCertificate{SerialNumber: n, RevocationTime: at})
+	}
+	tmpl := &x509.RevocationList{
+		Number:              big.NewInt(now.UnixNano()), // 单调递增即可
+		ThisUpdate:          now,
+		NextUpdate:          now.Add(ca.crlTTL),
+		RevokedCertificates: entries,
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, tmpl, ca.cert, ca.key)
+	if err != nil {
+		return nil, err
+	}
+	ca.crl, ca.crlNext = der, tmpl.NextUpdate
+	return der, nil
+}
@@ -0,0 +1,218 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pxe-manager/database"
+)
+
+func newTestCA(t *testing.T, dir string, store database.CertificateStore) *CA {
+	t.Helper()
+	ca, err := LoadOrCreate(dir, store, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("LoadOrCreate: %v", err)
+	}
+	return ca
+}
+
+// newCSR 生成 CSR；tmpl 中的主题与扩展应被 CA 忽略
+func newCSR(t *testing.T, tmpl *x509.CertificateRequest) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func parseCert(t *testing.T, certPEM []byte) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		t.Fatalf("invalid PEM: %q", certPEM)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestLoadOrCreate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "ca")
+	store := database.NewMemoryStore()
+	ca := newTestCA(t, dir, store)
+	root := ca.Certificate()
+	if !root.IsCA || root.KeyUsage&x509.KeyUsageCertSign == 0 || !root.MaxPathLenZero {
+		t.Fatalf("root = IsCA %v usage %v", root.IsCA, root.KeyUsage)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "ca.key")); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("ca.key mode = %v, %v", fi.Mode(), err)
+	}
+
+	// 再次加载复用同一根证书，此前签发的证书仍可校验
+	_, certPEM, err := ca.Issue(newCSR(t, &x509.CertificateRequest{}), "S1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded := newTestCA(t, dir, store)
+	if !reloaded.Certificate().Equal(root) {
+		t.Fatal("reload generated a new root")
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(reloaded.Certificate())
+	if _, err := parseCert(t, certPEM).Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Fatalf("Verify with reloaded root: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "ca.key"), []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadOrCreate(dir, store, time.Hour, time.Hour); err == nil {
+		t.Fatal("corrupt key accepted")
+	}
+}
+
+func TestIssueBindsSerial(t *testing.T) {
+	store := database.NewMemoryStore()
+	ca := newTestCA(t, t.TempDir(), store)
+	csr := newCSR(t, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "OTHER-SERIAL"},
+		DNSNames: []string{"pxe.example.com"},
+	})
+	rec, certPEM, err := ca.Issue(csr, "S1", "enroll:rack-a")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	cert := parseCert(t, certPEM)
+	if cert.Subject.CommonName != "S1" || len(cert.DNSNames) != 0 || len(cert.IPAddresses) != 0 {
+		t.Fatalf("subject %q SAN %v %v", cert.Subject.CommonName, cert.DNSNames, cert.IPAddresses)
+	}
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth || cert.IsCA {
+		t.Fatalf("ext key usage = %v, IsCA %v", cert.ExtKeyUsage, cert.IsCA)
+	}
+	if !ca.Issued(cert) || ca.IsRevoked(cert) {
+		t.Fatal("issued certificate not recognised")
+	}
+	if d := cert.NotAfter.Sub(time.Now()); d > time.Hour || d < 59*time.Minute {
+		t.Fatalf("validity = %v", d)
+	}
+	got, err := store.GetCertificate(serialHex(cert.SerialNumber))
+	if err != nil || got.Serial != rec.Serial || got.CommonName != "S1" || got.IssuedVia != "enroll:rack-a" {
+		t.Fatalf("record = %+v, %v", got, err)
+	}
+}
+
+func TestIssueRejectsBadInput(t *testing.T) {
+	ca := newTestCA(t, t.TempDir(), database.NewMemoryStore())
+	good := newCSR(t, &x509.CertificateRequest{})
+	block, _ := pem.Decode(good)
+	tampered := append([]byte{}, block.Bytes...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	for name, csr := range map[string][]byte{
+		"not PEM":   []byte("hello"),
+		"wrong PEM": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: block.Bytes}),
+		"garbage":   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: []byte{1, 2, 3}}),
+		"bad sig":   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: tampered}),
+	} {
+		if _, _, err := ca.Issue(csr, "S1", "test"); !errors.Is(err, ErrInvalidCSR) {
+			t.Errorf("%s: err = %v, want ErrInvalidCSR", name, err)
+		}
+	}
+	for _, serial := range []string{"", "a b", "S1/../x", "CN=S1,O=x"} {
+		if _, _, err := ca.Issue(good, serial, "test"); !errors.Is(err, ErrInvalidSerial) {
+			t.Errorf("serial %q: err = %v, want ErrInvalidSerial", serial, err)
+		}
+	}
+	if certs, _ := ca.store.ListCertificates(); len(certs) != 0 {
+		t.Fatalf("rejected requests recorded: %+v", certs)
+	}
+}
+
+func TestEnrollOnce(t *testing.T) {
+	ca := newTestCA(t, t.TempDir(), database.NewMemoryStore())
+	rec, _, err := ca.Enroll(newCSR(t, &x509.CertificateRequest{}), "S1", "enroll:rack-a")
+	if err != nil {
+		t.Fatalf("Enroll: %v", err)
+	}
+	if _, _, err := ca.Enroll(newCSR(t, &x509.CertificateRequest{}), "S1", "enroll:rack-a"); !errors.Is(err, ErrAlreadyEnrolled) {
+		t.Fatalf("second Enroll: err = %v, want ErrAlreadyEnrolled", err)
+	}
+	if _, err := ca.Revoke(rec.Serial); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ca.Enroll(newCSR(t, &x509.CertificateRequest{}), "S1", "enroll:rack-a"); err != nil {
+		t.Fatalf("Enroll after revoke: %v", err)
+	}
+}
+
+func TestRevokeAndCRL(t *testing.T) {
+	dir, store := t.TempDir(), database.NewMemoryStore()
+	ca := newTestCA(t, dir, store)
+	_, keepPEM, err := ca.Issue(newCSR(t, &x509.CertificateRequest{}), "S1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, revokePEM, err := ca.Issue(newCSR(t, &x509.CertificateRequest{}), "S2", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keep, revoked := parseCert(t, keepPEM), parseCert(t, revokePEM)
+
+	before, err := ca.CRL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// openssl 输出的序列号为大写，可能带前导零
+	if _, err := ca.Revoke("00" + strings.ToUpper(revoked.SerialNumber.Text(16))); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := ca.Revoke("zz"); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("Revoke(invalid): err = %v", err)
+	}
+	if !ca.IsRevoked(revoked) || ca.IsRevoked(keep) {
+		t.Fatal("IsRevoked mismatch")
+	}
+
+	der, err := ca.CRL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(der) == string(before) {
+		t.Fatal("CRL not regenerated after revoke")
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.CheckSignatureFrom(ca.Certificate()); err != nil {
+		t.Fatalf("CRL signature: %v", err)
+	}
+	if len(crl.RevokedCertificates) != 1 || crl.RevokedCertificates[0].SerialNumber.Cmp(revoked.SerialNumber) != 0 {
+		t.Fatalf("CRL entries = %+v", crl.RevokedCertificates)
+	}
+	if !crl.NextUpdate.After(crl.ThisUpdate) {
+		t.Fatalf("NextUpdate %v <= ThisUpdate %v", crl.NextUpdate, crl.ThisUpdate)
+	}
+
+	// 吊销状态持久化在存储中，重新加载后仍生效
+	if !newTestCA(t, dir, store).IsRevoked(revoked) {
+		t.Fatal("revocation lost on reload")
+	}
+}
@@ -32,37 +32,89 @@ func DefaultPXEConfig() *PXEConfig {
 type Generator struct {
 	TFTPRoot  string
 	PXEConfig *PXEConfig
+	Settings  Settings
+	Snippets  SnippetLookup
 }
 
-func (g *Generator) GenerateConfig(server *database.Server, template *database.ConfigTemplate) error {
+// 生成文件的用途
+const (
+	FileLegacyBoot = "pxelinux" // BIOS 引导的 pxelinux.cfg/01-<mac>
+	FileUEFIBoot   = "grub"     // UEFI 引导的 grub.cfg
+)
+
+// GeneratedFile 为 GenerateConfig 将写入的一个文件
+type GeneratedFile struct {
+	Path    string `json:"path"`
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Output 为模板在某台服务器上的生成结果
+type Output struct {
+	Format  string          `json:"format"`  // kickstart/preseed
+	Content string          `json:"content"` // 渲染后的 Kickstart/Preseed
+	Files   []GeneratedFile `json:"files"`   // 按写入顺序排列
+}
+
+// Render 渲染模板并计算需要写入的文件，不读写磁盘；模板渲染失败时返回 *RenderError
+func (g *Generator) Render(server *database.Server, template *database.ConfigTemplate, vars map[string]interface{}) (*Output, error) {
 	pxeFileName, err := FormatMACForPXE(server.MACAddress)
-	if err != nil { return err }
+	if err != nil {
+		return nil, err
+	}
 
-	var content string
+	ctx := &RenderContext{Server: *server, Template: *template, Settings: g.Settings, Vars: vars, Snippets: g.Snippets}
+	out := &Output{}
 	switch strings.ToLower(template.SystemType) {
 	case "centos", "rhel":
-		content = GenerateKickstart(server, template)
+		out.Format = "kickstart"
+		out.Content, err = GenerateKickstart(ctx)
 	case "ubuntu", "debian":
-		content = GeneratePreseed(server, template)
+		out.Format = "preseed"
+		out.Content, err = GeneratePreseed(ctx)
 	default:
-		return fmt.Errorf("不支持的系统类型: %s", template.SystemType)
+		return nil, fmt.Errorf("不支持的系统类型: %s", template.SystemType)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	path := filepath.Join(g.TFTPRoot, g.PXEConfig.LegacyBootPath, pxeFileName)
 	if g.PXEConfig.EnableUEFI {
 		// 可根据需要为 UEFI 写入额外配置文件
-		uefiPath := filepath.Join(g.TFTPRoot, g.PXEConfig.UEFIBootPath, g.PXEConfig.UEFIConfigFile)
-		if err := os.MkdirAll(filepath.Dir(uefiPath), 0755); err != nil {
-			return fmt.Errorf("创建UEFI配置目录失败: %w", err)
+		out.Files = append(out.Files, GeneratedFile{
+			Path:    filepath.Join(g.TFTPRoot, g.PXEConfig.UEFIBootPath, g.PXEConfig.UEFIConfigFile),
+			Role:    FileUEFIBoot,
+			Content: out.Content,
+		})
+	}
+	out.Files = append(out.Files, GeneratedFile{
+		Path:    filepath.Join(g.TFTPRoot, g.PXEConfig.LegacyBootPath, pxeFileName),
+		Role:    FileLegacyBoot,
+		Content: out.Content,
+	})
+	return out, nil
+}
+
+// GenerateConfig 渲染模板并写入 TFTP 目录；vars 为模板变量，模板渲染失败时返回 *RenderError
+func (g *Generator) GenerateConfig(server *database.Server, template *database.ConfigTemplate, vars map[string]interface{}) error {
+	out, err := g.Render(server, template, vars)
+	if err != nil {
+		return err
+	}
+	return WriteFiles(out)
+}
+
+// WriteFiles 按顺序写入 Render 生成的文件
+func WriteFiles(out *Output) error {
+	for _, f := range out.Files {
+		if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+			return fmt.Errorf("创建%s配置目录失败: %w", f.Role, err)
 		}
-		if err := os.WriteFile(uefiPath, []byte(content), 0644); err != nil {
-			return fmt.Errorf("写入UEFI配置失败: %w", err)
+		if err := os.WriteFile(f.Path, []byte(f.Content), 0644); err != nil {
+			return fmt.Errorf("写入%s配置失败: %w", f.Role, err)
 		}
 	}
-	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-		return fmt.Errorf("创建PXE配置目录失败: %w", err)
-	}
-	return os.WriteFile(path, []byte(content), 0644)
+	return nil
 }
 
 func FormatMACForPXE(mac string) (string, error) {
@@ -1,29 +1,38 @@
 package pxe
 
-import (
-	"fmt"
-	"pxe-manager/database"
-)
+import "text/template"
 
-// 简化的 Kickstart 生成（后续可替换为模板渲染）
-func GenerateKickstart(s *database.Server, t *database.ConfigTemplate) string {
-	return fmt.Sprintf(`#version=RHEL8
-# Generated for %s (%s)
+// kickstartSkeleton 为 Kickstart 外层骨架，模板内容渲染后放入 .Content
+var kickstartSkeleton = template.Must(template.New("kickstart").Funcs(templateFuncs).Option("missingkey=error").Parse(`#version=RHEL8
+# Generated for {{ .Server.Serial }} ({{ .Server.MACAddress }})
 
 install
-url --url="http://mirror.example.com/centos"
-lang en_US.UTF-8
-keyboard us
-timezone Asia/Shanghai
-network --hostname=%s --device=%s --bootproto=static --ip=%s --gateway=%s
-rootpw --plaintext pxe-default
+{{- with .Settings.MirrorURL }}
+url --url="{{ . }}"
+{{- end }}
+lang {{ .Settings.Locale }}
+keyboard {{ .Settings.Keyboard }}
+timezone {{ .Settings.Timezone }}
+network --hostname={{ .Server.Hostname }} --device={{ .Server.LanNic }} --bootproto=static --ip={{ .Server.IPAddress }} --gateway={{ .Server.Gateway }}
+{{ with .Settings.RootPasswordHash }}rootpw --iscrypted {{ . }}{{ else }}rootpw --lock{{ end }}
+{{- with .Template.KernelParams }}
+bootloader --append="{{ . }}"
+{{- end }}
 
-%s
+{{ .Content }}
+{{- with .Packages }}
 
-%s
-
-%s
+%packages
+{{- range . }}
+{{ . }}
+{{- end }}
+%end
+{{- end }}
 
 reboot
-`, s.Serial, s.MACAddress, s.Hostname, s.LanNic, s.IPAddress, s.Gateway, t.ConfigContent, t.KernelParams, t.Packages)
+`))
+
+// GenerateKickstart 渲染模板内容并套入 Kickstart 骨架
+func GenerateKickstart(ctx *RenderContext) (string, error) {
+	return renderSkeleton(kickstartSkeleton, ctx)
 }
@@ -1,27 +1,51 @@
 package pxe
 
-import (
-	"fmt"
-	"pxe-manager/database"
-)
+import "text/template"
 
-// 简化的 Preseed 生成（后续可替换为模板渲染）
-func GeneratePreseed(s *database.Server, t *database.ConfigTemplate) string {
-	return fmt.Sprintf(`# Preseed for %s (%s)
+// preseedSkeleton 为 Preseed 外层骨架，模板内容渲染后放入 .Content
+var preseedSkeleton = template.Must(template.New("preseed").Funcs(templateFuncs).Option("missingkey=error").Parse(`# Preseed for {{ .Server.Serial }} ({{ .Server.MACAddress }})
 
-d-i debian-installer/locale string en_US
-d-i keyboard-configuration/xkb-keymap select us
+d-i debian-installer/locale string {{ .Settings.Locale }}
+d-i keyboard-configuration/xkb-keymap select {{ .Settings.Keyboard }}
+d-i time/zone string {{ .Settings.Timezone }}
 
 # Network
-# This is a placeholder; real implementation should render static config
+{{- with .Server.LanNic }}
+d-i netcfg/choose_interface select {{ . }}
+{{- end }}
+{{- if .Server.IPAddress }}
+d-i netcfg/disable_autoconfig boolean true
+d-i netcfg/get_ipaddress string {{ .Server.IPAddress }}
+d-i netcfg/get_gateway string {{ .Server.Gateway }}
+{{- end }}
+d-i netcfg/get_hostname string {{ .Server.Hostname }}
+{{- with .MirrorHost }}
+
+# Mirror
+d-i mirror/country string manual
+d-i mirror/http/hostname string {{ . }}
+d-i mirror/http/directory string {{ $.MirrorDir }}
+d-i mirror/http/proxy string
+{{- end }}
+
+# Root
+{{ with .Settings.RootPasswordHash }}d-i passwd/root-password-crypted password {{ . }}{{ else }}d-i passwd/root-login boolean false{{ end }}
 
 # Custom content from template
-%s
+{{ .Content }}
+{{- with .Template.KernelParams }}
 
 # Kernel parameters
-# %s
+d-i debian-installer/add-kernel-opts string {{ . }}
+{{- end }}
+{{- with .Packages }}
 
 # Packages
-# %s
-`, s.Serial, s.MACAddress, t.ConfigContent, t.KernelParams, t.Packages)
+d-i pkgsel/include string {{ join " " . }}
+{{- end }}
+`))
+
+// GeneratePreseed 渲染模板内容并套入 Preseed 骨架
+func GeneratePreseed(ctx *RenderContext) (string, error) {
+	return renderSkeleton(preseedSkeleton, ctx)
 }
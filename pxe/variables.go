@@ -0,0 +1,229 @@
+package pxe
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+
+	"pxe-manager/database"
+)
+
+// 变量名须能以 .Vars.name 在模板中引用
+var varNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// ValidVariableName 判断变量名是否合法
+func ValidVariableName(name string) bool {
+	return varNamePattern.MatchString(name)
+}
+
+// NormalizeVariables 校验模板变量定义：名称合法且不重复、类型已知，默认值与枚举值符合类型。
+// 返回的定义中类型已补全、数值已按类型转换
+func NormalizeVariables(defs []database.TemplateVariable) ([]database.TemplateVariable, error) {
+	res := make([]database.TemplateVariable, 0, len(defs))
+	seen := map[string]bool{}
+	for _, d := range defs {
+		if !ValidVariableName(d.Name) {
+			return nil, fmt.Errorf("变量名无效: %q", d.Name)
+		}
+		if seen[d.Name] {
+			return nil, fmt.Errorf("变量重复定义: %s", d.Name)
+		}
+		seen[d.Name] = true
+		switch d.Type {
+		case "":
+			d.Type = database.VarTypeString
+		case database.VarTypeString, database.VarTypeInteger, database.VarTypeNumber, database.VarTypeBoolean:
+		default:
+			return nil, fmt.Errorf("变量 %s 的类型无效: %s", d.Name, d.Type)
+		}
+		enum := make([]interface{}, 0, len(d.Enum))
+		for _, e := range d.Enum {
+			v, err := coerce(d.Type, e)
+			if err != nil {
+				return nil, fmt.Errorf("变量 %s 的可选值无效: %v", d.Name, err)
+			}
+			enum = append(enum, v)
+		}
+		d.Enum = nil
+		if len(enum) > 0 {
+			d.Enum = enum
+		}
+		if d.Default != nil {
+			v, err := CheckVariable(d, d.Default)
+			if err != nil {
+				return nil, fmt.Errorf("变量 %s 的默认值无效: %v", d.Name, err)
+			}
+			d.Default = v
+		}
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+// CheckVariable 按定义校验并转换变量值
+func CheckVariable(d database.TemplateVariable, v interface{}) (interface{}, error) {
+	typ := d.Type
+	if typ == "" {
+		typ = database.VarTypeString
+	}
+	v, err := coerce(typ, v)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.Enum) == 0 {
+		return v, nil
+	}
+	// 定义从 JSON 读出时整数为 float64，比较前统一转换
+	for _, e := range d.Enum {
+		if ev, err := coerce(typ, e); err == nil && ev == v {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("%v 不在可选值 %v 中", v, d.Enum)
+}
+
+// coerce 将 JSON 解码得到的值转换为变量类型（integer 转为 int64）
+func coerce(typ string, v interface{}) (interface{}, error) {
+	switch typ {
+	case database.VarTypeString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("应为字符串: %v", v)
+	case database.VarTypeBoolean:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("应为布尔值: %v", v)
+	case database.VarTypeNumber:
+		switch n := v.(type) {
+		case float64:
+			return n, nil
+		case int64:
+			return float64(n), nil
+		}
+		return nil, fmt.Errorf("应为数值: %v", v)
+	case database.VarTypeInteger:
+		switch n := v.(type) {
+		case int64:
+			return n, nil
+		case float64:
+			if n == math.Trunc(n) && math.Abs(n) < 1<<53 {
+				return int64(n), nil
+			}
+		}
+		return nil, fmt.Errorf("应为整数: %v", v)
+	}
+	return nil, fmt.Errorf("未知类型: %s", typ)
+}
+
+// 变量值来源
+const (
+	SourceDefault = "default"
+	SourceServer  = "server"
+	SourceGroup   = "group:" // 后接分组模式
+)
+
+// Resolution 为某台服务器应用某个模板时的变量解析结果
+type Resolution struct {
+	Values  map[string]interface{} `json:"values"`
+	Sources map[string]string      `json:"sources"`           // 变量名 → default/server/group:<模式>
+	Missing []string               `json:"missing,omitempty"` // 无值的必填变量，按定义顺序
+	Invalid map[string]string      `json:"invalid,omitempty"` // 变量名 → 值不符合定义的原因
+}
+
+// OK 判断所有必填变量均已解析且取值合法
+func (r *Resolution) OK() bool {
+	return len(r.Missing) == 0 && len(r.Invalid) == 0
+}
+
+// MatchesServer 判断变量覆盖是否作用于该服务器；分组模式按通配规则匹配序列号。
+// 主机名由 Agent 上报，不参与匹配，否则机器可通过改名获取其他分组的变量
+func MatchesServer(v *database.ServerVariable, s *database.Server) bool {
+	switch v.Scope {
+	case database.VarScopeServer:
+		return v.Target == s.Serial
+	case database.VarScopeGroup:
+		ok, _ := path.Match(v.Target, s.Serial)
+		return ok
+	}
+	return false
+}
+
+// ResolveVariables 按 服务器 > 分组 > 模板默认值 的优先级解析变量。
+// 模板未定义的覆盖值原样传入，便于多个模板共用的变量；已定义的按类型与枚举校验。
+func ResolveVariables(defs []database.TemplateVariable, overrides []database.ServerVariable, s *database.Server) *Resolution {
+	best := map[string]*database.ServerVariable{}
+	for i := range overrides {
+		v := &overrides[i]
+		if !MatchesServer(v, s) {
+			continue
+		}
+		if cur, ok := best[v.Name]; !ok || takesPrecedence(v, cur) {
+			best[v.Name] = v
+		}
+	}
+	r := &Resolution{Values: map[string]interface{}{}, Sources: map[string]string{}, Invalid: map[string]string{}}
+	defined := map[string]bool{}
+	for _, d := range defs {
+		defined[d.Name] = true
+		if o, ok := best[d.Name]; ok {
+			v, err := CheckVariable(d, o.Value)
+			if err != nil {
+				r.Invalid[d.Name] = err.Error()
+				continue
+			}
+			r.Values[d.Name], r.Sources[d.Name] = v, sourceOf(o)
+			continue
+		}
+		if d.Default != nil {
+			v, err := CheckVariable(d, d.Default)
+			if err != nil {
+				r.Invalid[d.Name] = err.Error()
+				continue
+			}
+			r.Values[d.Name], r.Sources[d.Name] = v, SourceDefault
+			continue
+		}
+		if d.Required {
+			r.Missing = append(r.Missing, d.Name)
+		}
+	}
+	names := make([]string, 0, len(best))
+	for name := range best {
+		if !defined[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.Values[name], r.Sources[name] = best[name].Value, sourceOf(best[name])
+	}
+	if len(r.Invalid) == 0 {
+		r.Invalid = nil
+	}
+	return r
+}
+
+// takesPrecedence 判断 a 是否比 b 优先：服务器级优先；同为分组时 priority 大者优先，其次模式更长者，最后 ID 大者
+func takesPrecedence(a, b *database.ServerVariable) bool {
+	if a.Scope != b.Scope {
+		return a.Scope == database.VarScopeServer
+	}
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if len(a.Target) != len(b.Target) {
+		return len(a.Target) > len(b.Target)
+	}
+	return a.ID > b.ID
+}
+
+func sourceOf(v *database.ServerVariable) string {
+	if v.Scope == database.VarScopeServer {
+		return SourceServer
+	}
+	return SourceGroup + v.Target
+}
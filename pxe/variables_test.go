@@ -0,0 +1,131 @@
+package pxe
+
+import (
+	"reflect"
+	"testing"
+
+	"pxe-manager/database"
+)
+
+func TestNormalizeVariables(t *testing.T) {
+	defs, err := NormalizeVariables([]database.TemplateVariable{
+		{Name: "disk", Default: "sda"},
+		{Name: "swap_mb", Type: database.VarTypeInteger, Default: float64(4096), Enum: []interface{}{float64(2048), float64(4096)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defs[0].Type != database.VarTypeString || defs[1].Default != int64(4096) || !reflect.DeepEqual(defs[1].Enum, []interface{}{int64(2048), int64(4096)}) {
+		t.Fatalf("defs = %+v", defs)
+	}
+	for _, bad := range [][]database.TemplateVariable{
+		{{Name: "1disk"}},
+		{{Name: "disk-name"}},
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a", Type: "list"}},
+		{{Name: "a", Type: database.VarTypeInteger, Default: 1.5}},
+		{{Name: "a", Type: database.VarTypeBoolean, Enum: []interface{}{"yes"}}},
+		{{Name: "a", Enum: []interface{}{"x", "y"}, Default: "z"}},
+	} {
+		if _, err := NormalizeVariables(bad); err == nil {
+			t.Errorf("%+v accepted", bad)
+		}
+	}
+}
+
+func TestCheckVariableCoercion(t *testing.T) {
+	cases := []struct {
+		typ  string
+		in   interface{}
+		want interface{}
+		ok   bool
+	}{
+		{database.VarTypeString, "x", "x", true},
+		{"", "x", "x", true},
+		{database.VarTypeString, float64(1), nil, false},
+		{database.VarTypeInteger, float64(42), int64(42), true},
+		{database.VarTypeInteger, int64(-3), int64(-3), true},
+		{database.VarTypeInteger, 42.5, nil, false},
+		{database.VarTypeInteger, float64(1 << 60), nil, false},
+		{database.VarTypeInteger, "42", nil, false},
+		{database.VarTypeNumber, int64(2), float64(2), true},
+		{database.VarTypeNumber, 2.5, 2.5, true},
+		{database.VarTypeBoolean, true, true, true},
+		{database.VarTypeBoolean, "true", nil, false},
+	}
+	for _, c := range cases {
+		got, err := CheckVariable(database.TemplateVariable{Name: "v", Type: c.typ}, c.in)
+		if (err == nil) != c.ok || got != c.want {
+			t.Errorf("%s %#v = %#v, %v; want %#v", c.typ, c.in, got, err, c.want)
+		}
+	}
+	// 从 JSON 读出的枚举为 float64，与 integer 值比较前统一转换
+	d := database.TemplateVariable{Name: "v", Type: database.VarTypeInteger, Enum: []interface{}{float64(1), float64(2)}}
+	if v, err := CheckVariable(d, int64(2)); err != nil || v != int64(2) {
+		t.Fatalf("enum = %v, %v", v, err)
+	}
+	if _, err := CheckVariable(d, int64(3)); err == nil {
+		t.Fatal("value outside enum accepted")
+	}
+}
+
+func TestResolveVariablesPrecedence(t *testing.T) {
+	defs := []database.TemplateVariable{
+		{Name: "disk", Default: "sda"},
+		{Name: "swap_mb", Type: database.VarTypeInteger, Default: int64(2048)},
+		{Name: "ntp", Required: true},
+		{Name: "bond", Type: database.VarTypeBoolean},
+		{Name: "tz", Required: true},
+	}
+	overrides := []database.ServerVariable{
+		{ID: 1, Scope: database.VarScopeGroup, Target: "A12-*", Name: "disk", Value: "sdb"},
+		{ID: 2, Scope: database.VarScopeGroup, Target: "A*", Name: "disk", Value: "sdc"}, // 模式更短，优先级低
+		{ID: 3, Scope: database.VarScopeGroup, Target: "*", Name: "disk", Value: "sdd", Priority: 10},
+		{ID: 4, Scope: database.VarScopeServer, Target: "A12-01", Name: "swap_mb", Value: float64(8192)},
+		{ID: 5, Scope: database.VarScopeGroup, Target: "A12-*", Name: "swap_mb", Value: float64(4096), Priority: 100},
+		{ID: 6, Scope: database.VarScopeGroup, Target: "A12-*", Name: "ntp", Value: "ntp.example.com"},
+		{ID: 7, Scope: database.VarScopeGroup, Target: "B*", Name: "tz", Value: "UTC"}, // 不匹配
+		{ID: 8, Scope: database.VarScopeServer, Target: "A12-01", Name: "bond", Value: "yes"},
+		{ID: 9, Scope: database.VarScopeServer, Target: "A12-01", Name: "extra", Value: "raw"},
+		{ID: 10, Scope: database.VarScopeServer, Target: "A12-02", Name: "extra", Value: "other"},
+	}
+	r := ResolveVariables(defs, overrides, &database.Server{Serial: "A12-01"})
+	wantValues := map[string]interface{}{"disk": "sdd", "swap_mb": int64(8192), "ntp": "ntp.example.com", "extra": "raw"}
+	wantSources := map[string]string{"disk": SourceGroup + "*", "swap_mb": SourceServer, "ntp": SourceGroup + "A12-*", "extra": SourceServer}
+	if !reflect.DeepEqual(r.Values, wantValues) || !reflect.DeepEqual(r.Sources, wantSources) {
+		t.Fatalf("values = %v sources = %v", r.Values, r.Sources)
+	}
+	if !reflect.DeepEqual(r.Missing, []string{"tz"}) || len(r.Invalid) != 1 || r.Invalid["bond"] == "" || r.OK() {
+		t.Fatalf("missing = %v invalid = %v", r.Missing, r.Invalid)
+	}
+
+	// 同优先级的分组：模式更长者优先，其次 ID 大者
+	overrides = []database.ServerVariable{
+		{ID: 1, Scope: database.VarScopeGroup, Target: "A12-*", Name: "disk", Value: "sdb"},
+		{ID: 2, Scope: database.VarScopeGroup, Target: "A*", Name: "disk", Value: "sdc"},
+		{ID: 3, Scope: database.VarScopeGroup, Target: "A?2-*", Name: "disk", Value: "sde"},
+	}
+	r = ResolveVariables(defs[:1], overrides, &database.Server{Serial: "A12-01"})
+	if r.Values["disk"] != "sde" || !r.OK() {
+		t.Fatalf("tie break = %v", r.Values)
+	}
+	r = ResolveVariables(defs[:1], nil, &database.Server{Serial: "A12-01"})
+	if r.Values["disk"] != "sda" || r.Sources["disk"] != SourceDefault || r.Invalid != nil {
+		t.Fatalf("default = %+v", r)
+	}
+}
+
+// 主机名由 Agent 上报，改名不能获取其他分组的变量
+func TestGroupMatchesSerialOnly(t *testing.T) {
+	v := &database.ServerVariable{Scope: database.VarScopeGroup, Target: "db-*", Name: "rootpw", Value: "x"}
+	if MatchesServer(v, &database.Server{Serial: "A12-01", Hostname: "db-primary"}) {
+		t.Fatal("group pattern matched hostname")
+	}
+	if !MatchesServer(v, &database.Server{Serial: "db-07", Hostname: "web-1"}) {
+		t.Fatal("group pattern did not match serial")
+	}
+	r := ResolveVariables(nil, []database.ServerVariable{*v}, &database.Server{Serial: "A12-01", Hostname: "db-primary"})
+	if len(r.Values) != 0 {
+		t.Fatalf("values = %v", r.Values)
+	}
+}
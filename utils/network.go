@@ -1,27 +1,70 @@
 package utils
 
 import (
-	"net"
+	"net/netip"
 	"strings"
 )
 
-// IsIPInWhitelist 支持单 IP 与 CIDR
-func IsIPInWhitelist(ip string, whitelist []string) bool {
-	clientIP := net.ParseIP(ip)
-	if clientIP == nil {
-		return false
-	}
-	for _, item := range whitelist {
+// IPAllowList 为启动时解析好的 IP/CIDR 列表，支持 IPv4 与 IPv6
+type IPAllowList struct {
+	prefixes []netip.Prefix
+}
+
+// ParseIPAllowList 解析单 IP 或 CIDR 条目，返回可用列表与无法解析的条目
+func ParseIPAllowList(entries []string) (*IPAllowList, []string) {
+	l := &IPAllowList{}
+	var invalid []string
+	for _, item := range entries {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
 		if strings.Contains(item, "/") {
-			_, cidrNet, err := net.ParseCIDR(item)
-			if err == nil && cidrNet.Contains(clientIP) {
-				return true
+			p, err := netip.ParsePrefix(item)
+			if err != nil {
+				invalid = append(invalid, item)
+				continue
 			}
-		} else {
-			if item == ip {
-				return true
+			// IPv4-mapped 前缀统一为 IPv4 形式，与 Contains 中的 Unmap 对应
+			if p.Addr().Is4In6() && p.Bits() >= 96 {
+				p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
 			}
+			l.prefixes = append(l.prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			invalid = append(invalid, item)
+			continue
+		}
+		addr = addr.Unmap().WithZone("")
+		l.prefixes = append(l.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return l, invalid
+}
+
+// Contains 判断 IP 是否在列表中；无法解析的 IP 返回 false
+func (l *IPAllowList) Contains(ip string) bool {
+	if l == nil || len(l.prefixes) == 0 {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap().WithZone("")
+	for _, p := range l.prefixes {
+		if p.Contains(addr) {
+			return true
 		}
 	}
 	return false
 }
+
+// Len 返回有效条目数
+func (l *IPAllowList) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.prefixes)
+}
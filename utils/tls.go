@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// CertReloader 持有当前的服务端证书与客户端 CA，Reload 失败时保留旧值，
+// 已建立的连接不受影响，新握手使用最新加载的证书
+type CertReloader struct {
+	certFile, keyFile, caFile string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	extraCAs  []*x509.Certificate               // 不来自文件的客户端 CA（如内置 CA）
+	revoked   func(cert *x509.Certificate) bool // 握手时检查客户端证书是否已吊销
+}
+
+// NewCertReloader 加载证书；caFile 为空时不校验客户端证书
+func NewCertReloader(certFile, keyFile, caFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload 重新读取证书、私钥与 CA 文件
+func (r *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("加载服务端证书失败: %w", err)
+	}
+	var pem []byte
+	if r.caFile != "" {
+		if pem, err = os.ReadFile(r.caFile); err != nil {
+			return fmt.Errorf("读取客户端 CA 失败: %w", err)
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			return errors.New("客户端 CA 文件中没有有效证书")
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = nil
+	if r.caFile != "" || len(r.extraCAs) > 0 {
+		r.clientCAs = x509.NewCertPool()
+		r.clientCAs.AppendCertsFromPEM(pem)
+		for _, ca := range r.extraCAs {
+			r.clientCAs.AddCert(ca)
+		}
+	}
+	return nil
+}
+
+// AddClientCA 追加信任的客户端 CA，Reload 后仍然保留
+func (r *CertReloader) AddClientCA(ca *x509.Certificate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.extraCAs = append(r.extraCAs, ca)
+	if r.clientCAs == nil {
+		r.clientCAs = x509.NewCertPool()
+	}
+	r.clientCAs.AddCert(ca)
+}
+
+// SetRevocationCheck 设置客户端证书吊销检查，已吊销的证书在握手时被拒绝
+func (r *CertReloader) SetRevocationCheck(fn func(cert *x509.Certificate) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revoked = fn
+}
+
+// TLSConfig 返回每次握手时读取最新证书的配置；未配置 CA 时忽略 clientAuth
+func (r *CertReloader) TLSConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	// http.Server.ServeTLS 要求基础配置能提供证书
+	base.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		return r.cert, nil
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		cfg := &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{*r.cert},
+			NextProtos:   []string{"h2", "http/1.1"},
+		}
+		if r.clientCAs != nil {
+			cfg.ClientCAs = r.clientCAs
+			cfg.ClientAuth = clientAuth
+		}
+		if revoked := r.revoked; revoked != nil {
+			cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+				if len(cs.VerifiedChains) > 0 && revoked(cs.VerifiedChains[0][0]) {
+					return errors.New("客户端证书已吊销")
+				}
+				return nil
+			}
+		}
+		return cfg, nil
+	}
+	return base
+}
@@ -6,6 +6,11 @@
     tokenInput: document.getElementById('authToken'),
     saveTokenBtn: document.getElementById('saveTokenBtn'),
     tokenStatus: document.getElementById('tokenStatus'),
+    loginUser: document.getElementById('loginUser'),
+    loginPass: document.getElementById('loginPass'),
+    loginBtn: document.getElementById('loginBtn'),
+    ssoBtn: document.getElementById('ssoBtn'),
+    logoutBtn: document.getElementById('logoutBtn'),
 
     refreshServersBtn: document.getElementById('refreshServersBtn'),
     serversTableBody: document.querySelector('#serversTable tbody'),
@@ -22,15 +27,20 @@
     cfgContent: document.getElementById('cfgContent'),
     cfgKernelParams: document.getElementById('cfgKernelParams'),
     cfgPackages: document.getElementById('cfgPackages'),
+    cfgVariables: document.getElementById('cfgVariables'),
+    cfgComment: document.getElementById('cfgComment'),
 
     applyForm: document.getElementById('applyForm'),
     applyCfgId: document.getElementById('applyCfgId'),
     applySerial: document.getElementById('applySerial'),
+    renderBtn: document.getElementById('renderBtn'),
+    renderOutput: document.getElementById('renderOutput'),
 
     loadAllBtn: document.getElementById('loadAllBtn'),
     debugOutput: document.getElementById('debugOutput')
   };
 
+  // 旧版本把登录会话令牌保存在 localStorage，现改为 HttpOnly Cookie，这里只保留手动填写的 API 令牌
   els.tokenInput.value = authToken;
   els.saveTokenBtn.addEventListener('click', () => {
     authToken = els.tokenInput.value.trim();
@@ -39,36 +49,97 @@
     pingBackend();
   });
 
+  // 登录会话由服务端写入 HttpOnly Cookie，脚本不接触会话令牌
+  els.loginBtn.addEventListener('click', async () => {
+    try {
+      const res = await fetch(API_BASE + '/auth/login', {
+        method: 'POST',
+        credentials: 'same-origin',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ username: els.loginUser.value.trim(), password: els.loginPass.value, cookie: true })
+      });
+      const data = await res.json();
+      if (!res.ok) throw new Error(data.error || ('HTTP ' + res.status));
+      els.loginPass.value = '';
+      els.tokenStatus.textContent = '已登录：' + data.username;
+      pingBackend();
+    } catch (e) {
+      els.tokenStatus.textContent = '登录失败：' + e.message;
+    }
+  });
+
+  els.logoutBtn.addEventListener('click', async () => {
+    try {
+      await apiPost('/auth/logout');
+    } catch (e) {
+      // 会话可能已过期，仍视为已退出
+    }
+    els.tokenStatus.textContent = '已退出';
+    pingBackend();
+  });
+
+  // 凭 Cookie 会话发起写请求时，需把 CSRF Cookie 的值放入 X-CSRF-Token 头
+  function csrfToken() {
+    const m = document.cookie.match(/(?:^|;\s*)pxe_csrf=([^;]*)/);
+    return m ? decodeURIComponent(m[1]) : '';
+  }
+
   function headers() {
     const h = { 'Content-Type': 'application/json' };
     if (authToken) {
       h['Authorization'] = 'Bearer ' + authToken;
     }
+    const csrf = csrfToken();
+    if (csrf) {
+      h['X-CSRF-Token'] = csrf;
+    }
     return h;
   }
 
+  // 从错误响应中取出服务端给出的原因（模板行号、缺失的变量等）
+  async function apiError(res) {
+    let msg = 'HTTP ' + res.status;
+    try {
+      const data = await res.json();
+      if (data.error) msg = data.error;
+      if (data.line) msg += '（第 ' + data.line + ' 行）';
+      if (data.missing && data.missing.length) msg += '，缺少变量：' + data.missing.join(', ');
+      if (data.invalid) msg += '，取值无效：' + Object.keys(data.invalid).map(k => k + ' ' + data.invalid[k]).join('; ');
+    } catch (e) {
+      // 非 JSON 响应
+    }
+    return new Error(msg);
+  }
+
   async function apiGet(path) {
-    const res = await fetch(API_BASE + path, { headers: headers() });
+    const res = await fetch(API_BASE + path, { credentials: 'same-origin', headers: headers() });
     if (!res.ok) throw new Error('HTTP ' + res.status);
     return res.json();
   }
   async function apiPost(path, data) {
-    const res = await fetch(API_BASE + path, { method: 'POST', headers: headers(), body: JSON.stringify(data||{}) });
-    if (!res.ok) throw new Error('HTTP ' + res.status);
+    const res = await fetch(API_BASE + path, { method: 'POST', credentials: 'same-origin', headers: headers(), body: JSON.stringify(data||{}) });
+    if (!res.ok) throw await apiError(res);
     return res.json();
   }
   async function apiPut(path, data) {
-    const res = await fetch(API_BASE + path, { method: 'PUT', headers: headers(), body: JSON.stringify(data||{}) });
-    if (!res.ok) throw new Error('HTTP ' + res.status);
+    const res = await fetch(API_BASE + path, { method: 'PUT', credentials: 'same-origin', headers: headers(), body: JSON.stringify(data||{}) });
+    if (!res.ok) throw await apiError(res);
     return res.text();
   }
 
   // servers
+  fetch(API_BASE + '/auth/providers').then(r => r.json()).then(p => {
+    if (p.oidc) els.ssoBtn.style.display = '';
+  }).catch(() => {});
+  els.ssoBtn.addEventListener('click', () => {
+    location.href = API_BASE + '/auth/oidc/login';
+  });
+
   async function loadServers(status='pending') {
     try {
       const data = await apiGet('/servers?status=' + encodeURIComponent(status));
       els.serversTableBody.innerHTML = '';
-      data.forEach(row => {
+      (data.items || []).forEach(row => {
         const tr = document.createElement('tr');
         tr.innerHTML = `
           <td>${row.serial||''}</td>
@@ -122,13 +193,14 @@
     try {
       const data = await apiGet('/configs');
       els.configsTableBody.innerHTML = '';
-      data.forEach(row => {
+      (data.items || []).forEach(row => {
         const tr = document.createElement('tr');
         tr.innerHTML = `
           <td>${row.id||''}</td>
           <td>${row.name||''}</td>
           <td>${row.systemType||''}</td>
           <td>${row.systemVersion||''}</td>
+          <td>${row.revision||''}</td>
           <td>
             <button data-id="${row.id}" class="btn-fill">填入</button>
           </td>
@@ -136,7 +208,7 @@
         els.configsTableBody.appendChild(tr);
       });
     } catch (e) {
-      els.configsTableBody.innerHTML = `<tr><td colspan="5" class="error">加载失败：${e.message}</td></tr>`;
+      els.configsTableBody.innerHTML = `<tr><td colspan="6" class="error">加载失败：${e.message}</td></tr>`;
     }
   }
 
@@ -156,6 +228,8 @@
         els.cfgContent.value = cfg.configContent || '';
         els.cfgKernelParams.value = cfg.kernelParams || '';
         els.cfgPackages.value = cfg.packages || '';
+        els.cfgVariables.value = (cfg.variables && cfg.variables.length) ? JSON.stringify(cfg.variables, null, 2) : '';
+        els.cfgComment.value = '';
       } catch (e) {
         alert('获取配置失败：' + e.message);
       }
@@ -165,6 +239,14 @@
   els.configForm.addEventListener('submit', async (ev) => {
     ev.preventDefault();
     const id = (els.cfgId.value||'').trim();
+    let variables = [];
+    try {
+      const raw = (els.cfgVariables.value||'').trim();
+      if (raw) variables = JSON.parse(raw);
+    } catch (e) {
+      alert('Variables 不是有效的 JSON：' + e.message);
+      return;
+    }
     const payload = {
       name: (els.cfgName.value||'').trim(),
       description: (els.cfgDescription.value||'').trim(),
@@ -172,12 +254,14 @@
       systemVersion: (els.cfgSystemVersion.value||'').trim(),
       configContent: els.cfgContent.value,
       kernelParams: els.cfgKernelParams.value,
-      packages: els.cfgPackages.value
+      packages: els.cfgPackages.value,
+      variables: variables,
+      comment: (els.cfgComment.value||'').trim()
     };
     try {
       if (id) {
-        await apiPut('/configs/' + encodeURIComponent(id), payload);
-        alert('已更新');
+        const j = JSON.parse(await apiPut('/configs/' + encodeURIComponent(id), payload));
+        alert('已更新为版本 ' + j.revision);
       } else {
         const j = await apiPost('/configs', payload);
         alert('已创建：ID ' + j.id);
@@ -201,6 +285,23 @@
     }
   });
 
+  // 预览渲染结果与将写入的文件，变化的文件附带与磁盘上现有内容的差异
+  els.renderBtn.addEventListener('click', async () => {
+    const cfgId = (els.applyCfgId.value||'').trim();
+    const serial = (els.applySerial.value||'').trim();
+    if (!cfgId || !serial) { alert('请填写模板ID与序列号'); return; }
+    els.renderOutput.textContent = '渲染中...';
+    try {
+      const res = await fetch(API_BASE + `/configs/${encodeURIComponent(cfgId)}/render?serial=${encodeURIComponent(serial)}`, { credentials: 'same-origin', headers: headers() });
+      if (!res.ok) throw await apiError(res);
+      const j = await res.json();
+      const files = j.files.map(f => `# ${f.path}（${f.disk}）` + (f.diff ? '\n' + f.diff : '')).join('\n');
+      els.renderOutput.textContent = `${files}\n\n# ${j.format}（版本 ${j.revision}）\n${j.content}`;
+    } catch (e) {
+      els.renderOutput.textContent = '预览失败：' + e.message;
+    }
+  });
+
   els.loadAllBtn.addEventListener('click', async () => {
     els.debugOutput.textContent = '加载中...';
     try {
@@ -220,7 +321,7 @@
     el.textContent = '后端状态：检测中…';
     el.classList.remove('ok','bad');
     try {
-      const res = await fetch(API_BASE + '/health', { headers: headers() });
+      const res = await fetch(API_BASE + '/health', { credentials: 'same-origin', headers: headers() });
       if (res.ok) {
         el.textContent = '后端状态：已连接';
         el.classList.add('ok');
@@ -6,10 +6,10 @@
     tokenInput: document.getElementById('authToken'),
     saveTokenBtn: document.getElementById('saveTokenBtn'),
     tokenStatus: document.getElementById('tokenStatus'),
-    offset: document.getElementById('offset'),
     limit: document.getElementById('limit'),
     order: document.getElementById('order'),
     loadBtn: document.getElementById('loadBtn'),
+    moreBtn: document.getElementById('moreBtn'),
     logs: document.getElementById('logs')
   };
   els.tokenInput.value = authToken;
@@ -25,45 +25,47 @@
     return h;
   }
 
+  // 筛选在服务端完成；nextCursor 用于加载下一页
   let lastLogs = [];
-  function applyFilters() {
-    const m = (document.getElementById('fMethod').value||'').trim().toUpperCase();
-    const p = (document.getElementById('fPath').value||'').trim();
-    const a = (document.getElementById('fAction').value||'').trim();
-    const s = (document.getElementById('fStatus').value||'').trim();
-    let arr = lastLogs.slice();
-    if (m) arr = arr.filter(x => String(x.method||'').toUpperCase()===m);
-    if (p) arr = arr.filter(x => String(x.path||'').includes(p));
-    if (a) arr = arr.filter(x => String(x.action||'').includes(a));
-    if (s) arr = arr.filter(x => String(x.status||'').includes(s));
-    els.logs.textContent = JSON.stringify(arr, null, 2);
-    return arr;
+  let nextCursor = '';
+  function render() {
+    els.logs.textContent = JSON.stringify(lastLogs, null, 2);
+    els.moreBtn.disabled = !nextCursor;
+    return lastLogs;
   }
 
-  async function load() {
-    els.logs.textContent = '加载中...';
+  function query(cursor) {
     const qs = new URLSearchParams({
-      offset: String(els.offset.value||0),
       limit: String(els.limit.value||100),
       order: String(els.order.value||'desc')
     });
+    const filters = { method: 'fMethod', path: 'fPath', action: 'fAction', status: 'fStatus', clientIP: 'fClientIP', actor: 'fActor', target: 'fTarget', from: 'fFrom', to: 'fTo' };
+    Object.keys(filters).forEach(k => {
+      const v = (document.getElementById(filters[k]).value||'').trim();
+      if (v) qs.set(k, v);
+    });
+    if (cursor) qs.set('cursor', cursor);
+    return qs;
+  }
+
+  async function load(append) {
+    if (!append) els.logs.textContent = '加载中...';
     try {
-      const res = await fetch(API_BASE + '/audit/logs?' + qs.toString(), { headers: headers() });
+      const res = await fetch(API_BASE + '/audit/logs?' + query(append ? nextCursor : '').toString(), { headers: headers() });
       if (!res.ok) throw new Error('HTTP ' + res.status);
-      lastLogs = await res.json();
-      applyFilters();
+      const page = await res.json();
+      lastLogs = append ? lastLogs.concat(page.items || []) : (page.items || []);
+      nextCursor = page.nextCursor || '';
+      render();
     } catch (e) {
       els.logs.textContent = '加载失败：' + e.message;
     }
   }
 
-  els.loadBtn.addEventListener('click', load);
-  ['fMethod','fPath','fAction','fStatus'].forEach(id => {
-    const el = document.getElementById(id);
-    if (el) el.addEventListener('input', applyFilters);
-  });
+  els.loadBtn.addEventListener('click', () => load(false));
+  els.moreBtn.addEventListener('click', () => load(true));
   document.getElementById('exportBtn').addEventListener('click', () => {
-    const arr = applyFilters();
+    const arr = render();
     const blob = new Blob([JSON.stringify(arr, null, 2)], {type: 'application/json'});
     const url = URL.createObjectURL(blob);
     const a = document.createElement('a');
@@ -73,5 +75,5 @@
     URL.revokeObjectURL(url);
   });
 
-  load();
+  load(false);
 })();